@@ -0,0 +1,3 @@
+module github.com/camilamedeir0s/bookinfo-go/bookinfo-load
+
+go 1.22.4
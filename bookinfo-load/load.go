@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options configure a load run.
+type Options struct {
+	Target      string
+	RPS         float64
+	Concurrency int
+	Duration    time.Duration
+	Requests    int
+	Timeout     time.Duration
+	Mix         []Endpoint
+	Products    []int
+	Users       []string
+	LoggedIn    float64
+}
+
+// Endpoint is a path of productpage with its share of the traffic. {id} in the
+// path is replaced by one of the product ids.
+type Endpoint struct {
+	Path   string
+	Weight int
+}
+
+// parseMix reads a list such as "/productpage=3,/api/v1/products/{id}=1".
+// The weight may be left out and defaults to 1.
+func parseMix(s string) ([]Endpoint, error) {
+	var mix []Endpoint
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		path, weight := item, 1
+		if i := strings.LastIndex(item, "="); i > 0 {
+			w, err := strconv.Atoi(item[i+1:])
+			if err != nil || w < 0 {
+				return nil, fmt.Errorf("mix %q: weight must be a non-negative integer", item)
+			}
+			path, weight = item[:i], w
+		}
+		if !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("mix %q: path must start with /", item)
+		}
+		if weight > 0 {
+			mix = append(mix, Endpoint{Path: path, Weight: weight})
+		}
+	}
+	if len(mix) == 0 {
+		return nil, errors.New("mix has no endpoint with a positive weight")
+	}
+	return mix, nil
+}
+
+func parseProducts(s string) ([]int, error) {
+	var products []int
+	for _, item := range strings.Split(s, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(item))
+		if err != nil || id < 0 {
+			return nil, fmt.Errorf("product %q is not a non-negative integer", item)
+		}
+		products = append(products, id)
+	}
+	return products, nil
+}
+
+func (o Options) validate() error {
+	switch {
+	case !strings.HasPrefix(o.Target, "http://") && !strings.HasPrefix(o.Target, "https://"):
+		return errors.New("target must be an http:// or https:// URL")
+	case o.RPS < 0:
+		return errors.New("rps must not be negative")
+	case o.Concurrency < 1:
+		return errors.New("concurrency must be at least 1")
+	case o.Duration <= 0 && o.Requests <= 0:
+		return errors.New("set a duration or a number of requests")
+	case o.LoggedIn < 0 || o.LoggedIn > 1:
+		return errors.New("logged-in must be between 0 and 1")
+	case o.LoggedIn > 0 && len(o.Users) == 0:
+		return errors.New("logged-in traffic needs at least one user")
+	case len(o.Mix) == 0 || len(o.Products) == 0:
+		return errors.New("mix and products must not be empty")
+	}
+	return nil
+}
+
+// request is one request to send, chosen from the mix.
+type request struct {
+	endpoint string
+	url      string
+	user     string
+}
+
+// picker draws requests from the mix. It is used by a single goroutine.
+type picker struct {
+	options Options
+	total   int
+	rand    *rand.Rand
+}
+
+func newPicker(options Options, seed int64) *picker {
+	p := &picker{options: options, rand: rand.New(rand.NewSource(seed))}
+	for _, endpoint := range options.Mix {
+		p.total += endpoint.Weight
+	}
+	return p
+}
+
+func (p *picker) next() request {
+	n := p.rand.Intn(p.total)
+	endpoint := p.options.Mix[len(p.options.Mix)-1]
+	for _, e := range p.options.Mix {
+		if n < e.Weight {
+			endpoint = e
+			break
+		}
+		n -= e.Weight
+	}
+
+	product := p.options.Products[p.rand.Intn(len(p.options.Products))]
+	req := request{
+		endpoint: endpoint.Path,
+		url:      strings.TrimSuffix(p.options.Target, "/") + strings.ReplaceAll(endpoint.Path, "{id}", strconv.Itoa(product)),
+	}
+	if p.rand.Float64() < p.options.LoggedIn {
+		req.user = p.options.Users[p.rand.Intn(len(p.options.Users))]
+	}
+	return req
+}
+
+// run sends requests until the duration or the request count is reached, or
+// ctx is cancelled. Requests in flight then run to completion, so the end of
+// the run does not show up as errors. With RPS set the requests are paced at
+// that rate, spread over the workers; if all workers are busy the achieved
+// rate is lower. With RPS 0 every worker sends its next request as soon as the
+// last one ends.
+func run(ctx context.Context, options Options) *Report {
+	if options.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.Duration)
+		defer cancel()
+	}
+
+	client := &http.Client{
+		Timeout: options.Timeout,
+		Transport: &http.Transport{
+			MaxIdleConns:        options.Concurrency,
+			MaxIdleConnsPerHost: options.Concurrency,
+		},
+		// Redirects, such as the one after /login, are counted as is.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	requests := make(chan request)
+	go func() {
+		defer close(requests)
+		picker := newPicker(options, time.Now().UnixNano())
+		var tick <-chan time.Time
+		if options.RPS > 0 {
+			ticker := time.NewTicker(time.Duration(float64(time.Second) / options.RPS))
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for sent := 0; options.Requests <= 0 || sent < options.Requests; sent++ {
+			if tick != nil {
+				select {
+				case <-tick:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case requests <- picker.next():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	recorder := newRecorder()
+	var wg sync.WaitGroup
+	for i := 0; i < options.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for req := range requests {
+				recorder.record(send(client, req))
+			}
+		}()
+	}
+	wg.Wait()
+	return recorder.report()
+}
+
+// result is the outcome of one request.
+type result struct {
+	request
+	status   int
+	latency  time.Duration
+	err      error
+	servedBy *servedBy
+}
+
+func send(client *http.Client, req request) result {
+	res := result{request: req}
+	httpReq, err := http.NewRequest(http.MethodGet, req.url, nil)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	if req.user != "" {
+		httpReq.Header.Set("end-user", req.user)
+	}
+
+	start := time.Now()
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		res.latency, res.err = time.Since(start), err
+		return res
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	res.latency, res.status, res.err = time.Since(start), resp.StatusCode, err
+
+	if served, ok := observeReviews(resp.Header.Get("Content-Type"), body); ok && err == nil {
+		res.servedBy = &served
+	}
+	return res
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseMix(t *testing.T) {
+	mix, err := parseMix("/productpage=3, /api/v1/products/{id} ,/logout=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(mix) != "[{/productpage 3} {/api/v1/products/{id} 1}]" {
+		t.Errorf("mix = %v", mix)
+	}
+
+	for _, bad := range []string{"", "/a=0", "productpage=1", "/a=x", "/a=-1"} {
+		if _, err := parseMix(bad); err == nil {
+			t.Errorf("parseMix(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestPicker(t *testing.T) {
+	options := Options{
+		Target:   "http://productpage/",
+		Mix:      []Endpoint{{"/a/{id}", 3}, {"/b", 1}},
+		Products: []int{7},
+		Users:    []string{"jason"},
+		LoggedIn: 0.5,
+	}
+	p := newPicker(options, 1)
+	counts := map[string]int{}
+	loggedIn := 0
+	for i := 0; i < 4000; i++ {
+		req := p.next()
+		counts[req.url]++
+		if req.user == "jason" {
+			loggedIn++
+		}
+	}
+	if a := counts["http://productpage/a/7"]; a < 2800 || a > 3200 {
+		t.Errorf("/a/7 picked %d times of 4000, want about 3000", a)
+	}
+	if loggedIn < 1800 || loggedIn > 2200 {
+		t.Errorf("%d logged-in requests of 4000, want about 2000", loggedIn)
+	}
+}
+
+func TestObserveReviews(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        servedBy
+		ok          bool
+	}{
+		{
+			name:        "reviews proxy",
+			contentType: "application/json",
+			body:        `{"id":"0","podname":"reviews-v3-5b64f47978-x7vzk","clustername":"east","version":"v3","reviews":[]}`,
+			want:        servedBy{Version: "v3", Pod: "reviews-v3-5b64f47978-x7vzk", Cluster: "east"},
+			ok:          true,
+		},
+		{
+			name:        "reviews without version",
+			contentType: "application/json",
+			body:        `{"id":"0","podname":"reviews-v2-abc","clustername":"","reviews":[{"rating":{"stars":5,"color":"black"}}]}`,
+			want:        servedBy{Version: "unknown", Pod: "reviews-v2-abc"},
+			ok:          true,
+		},
+		{
+			name:        "full product",
+			contentType: "application/json",
+			body:        `{"product":{},"reviews":{"status":200,"data":{"podname":"reviews-v1-abc-def","clustername":"west","version":"v1","reviews":[]}}}`,
+			want:        servedBy{Version: "v1", Pod: "reviews-v1-abc-def", Cluster: "west"},
+			ok:          true,
+		},
+		{
+			name:        "full product without reviews",
+			contentType: "application/json",
+			body:        `{"product":{},"reviews":{"status":503,"error":"unavailable"}}`,
+			want:        servedBy{Version: "unavailable"},
+			ok:          true,
+		},
+		{
+			name:        "details",
+			contentType: "application/json",
+			body:        `{"id":0,"author":"William Shakespeare"}`,
+		},
+		{
+			name:        "page",
+			contentType: "text/html; charset=utf-8",
+			body:        `<div class="max-w-2xl" id="reviews" data-reviews-status="ok" data-reviews-version="v3"><h4>Book Reviews</h4><div class="flex gap-x-1 text-red-500 small-stars">`,
+			want:        servedBy{Version: "v3"},
+			ok:          true,
+		},
+		{
+			name:        "page without version",
+			contentType: "text/html; charset=utf-8",
+			body:        `<div class="max-w-2xl" id="reviews" data-reviews-status="ok"><h4>Book Reviews</h4><div class="flex gap-x-1 text-black-500 small-stars">`,
+			want:        servedBy{Version: "unknown"},
+			ok:          true,
+		},
+		{
+			name:        "page without reviews",
+			contentType: "text/html; charset=utf-8",
+			body:        `<div class="max-w-2xl" id="reviews" data-reviews-status="unavailable"><p>Error fetching product reviews</p>`,
+			want:        servedBy{Version: "unavailable"},
+			ok:          true,
+		},
+		{
+			name:        "translated page",
+			contentType: "text/html; charset=utf-8",
+			body:        `<div class="max-w-2xl" id="reviews" data-reviews-status="ok" data-reviews-version="v2"><h4>Avaliações do livro</h4>`,
+			want:        servedBy{Version: "v2"},
+			ok:          true,
+		},
+		{
+			name:        "page without the reviews section",
+			contentType: "text/html; charset=utf-8",
+			body:        `<h1>Sign in</h1>`,
+		},
+	}
+	for _, tt := range tests {
+		got, ok := observeReviews(tt.contentType, []byte(tt.body))
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: got %+v, %v; want %+v, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	var requests, withUser atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		if r.Header.Get("end-user") == "jason" {
+			withUser.Add(1)
+		}
+		switch r.URL.Path {
+		case "/api/v1/products/0/reviews":
+			pod, version := "reviews-v1-a-b", "v1"
+			if n%2 == 0 {
+				pod, version = "reviews-v2-c-d", "v2"
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"id":"0","podname":%q,"clustername":"test","version":%q,"reviews":[]}`, pod, version)
+		default:
+			http.Error(w, "boom", http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	report := run(context.Background(), Options{
+		Target:      server.URL,
+		Concurrency: 4,
+		Requests:    200,
+		Timeout:     time.Second,
+		Mix:         []Endpoint{{"/api/v1/products/{id}/reviews", 3}, {"/broken", 1}},
+		Products:    []int{0},
+		Users:       []string{"jason"},
+		LoggedIn:    1,
+	})
+
+	if report.Total.Requests != 200 || requests.Load() != 200 {
+		t.Fatalf("report has %d requests, server got %d, want 200", report.Total.Requests, requests.Load())
+	}
+	if withUser.Load() != 200 {
+		t.Errorf("%d requests had end-user, want 200", withUser.Load())
+	}
+	if len(report.Endpoints) != 2 || report.Endpoints[0].Name != "/api/v1/products/{id}/reviews" || report.Endpoints[1].Errors != report.Endpoints[1].Requests {
+		t.Errorf("endpoints = %+v", report.Endpoints)
+	}
+	if report.Total.Errors != report.Total.Statuses["500"] || report.Total.P50Ms > report.Total.P99Ms {
+		t.Errorf("total = %+v", report.Total)
+	}
+	if len(report.Users) != 1 || report.Users[0].Name != "logged-in" {
+		t.Errorf("users = %+v", report.Users)
+	}
+
+	versions := map[string]int{}
+	for _, v := range report.Versions {
+		versions[v.Name] = v.Requests
+	}
+	if versions["v1"]+versions["v2"] != report.Endpoints[0].Requests || versions["v1"] == 0 || versions["v2"] == 0 {
+		t.Errorf("versions = %+v", report.Versions)
+	}
+	if len(report.Pods) != 2 || report.Pods[0].Cluster != "test" {
+		t.Errorf("pods = %+v", report.Pods)
+	}
+
+	var text strings.Builder
+	report.writeText(&text)
+	for _, want := range []string{"200 requests", "reviews version", "reviews-v2-c-d", "statuses: 200="} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("text report does not contain %q:\n%s", want, text.String())
+		}
+	}
+}
+
+func TestRunPacing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	start := time.Now()
+	report := run(context.Background(), Options{
+		Target:      server.URL,
+		RPS:         100,
+		Concurrency: 4,
+		Requests:    20,
+		Timeout:     time.Second,
+		Mix:         []Endpoint{{"/", 1}},
+		Products:    []int{0},
+	})
+	// 20 requests at 100/s take about 200ms.
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("20 requests at 100 rps took %s", elapsed)
+	}
+	if report.Total.Requests != 20 || report.Total.Errors != 0 {
+		t.Errorf("total = %+v", report.Total)
+	}
+}
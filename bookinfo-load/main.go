@@ -0,0 +1,74 @@
+// Command bookinfo-load drives load against productpage and reports latency
+// percentiles, error rates and which reviews versions and pods answered:
+//
+//	bookinfo-load --target http://localhost:8083 --rps 50 --concurrency 20 --duration 1m \
+//		--mix "/productpage=3,/api/v1/products/{id}/reviews=1" --users jason,alice --logged-in 0.3
+//
+// Logged-in requests carry the end-user header, which productpage propagates
+// to the backends like the user of a session, so mesh routing rules on
+// end-user see them. Interrupting the run prints the report of the requests
+// made so far.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const defaultMix = "/productpage=3,/api/v1/products/{id}=1,/api/v1/products/{id}/reviews=1"
+
+func main() {
+	var options Options
+	flag.StringVar(&options.Target, "target", "http://localhost:8083", "base URL of productpage")
+	flag.Float64Var(&options.RPS, "rps", 10, "requests per second across all workers; 0 sends as fast as the workers allow")
+	flag.IntVar(&options.Concurrency, "concurrency", 10, "number of concurrent workers")
+	flag.DurationVar(&options.Duration, "duration", 30*time.Second, "how long to run; 0 to stop after --requests")
+	flag.IntVar(&options.Requests, "requests", 0, "stop after this many requests; 0 for no limit")
+	flag.DurationVar(&options.Timeout, "timeout", 10*time.Second, "timeout of each request")
+	mix := flag.String("mix", defaultMix, "weighted paths, {id} is replaced by a product id")
+	products := flag.String("products", "0", "comma-separated product ids used for {id}")
+	users := flag.String("users", "jason", "comma-separated users of logged-in requests")
+	flag.Float64Var(&options.LoggedIn, "logged-in", 0, "fraction of requests sent with an end-user, 0 to 1")
+	jsonOutput := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+
+	var err error
+	if options.Mix, err = parseMix(*mix); err != nil {
+		fatal(err)
+	}
+	if options.Products, err = parseProducts(*products); err != nil {
+		fatal(err)
+	}
+	for _, user := range strings.Split(*users, ",") {
+		if user = strings.TrimSpace(user); user != "" {
+			options.Users = append(options.Users, user)
+		}
+	}
+	if err := options.validate(); err != nil {
+		fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	report := run(ctx, options)
+
+	if *jsonOutput {
+		err = report.writeJSON(os.Stdout)
+	} else {
+		err = report.writeText(os.Stdout)
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "bookinfo-load:", err)
+	os.Exit(2)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// servedBy identifies the reviews instance behind a response. Version is
+// "unavailable" when productpage could not reach reviews.
+type servedBy struct {
+	Version string
+	Pod     string
+	Cluster string
+}
+
+// productpage marks the reviews section of the page with whether reviews
+// answered and with the version that served it.
+var (
+	reviewsStatus  = regexp.MustCompile(`data-reviews-status="([^"]*)"`)
+	reviewsVersion = regexp.MustCompile(`data-reviews-version="([^"]*)"`)
+)
+
+// observeReviews finds which reviews instance served a productpage response.
+// JSON responses of the reviews proxy and of /full carry the version, podname
+// and clustername reported by reviews; the HTML page carries only the version.
+// Responses of reviews instances too old to report it count as "unknown". ok
+// is false when the response says nothing about reviews.
+func observeReviews(contentType string, body []byte) (servedBy, bool) {
+	if strings.Contains(contentType, "json") {
+		return observeJSON(body)
+	}
+	if strings.Contains(contentType, "html") {
+		return observeHTML(string(body))
+	}
+	return servedBy{}, false
+}
+
+type reviewsResponse struct {
+	PodName     *string `json:"podname"`
+	ClusterName string  `json:"clustername"`
+	Version     string  `json:"version"`
+}
+
+func observeJSON(body []byte) (servedBy, bool) {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		return servedBy{}, false
+	}
+
+	// /api/v1/products/{id}/full nests the reviews response in a section.
+	if _, isReviews := fields["podname"]; !isReviews {
+		var full struct {
+			Reviews *struct {
+				Status int             `json:"status"`
+				Data   json.RawMessage `json:"data"`
+			} `json:"reviews"`
+		}
+		if json.Unmarshal(body, &full) != nil || full.Reviews == nil {
+			return servedBy{}, false
+		}
+		if full.Reviews.Data == nil {
+			return servedBy{Version: "unavailable"}, true
+		}
+		body = full.Reviews.Data
+	}
+
+	var reviews reviewsResponse
+	if json.Unmarshal(body, &reviews) != nil || reviews.PodName == nil {
+		return servedBy{}, false
+	}
+	return servedBy{Version: knownVersion(reviews.Version), Pod: *reviews.PodName, Cluster: reviews.ClusterName}, true
+}
+
+func observeHTML(page string) (servedBy, bool) {
+	status := reviewsStatus.FindStringSubmatch(page)
+	switch {
+	case status == nil:
+		return servedBy{}, false
+	case status[1] != "ok":
+		return servedBy{Version: "unavailable"}, true
+	}
+	var version string
+	if match := reviewsVersion.FindStringSubmatch(page); match != nil {
+		version = match[1]
+	}
+	return servedBy{Version: knownVersion(version)}, true
+}
+
+func knownVersion(version string) string {
+	if version == "" {
+		return "unknown"
+	}
+	return version
+}
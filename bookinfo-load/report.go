@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// stats accumulates the results of a group of requests.
+type stats struct {
+	errors    int
+	statuses  map[string]int
+	latencies []time.Duration
+}
+
+func (s *stats) add(res result) {
+	if s.statuses == nil {
+		s.statuses = map[string]int{}
+	}
+	s.latencies = append(s.latencies, res.latency)
+	switch {
+	case res.err != nil:
+		s.errors++
+		s.statuses["error"]++
+	default:
+		if res.status >= 400 {
+			s.errors++
+		}
+		s.statuses[strconv.Itoa(res.status)]++
+	}
+}
+
+// Summary is the report of a group of requests. Latencies are in
+// milliseconds.
+type Summary struct {
+	Name      string         `json:"name"`
+	Requests  int            `json:"requests"`
+	Errors    int            `json:"errors"`
+	ErrorRate float64        `json:"errorRate"`
+	Statuses  map[string]int `json:"statuses"`
+	MeanMs    float64        `json:"meanMs"`
+	P50Ms     float64        `json:"p50Ms"`
+	P90Ms     float64        `json:"p90Ms"`
+	P95Ms     float64        `json:"p95Ms"`
+	P99Ms     float64        `json:"p99Ms"`
+	MaxMs     float64        `json:"maxMs"`
+}
+
+func (s *stats) summary(name string) Summary {
+	summary := Summary{Name: name, Requests: len(s.latencies), Errors: s.errors, Statuses: s.statuses}
+	if summary.Requests == 0 {
+		return summary
+	}
+	latencies := append([]time.Duration(nil), s.latencies...)
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	var total time.Duration
+	for _, latency := range latencies {
+		total += latency
+	}
+	summary.ErrorRate = float64(s.errors) / float64(summary.Requests)
+	summary.MeanMs = milliseconds(total / time.Duration(len(latencies)))
+	summary.P50Ms = milliseconds(percentile(latencies, 50))
+	summary.P90Ms = milliseconds(percentile(latencies, 90))
+	summary.P95Ms = milliseconds(percentile(latencies, 95))
+	summary.P99Ms = milliseconds(percentile(latencies, 99))
+	summary.MaxMs = milliseconds(latencies[len(latencies)-1])
+	return summary
+}
+
+// percentile uses the nearest-rank method on sorted latencies.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// Share counts the responses served by one reviews version or pod.
+type Share struct {
+	Name     string  `json:"name"`
+	Cluster  string  `json:"cluster,omitempty"`
+	Requests int     `json:"requests"`
+	Percent  float64 `json:"percent"`
+}
+
+// Report is the result of a load run.
+type Report struct {
+	DurationMs float64   `json:"durationMs"`
+	RPS        float64   `json:"rps"`
+	Total      Summary   `json:"total"`
+	Endpoints  []Summary `json:"endpoints"`
+	Users      []Summary `json:"users"`
+	Versions   []Share   `json:"versions"`
+	Pods       []Share   `json:"pods"`
+}
+
+// recorder collects the results of the workers.
+type recorder struct {
+	start time.Time
+
+	mu        sync.Mutex
+	total     stats
+	endpoints map[string]*stats
+	users     map[string]*stats
+	versions  map[string]int
+	pods      map[[2]string]int
+}
+
+func newRecorder() *recorder {
+	return &recorder{
+		start:     time.Now(),
+		endpoints: map[string]*stats{},
+		users:     map[string]*stats{},
+		versions:  map[string]int{},
+		pods:      map[[2]string]int{},
+	}
+}
+
+func (r *recorder) record(res result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.total.add(res)
+	group := func(groups map[string]*stats, name string) {
+		if groups[name] == nil {
+			groups[name] = &stats{}
+		}
+		groups[name].add(res)
+	}
+	group(r.endpoints, res.endpoint)
+	if res.user != "" {
+		group(r.users, "logged-in")
+	} else {
+		group(r.users, "anonymous")
+	}
+
+	if res.servedBy != nil {
+		r.versions[res.servedBy.Version]++
+		if res.servedBy.Pod != "" {
+			r.pods[[2]string{res.servedBy.Pod, res.servedBy.Cluster}]++
+		}
+	}
+}
+
+func (r *recorder) report() *Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	elapsed := time.Since(r.start)
+	report := &Report{
+		DurationMs: milliseconds(elapsed),
+		Total:      r.total.summary("total"),
+		Endpoints:  summaries(r.endpoints),
+		Users:      summaries(r.users),
+		Versions:   []Share{},
+		Pods:       []Share{},
+	}
+	report.RPS = float64(report.Total.Requests) / elapsed.Seconds()
+
+	observed := 0
+	for _, count := range r.versions {
+		observed += count
+	}
+	for version, count := range r.versions {
+		report.Versions = append(report.Versions, Share{Name: version, Requests: count, Percent: percent(count, observed)})
+	}
+	// Only JSON responses name the pod, so pods are compared among those.
+	withPod := 0
+	for _, count := range r.pods {
+		withPod += count
+	}
+	for pod, count := range r.pods {
+		report.Pods = append(report.Pods, Share{Name: pod[0], Cluster: pod[1], Requests: count, Percent: percent(count, withPod)})
+	}
+	sortShares(report.Versions)
+	sortShares(report.Pods)
+	return report
+}
+
+func summaries(groups map[string]*stats) []Summary {
+	list := []Summary{}
+	for name, s := range groups {
+		list = append(list, s.summary(name))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+func sortShares(shares []Share) {
+	sort.Slice(shares, func(i, j int) bool {
+		if shares[i].Requests != shares[j].Requests {
+			return shares[i].Requests > shares[j].Requests
+		}
+		return shares[i].Name < shares[j].Name
+	})
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total) * 100
+}
+
+// writeJSON writes the report as an indented JSON document.
+func (r *Report) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// writeText writes the report as tables.
+func (r *Report) writeText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "%d requests in %.1fs, %.1f req/s\n\n", r.Total.Requests, r.DurationMs/1000, r.RPS)
+
+	fmt.Fprintln(tw, "\trequests\terrors\terror rate\tmean\tp50\tp90\tp95\tp99\tmax\t")
+	rows := append(append(append([]Summary{}, r.Endpoints...), r.Users...), r.Total)
+	for _, s := range rows {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.2f%%\t%.1fms\t%.1fms\t%.1fms\t%.1fms\t%.1fms\t%.1fms\t\n",
+			s.Name, s.Requests, s.Errors, s.ErrorRate*100, s.MeanMs, s.P50Ms, s.P90Ms, s.P95Ms, s.P99Ms, s.MaxMs)
+	}
+
+	statuses := make([]string, 0, len(r.Total.Statuses))
+	for status := range r.Total.Statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	fmt.Fprint(tw, "\nstatuses:")
+	for _, status := range statuses {
+		fmt.Fprintf(tw, " %s=%d", status, r.Total.Statuses[status])
+	}
+	fmt.Fprintln(tw)
+
+	if len(r.Versions) > 0 {
+		fmt.Fprintln(tw, "\nreviews version\trequests\tshare\t")
+		for _, v := range r.Versions {
+			fmt.Fprintf(tw, "%s\t%d\t%.1f%%\t\n", v.Name, v.Requests, v.Percent)
+		}
+	}
+	if len(r.Pods) > 0 {
+		fmt.Fprintln(tw, "\nreviews pod\tcluster\trequests\tshare\t")
+		for _, p := range r.Pods {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%.1f%%\t\n", p.Name, p.Cluster, p.Requests, p.Percent)
+		}
+	}
+	return tw.Flush()
+}
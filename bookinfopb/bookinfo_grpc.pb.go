@@ -0,0 +1,333 @@
+// Protocol buffer definitions for the bookinfo-go services, generated into the
+// bookinfopb module that they all share (see generate.sh).
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             (unknown)
+// source: bookinfo.proto
+
+package bookinfopb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	Details_GetDetails_FullMethodName = "/bookinfo.v1.Details/GetDetails"
+)
+
+// DetailsClient is the client API for Details service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type DetailsClient interface {
+	GetDetails(ctx context.Context, in *GetDetailsRequest, opts ...grpc.CallOption) (*BookDetails, error)
+}
+
+type detailsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDetailsClient(cc grpc.ClientConnInterface) DetailsClient {
+	return &detailsClient{cc}
+}
+
+func (c *detailsClient) GetDetails(ctx context.Context, in *GetDetailsRequest, opts ...grpc.CallOption) (*BookDetails, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BookDetails)
+	err := c.cc.Invoke(ctx, Details_GetDetails_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DetailsServer is the server API for Details service.
+// All implementations must embed UnimplementedDetailsServer
+// for forward compatibility
+type DetailsServer interface {
+	GetDetails(context.Context, *GetDetailsRequest) (*BookDetails, error)
+	mustEmbedUnimplementedDetailsServer()
+}
+
+// UnimplementedDetailsServer must be embedded to have forward compatible implementations.
+type UnimplementedDetailsServer struct {
+}
+
+func (UnimplementedDetailsServer) GetDetails(context.Context, *GetDetailsRequest) (*BookDetails, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDetails not implemented")
+}
+func (UnimplementedDetailsServer) mustEmbedUnimplementedDetailsServer() {}
+
+// UnsafeDetailsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to DetailsServer will
+// result in compilation errors.
+type UnsafeDetailsServer interface {
+	mustEmbedUnimplementedDetailsServer()
+}
+
+func RegisterDetailsServer(s grpc.ServiceRegistrar, srv DetailsServer) {
+	s.RegisterService(&Details_ServiceDesc, srv)
+}
+
+func _Details_GetDetails_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetDetailsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DetailsServer).GetDetails(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Details_GetDetails_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DetailsServer).GetDetails(ctx, req.(*GetDetailsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Details_ServiceDesc is the grpc.ServiceDesc for Details service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Details_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "bookinfo.v1.Details",
+	HandlerType: (*DetailsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetDetails",
+			Handler:    _Details_GetDetails_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "bookinfo.proto",
+}
+
+const (
+	Reviews_GetReviews_FullMethodName = "/bookinfo.v1.Reviews/GetReviews"
+)
+
+// ReviewsClient is the client API for Reviews service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ReviewsClient interface {
+	GetReviews(ctx context.Context, in *GetReviewsRequest, opts ...grpc.CallOption) (*GetReviewsResponse, error)
+}
+
+type reviewsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewReviewsClient(cc grpc.ClientConnInterface) ReviewsClient {
+	return &reviewsClient{cc}
+}
+
+func (c *reviewsClient) GetReviews(ctx context.Context, in *GetReviewsRequest, opts ...grpc.CallOption) (*GetReviewsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetReviewsResponse)
+	err := c.cc.Invoke(ctx, Reviews_GetReviews_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ReviewsServer is the server API for Reviews service.
+// All implementations must embed UnimplementedReviewsServer
+// for forward compatibility
+type ReviewsServer interface {
+	GetReviews(context.Context, *GetReviewsRequest) (*GetReviewsResponse, error)
+	mustEmbedUnimplementedReviewsServer()
+}
+
+// UnimplementedReviewsServer must be embedded to have forward compatible implementations.
+type UnimplementedReviewsServer struct {
+}
+
+func (UnimplementedReviewsServer) GetReviews(context.Context, *GetReviewsRequest) (*GetReviewsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetReviews not implemented")
+}
+func (UnimplementedReviewsServer) mustEmbedUnimplementedReviewsServer() {}
+
+// UnsafeReviewsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ReviewsServer will
+// result in compilation errors.
+type UnsafeReviewsServer interface {
+	mustEmbedUnimplementedReviewsServer()
+}
+
+func RegisterReviewsServer(s grpc.ServiceRegistrar, srv ReviewsServer) {
+	s.RegisterService(&Reviews_ServiceDesc, srv)
+}
+
+func _Reviews_GetReviews_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetReviewsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReviewsServer).GetReviews(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Reviews_GetReviews_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReviewsServer).GetReviews(ctx, req.(*GetReviewsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Reviews_ServiceDesc is the grpc.ServiceDesc for Reviews service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Reviews_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "bookinfo.v1.Reviews",
+	HandlerType: (*ReviewsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetReviews",
+			Handler:    _Reviews_GetReviews_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "bookinfo.proto",
+}
+
+const (
+	Ratings_GetRatings_FullMethodName  = "/bookinfo.v1.Ratings/GetRatings"
+	Ratings_PostRatings_FullMethodName = "/bookinfo.v1.Ratings/PostRatings"
+)
+
+// RatingsClient is the client API for Ratings service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type RatingsClient interface {
+	GetRatings(ctx context.Context, in *GetRatingsRequest, opts ...grpc.CallOption) (*ProductRatings, error)
+	PostRatings(ctx context.Context, in *PostRatingsRequest, opts ...grpc.CallOption) (*ProductRatings, error)
+}
+
+type ratingsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewRatingsClient(cc grpc.ClientConnInterface) RatingsClient {
+	return &ratingsClient{cc}
+}
+
+func (c *ratingsClient) GetRatings(ctx context.Context, in *GetRatingsRequest, opts ...grpc.CallOption) (*ProductRatings, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ProductRatings)
+	err := c.cc.Invoke(ctx, Ratings_GetRatings_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ratingsClient) PostRatings(ctx context.Context, in *PostRatingsRequest, opts ...grpc.CallOption) (*ProductRatings, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ProductRatings)
+	err := c.cc.Invoke(ctx, Ratings_PostRatings_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RatingsServer is the server API for Ratings service.
+// All implementations must embed UnimplementedRatingsServer
+// for forward compatibility
+type RatingsServer interface {
+	GetRatings(context.Context, *GetRatingsRequest) (*ProductRatings, error)
+	PostRatings(context.Context, *PostRatingsRequest) (*ProductRatings, error)
+	mustEmbedUnimplementedRatingsServer()
+}
+
+// UnimplementedRatingsServer must be embedded to have forward compatible implementations.
+type UnimplementedRatingsServer struct {
+}
+
+func (UnimplementedRatingsServer) GetRatings(context.Context, *GetRatingsRequest) (*ProductRatings, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRatings not implemented")
+}
+func (UnimplementedRatingsServer) PostRatings(context.Context, *PostRatingsRequest) (*ProductRatings, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PostRatings not implemented")
+}
+func (UnimplementedRatingsServer) mustEmbedUnimplementedRatingsServer() {}
+
+// UnsafeRatingsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to RatingsServer will
+// result in compilation errors.
+type UnsafeRatingsServer interface {
+	mustEmbedUnimplementedRatingsServer()
+}
+
+func RegisterRatingsServer(s grpc.ServiceRegistrar, srv RatingsServer) {
+	s.RegisterService(&Ratings_ServiceDesc, srv)
+}
+
+func _Ratings_GetRatings_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRatingsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RatingsServer).GetRatings(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Ratings_GetRatings_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RatingsServer).GetRatings(ctx, req.(*GetRatingsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ratings_PostRatings_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PostRatingsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RatingsServer).PostRatings(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Ratings_PostRatings_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RatingsServer).PostRatings(ctx, req.(*PostRatingsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Ratings_ServiceDesc is the grpc.ServiceDesc for Ratings service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Ratings_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "bookinfo.v1.Ratings",
+	HandlerType: (*RatingsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetRatings",
+			Handler:    _Ratings_GetRatings_Handler,
+		},
+		{
+			MethodName: "PostRatings",
+			Handler:    _Ratings_PostRatings_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "bookinfo.proto",
+}
@@ -0,0 +1,233 @@
+// Package bookstub serves a Google Books Volumes API from fixture files, so the
+// external book path of details can be used without internet access:
+//
+//	bookstub --port 9089 --latency 200ms --error-rate 0.1
+//	ENABLE_EXTERNAL_BOOK_SERVICE=true GOOGLE_BOOKS_URL=http://localhost:9089 details
+//
+// The API is served both at the root and under /books/v1, so GOOGLE_BOOKS_URL
+// may keep the path of the real service. Latency and errors are injected in
+// every API response, and can be changed at runtime with PUT /admin/faults.
+// The command is in cmd/bookstub.
+package bookstub
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// options are the command line arguments of bookstub.
+type options struct {
+	port     int
+	fixtures string
+	faults   Faults
+}
+
+func parseFlags(args []string) (options, error) {
+	var opts options
+	fs := flag.NewFlagSet("bookstub", flag.ContinueOnError)
+	fs.IntVar(&opts.port, "port", envInt("PORT", 9089), "HTTP port (env PORT)")
+	fs.StringVar(&opts.fixtures, "fixtures", os.Getenv("FIXTURES_DIR"), "directory of volume fixtures; the bundled books when empty (env FIXTURES_DIR)")
+	fs.DurationVar(&opts.faults.Latency, "latency", envDuration("LATENCY", 0), "delay added to every API response (env LATENCY)")
+	fs.DurationVar(&opts.faults.Jitter, "jitter", envDuration("LATENCY_JITTER", 0), "random extra delay up to this value (env LATENCY_JITTER)")
+	fs.Float64Var(&opts.faults.ErrorRate, "error-rate", envFloat("ERROR_RATE", 0), "fraction of API requests that fail, 0 to 1 (env ERROR_RATE)")
+	fs.IntVar(&opts.faults.ErrorStatus, "error-status", envInt("ERROR_STATUS", http.StatusServiceUnavailable), "status of the injected errors (env ERROR_STATUS)")
+	return opts, fs.Parse(args)
+}
+
+// Main runs bookstub with the command line arguments args.
+func Main(args []string) {
+	opts, err := parseFlags(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		os.Exit(2)
+	}
+	handler, err := newHandler(opts)
+	if err != nil {
+		log.Fatalf("Could not set up bookstub: %v", err)
+	}
+
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", opts.port),
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Printf("Bookstub started at %s", server.Addr)
+	log.Fatal(server.ListenAndServe())
+}
+
+// New sets bookstub up from args like Main, without listening, for the
+// caller to serve.
+func New(args []string) (http.Handler, error) {
+	opts, err := parseFlags(args)
+	if err != nil {
+		return nil, err
+	}
+	return newHandler(opts)
+}
+
+func newHandler(opts options) (http.Handler, error) {
+	if err := opts.faults.validate(); err != nil {
+		return nil, fmt.Errorf("invalid faults: %w", err)
+	}
+
+	var fsys fs.FS
+	if opts.fixtures != "" {
+		fsys = os.DirFS(opts.fixtures)
+	} else {
+		fsys, _ = fs.Sub(defaultFixtures, "fixtures")
+	}
+	library, err := loadLibrary(fsys)
+	if err != nil {
+		return nil, fmt.Errorf("loading fixtures: %w", err)
+	}
+	log.Printf("Serving %d volumes", len(library.volumes))
+
+	return logRequests(newMux(library, newFaultInjector(opts.faults))), nil
+}
+
+// newMux routes the Volumes API, behind fault injection, and the health and
+// admin endpoints, which are never delayed or failed.
+func newMux(library *Library, faults *faultInjector) *http.ServeMux {
+	api := http.NewServeMux()
+	api.HandleFunc("GET /volumes", library.searchHandler)
+	api.HandleFunc("GET /volumes/{id}", library.volumeHandler)
+	injected := faults.middleware(api)
+
+	mux := http.NewServeMux()
+	mux.Handle("/volumes", injected)
+	mux.Handle("/volumes/", injected)
+	mux.Handle("/books/v1/", http.StripPrefix("/books/v1", injected))
+	mux.HandleFunc("/admin/faults", faults.handler)
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "Bookstub is healthy"})
+	})
+	return mux
+}
+
+// searchHandler implements GET /volumes?q=...&startIndex=...&maxResults=...
+func (l *Library) searchHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := query.Get("q")
+	if q == "" {
+		writeAPIError(w, http.StatusBadRequest, "required", "Missing query.")
+		return
+	}
+	startIndex, err := queryInt(query.Get("startIndex"), 0, 0, 1<<30)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid", "Invalid value for startIndex: "+err.Error())
+		return
+	}
+	maxResults, err := queryInt(query.Get("maxResults"), 10, 0, 40)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid", "Invalid value for maxResults: "+err.Error())
+		return
+	}
+
+	found := l.search(q)
+	response := map[string]interface{}{"kind": "books#volumes", "totalItems": len(found)}
+	// Like the real API, items is left out when the page is empty.
+	if startIndex < len(found) {
+		page := found[startIndex:min(startIndex+maxResults, len(found))]
+		items := make([]json.RawMessage, len(page))
+		for i, volume := range page {
+			items[i] = volume.raw
+		}
+		if len(items) > 0 {
+			response["items"] = items
+		}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// volumeHandler implements GET /volumes/{id}.
+func (l *Library) volumeHandler(w http.ResponseWriter, r *http.Request) {
+	volume, exists := l.byID[r.PathValue("id")]
+	if !exists {
+		writeAPIError(w, http.StatusNotFound, "notFound", "The volume ID could not be found.")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Write(volume.raw)
+}
+
+func queryInt(value string, fallback, lowest, highest int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if n < lowest || n > highest {
+		return 0, fmt.Errorf("%d is not between %d and %d", n, lowest, highest)
+	}
+	return n, nil
+}
+
+// writeAPIError writes an error in the format of the Google APIs.
+func writeAPIError(w http.ResponseWriter, status int, reason, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    status,
+			"message": message,
+			"errors":  []map[string]string{{"message": message, "domain": "global", "reason": reason}},
+		},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// statusRecorder keeps the status written by a handler for the access log.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		log.Printf("%s %s %d %s", r.Method, r.URL.RequestURI(), recorder.status, time.Since(start).Round(time.Microsecond))
+	})
+}
+
+func envInt(key string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return fallback
+}
+
+func envFloat(key string, fallback float64) float64 {
+	if value, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return value
+	}
+	return fallback
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,176 @@
+package bookstub
+
+import (
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func bundledLibrary(t *testing.T) *Library {
+	t.Helper()
+	fsys, _ := fs.Sub(defaultFixtures, "fixtures")
+	library, err := loadLibrary(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return library
+}
+
+func newTestMux(t *testing.T, faults Faults) *http.ServeMux {
+	if faults.ErrorStatus == 0 {
+		faults.ErrorStatus = http.StatusServiceUnavailable
+	}
+	return newMux(bundledLibrary(t), newFaultInjector(faults))
+}
+
+type volumesResponse struct {
+	Kind       string `json:"kind"`
+	TotalItems int    `json:"totalItems"`
+	Items      []struct {
+		ID         string `json:"id"`
+		VolumeInfo struct {
+			Title string `json:"title"`
+		} `json:"volumeInfo"`
+	} `json:"items"`
+}
+
+func search(t *testing.T, mux http.Handler, target string) (int, volumesResponse) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	var response volumesResponse
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s: %v", target, err)
+		}
+	}
+	return w.Code, response
+}
+
+func TestSearch(t *testing.T) {
+	mux := newTestMux(t, Faults{})
+
+	tests := []struct {
+		target string
+		titles []string
+	}{
+		{"/volumes?q=isbn:0486424618", []string{"The Comedy of Errors"}},
+		{"/books/v1/volumes?q=isbn:978-0486424613", []string{"The Comedy of Errors"}},
+		{"/volumes?q=intitle:hamlet", []string{"Hamlet"}},
+		{"/volumes?q=shakespeare+intitle:romeo", []string{"Romeo and Juliet"}},
+		{"/volumes?q=inauthor:shakespeare&maxResults=2", []string{"The Comedy of Errors", "Hamlet"}},
+		{"/volumes?q=inauthor:shakespeare&startIndex=2", []string{"Romeo and Juliet"}},
+		{"/volumes?q=isbn:0000000000", nil},
+	}
+	for _, tt := range tests {
+		status, response := search(t, mux, tt.target)
+		if status != http.StatusOK {
+			t.Errorf("%s: status %d", tt.target, status)
+			continue
+		}
+		var titles []string
+		for _, item := range response.Items {
+			titles = append(titles, item.VolumeInfo.Title)
+		}
+		if strings.Join(titles, ",") != strings.Join(tt.titles, ",") {
+			t.Errorf("%s: titles = %v, want %v", tt.target, titles, tt.titles)
+		}
+	}
+
+	if status, _ := search(t, mux, "/volumes"); status != http.StatusBadRequest {
+		t.Errorf("search without q: status %d, want 400", status)
+	}
+	if status, _ := search(t, mux, "/volumes?q=hamlet&maxResults=41"); status != http.StatusBadRequest {
+		t.Errorf("maxResults=41: status %d, want 400", status)
+	}
+}
+
+func TestVolume(t *testing.T) {
+	mux := newTestMux(t, Faults{})
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/books/v1/volumes/stub-hamlet", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"title": "Hamlet"`) {
+		t.Errorf("status %d: %s", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/volumes/missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("missing volume: status %d, want 404", w.Code)
+	}
+}
+
+func TestLoadLibraryFormats(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a-single.json": {Data: []byte(`{"id": "one", "volumeInfo": {"title": "One"}}`)},
+		"b-list.json":   {Data: []byte(`[{"volumeInfo": {"title": "Two"}}, {"id": "three", "volumeInfo": {"title": "Three"}}]`)},
+		"c-search.json": {Data: []byte(`{"kind": "books#volumes", "totalItems": 1, "items": [{"id": "four", "volumeInfo": {"title": "Four"}}]}`)},
+		"notes.txt":     {Data: []byte("ignored")},
+	}
+	library, err := loadLibrary(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, volume := range library.volumes {
+		ids = append(ids, volume.ID)
+	}
+	if got := strings.Join(ids, ","); got != "one,b-list-0,three,four" {
+		t.Errorf("ids = %s", got)
+	}
+
+	fsys["d-duplicate.json"] = &fstest.MapFile{Data: []byte(`{"id": "one", "volumeInfo": {}}`)}
+	if _, err := loadLibrary(fsys); err == nil {
+		t.Error("duplicate id was accepted")
+	}
+}
+
+func TestInjectedFaults(t *testing.T) {
+	mux := newTestMux(t, Faults{ErrorRate: 1, ErrorStatus: http.StatusTooManyRequests})
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/volumes?q=hamlet", nil))
+	var body struct {
+		Error struct {
+			Code int `json:"code"`
+		} `json:"error"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusTooManyRequests || body.Error.Code != http.StatusTooManyRequests {
+		t.Errorf("status %d: %s", w.Code, w.Body)
+	}
+
+	// Health is never failed.
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("health: status %d", w.Code)
+	}
+
+	// Turn the errors off and add latency at runtime.
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/admin/faults", strings.NewReader(`{"errorRate": 0, "latency": "30ms"}`)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"latency":"30ms"`) || !strings.Contains(w.Body.String(), `"errorStatus":429`) {
+		t.Fatalf("PUT /admin/faults: status %d: %s", w.Code, w.Body)
+	}
+
+	start := time.Now()
+	if status, _ := search(t, mux, "/volumes?q=hamlet"); status != http.StatusOK {
+		t.Errorf("status %d after turning errors off", status)
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("response took %s, want at least 30ms", elapsed)
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/admin/faults", strings.NewReader(`{"errorRate": 2}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("errorRate 2: status %d, want 400", w.Code)
+	}
+}
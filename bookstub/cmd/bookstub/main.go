@@ -0,0 +1,12 @@
+// Command bookstub serves the Google Books stand-in; see the bookstub package.
+package main
+
+import (
+	"os"
+
+	"github.com/camilamedeir0s/bookinfo-go/bookstub"
+)
+
+func main() {
+	bookstub.Main(os.Args[1:])
+}
@@ -0,0 +1,154 @@
+package bookstub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Faults are injected into every API response: a delay of Latency plus up to
+// Jitter, and an error with ErrorStatus for a fraction ErrorRate of requests.
+type Faults struct {
+	Latency     time.Duration `json:"latency"`
+	Jitter      time.Duration `json:"jitter"`
+	ErrorRate   float64       `json:"errorRate"`
+	ErrorStatus int           `json:"errorStatus"`
+}
+
+func (f Faults) validate() error {
+	if f.Latency < 0 || f.Jitter < 0 {
+		return errors.New("latency and jitter must not be negative")
+	}
+	if f.ErrorRate < 0 || f.ErrorRate > 1 {
+		return errors.New("errorRate must be between 0 and 1")
+	}
+	if f.ErrorStatus < 400 || f.ErrorStatus > 599 {
+		return errors.New("errorStatus must be a 4xx or 5xx status")
+	}
+	return nil
+}
+
+// MarshalJSON writes the durations as strings such as "250ms".
+func (f Faults) MarshalJSON() ([]byte, error) {
+	return json.Marshal(faultsJSON{
+		Latency:     f.Latency.String(),
+		Jitter:      f.Jitter.String(),
+		ErrorRate:   &f.ErrorRate,
+		ErrorStatus: f.ErrorStatus,
+	})
+}
+
+// UnmarshalJSON accepts durations as strings. Fields that are left out keep
+// their current value, so a PUT can change a single fault.
+func (f *Faults) UnmarshalJSON(data []byte) error {
+	var j faultsJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	for _, d := range []struct {
+		value string
+		to    *time.Duration
+	}{{j.Latency, &f.Latency}, {j.Jitter, &f.Jitter}} {
+		if d.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(d.value)
+		if err != nil {
+			return err
+		}
+		*d.to = parsed
+	}
+	if j.ErrorRate != nil {
+		f.ErrorRate = *j.ErrorRate
+	}
+	if j.ErrorStatus != 0 {
+		f.ErrorStatus = j.ErrorStatus
+	}
+	return nil
+}
+
+type faultsJSON struct {
+	Latency     string   `json:"latency,omitempty"`
+	Jitter      string   `json:"jitter,omitempty"`
+	ErrorRate   *float64 `json:"errorRate"`
+	ErrorStatus int      `json:"errorStatus,omitempty"`
+}
+
+// faultInjector applies the current faults. They can be changed at runtime
+// through /admin/faults.
+type faultInjector struct {
+	mu     sync.Mutex
+	faults Faults
+	rand   *rand.Rand
+}
+
+func newFaultInjector(faults Faults) *faultInjector {
+	return &faultInjector{faults: faults, rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+func (i *faultInjector) current() Faults {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.faults
+}
+
+// roll decides the delay and whether the request fails.
+func (i *faultInjector) roll() (time.Duration, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	delay := i.faults.Latency
+	if i.faults.Jitter > 0 {
+		delay += time.Duration(i.rand.Int63n(int64(i.faults.Jitter) + 1))
+	}
+	return delay, i.rand.Float64() < i.faults.ErrorRate
+}
+
+// middleware delays the request and may replace the response with an error
+// in the Google API error format.
+func (i *faultInjector) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delay, fail := i.roll()
+		if delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if fail {
+			status := i.current().ErrorStatus
+			writeAPIError(w, status, "backendError", fmt.Sprintf("injected error: %s", http.StatusText(status)))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handler serves GET and PUT /admin/faults.
+func (i *faultInjector) handler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		faults := i.current()
+		if err := json.NewDecoder(r.Body).Decode(&faults); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "parseError", err.Error())
+			return
+		}
+		if err := faults.validate(); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid", err.Error())
+			return
+		}
+		i.mu.Lock()
+		i.faults = faults
+		i.mu.Unlock()
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		writeAPIError(w, http.StatusMethodNotAllowed, "methodNotAllowed", "use GET or PUT")
+		return
+	}
+	writeJSON(w, http.StatusOK, i.current())
+}
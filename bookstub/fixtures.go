@@ -0,0 +1,165 @@
+package bookstub
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// defaultFixtures are the books served when no fixtures directory is given.
+//
+//go:embed fixtures/*.json
+var defaultFixtures embed.FS
+
+// Volume is a Google Books volume resource. Only the fields used for search
+// are decoded; the raw JSON is served as is.
+type Volume struct {
+	ID         string
+	VolumeInfo struct {
+		Title               string   `json:"title"`
+		Authors             []string `json:"authors"`
+		Publisher           string   `json:"publisher"`
+		Categories          []string `json:"categories"`
+		IndustryIdentifiers []struct {
+			Type       string `json:"type"`
+			Identifier string `json:"identifier"`
+		} `json:"industryIdentifiers"`
+	}
+	raw json.RawMessage
+}
+
+// Library holds the fixture volumes in file order.
+type Library struct {
+	volumes []*Volume
+	byID    map[string]*Volume
+}
+
+// loadLibrary reads every .json file of fsys. A file holds a single volume, an
+// array of volumes, or a saved volumes search response with "items", so real
+// API responses can be dropped in as fixtures.
+func loadLibrary(fsys fs.FS) (*Library, error) {
+	names, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	library := &Library{byID: map[string]*Volume{}}
+	for _, name := range names {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		raws, err := splitFixture(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		for i, raw := range raws {
+			volume := &Volume{raw: raw}
+			var fields struct {
+				ID         string          `json:"id"`
+				VolumeInfo json.RawMessage `json:"volumeInfo"`
+			}
+			if err := json.Unmarshal(raw, &fields); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			if fields.VolumeInfo == nil {
+				return nil, fmt.Errorf("%s: volume %d has no volumeInfo", name, i)
+			}
+			if err := json.Unmarshal(fields.VolumeInfo, &volume.VolumeInfo); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			volume.ID = fields.ID
+			if volume.ID == "" {
+				volume.ID = fmt.Sprintf("%s-%d", strings.TrimSuffix(path.Base(name), ".json"), i)
+			}
+			if _, exists := library.byID[volume.ID]; exists {
+				return nil, fmt.Errorf("%s: duplicate volume id %q", name, volume.ID)
+			}
+			library.byID[volume.ID] = volume
+			library.volumes = append(library.volumes, volume)
+		}
+	}
+	return library, nil
+}
+
+func splitFixture(data []byte) ([]json.RawMessage, error) {
+	var list []json.RawMessage
+	if json.Unmarshal(data, &list) == nil {
+		return list, nil
+	}
+	var object struct {
+		Kind  string            `json:"kind"`
+		Items []json.RawMessage `json:"items"`
+	}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+	if object.Kind == "books#volumes" || object.Items != nil {
+		return object.Items, nil
+	}
+	return []json.RawMessage{data}, nil
+}
+
+// search returns the volumes matching every term of q, which uses the Google
+// Books syntax: free words plus isbn:, intitle:, inauthor:, inpublisher: and
+// subject: keywords.
+func (l *Library) search(q string) []*Volume {
+	terms := strings.Fields(strings.ToLower(q))
+	var found []*Volume
+	for _, volume := range l.volumes {
+		matches := true
+		for _, term := range terms {
+			if !volume.matches(term) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			found = append(found, volume)
+		}
+	}
+	return found
+}
+
+func (v *Volume) matches(term string) bool {
+	info := v.VolumeInfo
+	key, value, hasKey := strings.Cut(term, ":")
+	if !hasKey {
+		return v.matches("intitle:"+term) || v.matches("inauthor:"+term)
+	}
+	value = strings.Trim(value, `"`)
+
+	switch key {
+	case "isbn":
+		value = strings.ReplaceAll(value, "-", "")
+		for _, id := range info.IndustryIdentifiers {
+			if strings.HasPrefix(id.Type, "ISBN") && id.Identifier == value {
+				return true
+			}
+		}
+		return false
+	case "intitle":
+		return strings.Contains(strings.ToLower(info.Title), value)
+	case "inauthor":
+		return containsAny(info.Authors, value)
+	case "inpublisher":
+		return strings.Contains(strings.ToLower(info.Publisher), value)
+	case "subject":
+		return containsAny(info.Categories, value)
+	}
+	return false
+}
+
+func containsAny(values []string, substr string) bool {
+	for _, value := range values {
+		if strings.Contains(strings.ToLower(value), substr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,3 @@
+module github.com/camilamedeir0s/bookinfo-go/bookstub
+
+go 1.22.4
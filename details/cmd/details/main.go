@@ -0,0 +1,12 @@
+// Command details serves the details service; see the details package.
+package main
+
+import (
+	"os"
+
+	"github.com/camilamedeir0s/bookinfo-go/details"
+)
+
+func main() {
+	details.Main(os.Args[1:])
+}
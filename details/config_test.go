@@ -0,0 +1,102 @@
+package details
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useConfig replaces the service configuration for the duration of a test.
+func useConfig(t *testing.T, change func(*Config)) {
+	t.Helper()
+	previous := config
+	config = defaultConfig()
+	change(&config)
+	t.Cleanup(func() { config = previous })
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "details.yaml")
+	file := "port: 7000\ngrpcPort: 7001\ndrainPeriod: 1s\nopenapiValidation: strict\n"
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("GRPC_PORT", "7101")
+	t.Setenv("OPENAPI_VALIDATION", "off")
+
+	cfg, err := loadConfig([]string{"--openapi-validation=warn", "--external-book-service"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Port != 7000 || cfg.DrainPeriod != time.Second {
+		t.Errorf("file settings not applied: port %d, drainPeriod %s", cfg.Port, cfg.DrainPeriod)
+	}
+	if cfg.GRPCPort != 7101 {
+		t.Errorf("env should override the file: got grpcPort %d", cfg.GRPCPort)
+	}
+	if cfg.OpenAPIValidation != "warn" || !cfg.ExternalBookService {
+		t.Errorf("flags should override env: got %q, %v", cfg.OpenAPIValidation, cfg.ExternalBookService)
+	}
+	if cfg.ShutdownTimeout != 15*time.Second {
+		t.Errorf("defaults should remain: got shutdownTimeout %s", cfg.ShutdownTimeout)
+	}
+
+	cfg, err = loadConfig([]string{"9999"})
+	if err != nil || cfg.Port != 9999 {
+		t.Errorf("positional port: got %d, %v", cfg.Port, err)
+	}
+}
+
+func TestLoadConfigValidation(t *testing.T) {
+	for _, args := range [][]string{
+		{"--port=0"},
+		{"--port=9094"},
+		{"--openapi-validation=loud"},
+		{"--rate-limits=*=fast"},
+		{"--trusted-proxies=10.0.0.0/8,proxy.local"},
+		{"--google-books-rate-limit=1/d"},
+		{"--drain-period=soon"},
+	} {
+		if _, err := loadConfig(args); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "details.yaml")
+	os.WriteFile(path, []byte("prot: 7000\n"), 0o600)
+	if _, err := loadConfig([]string{"--config", path}); err == nil {
+		t.Error("unknown keys in the file should be rejected")
+	}
+}
+
+func TestPrintConfigRoundTrip(t *testing.T) {
+	cfg, err := loadConfig([]string{"--port=7000", "--drain-period=2s", "--trusted-proxies=10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := printConfig(&out, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "drainPeriod: 2s") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+
+	path := filepath.Join(t.TempDir(), "printed.yaml")
+	os.WriteFile(path, out.Bytes(), 0o600)
+	loaded, err := loadConfig([]string{"--config", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded.ConfigFile = ""
+	if !reflect.DeepEqual(loaded, cfg) {
+		t.Errorf("printed config does not load back:\n%+v\n%+v", loaded, cfg)
+	}
+}
@@ -1,14 +1,24 @@
-package main
+// Package details is the details service of bookinfo, which describes the
+// books of the catalog. The command is in cmd/details.
+package details
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/camilamedeir0s/bookinfo-go/ratelimit"
 	"github.com/gin-gonic/gin"
+	"golang.org/x/text/language"
 )
 
 type BookDetails struct {
@@ -23,21 +33,81 @@ type BookDetails struct {
 	ISBN13    string `json:"ISBN-13"`
 }
 
-func main() {
-	// if len(os.Args) < 2 {
-	// 	fmt.Println("Usage: go run main.go <port>")
-	// 	os.Exit(1)
-	// }
+// Main runs the details service with the command line arguments args until
+// SIGINT or SIGTERM.
+func Main(args []string) {
+	var err error
+	config, err = loadConfig(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+	if config.PrintConfig {
+		printConfig(os.Stdout, config)
+		return
+	}
+
+	server, err := setup()
+	if err != nil {
+		log.Fatal("Could not set up router: ", err)
+	}
+
+	serveGRPC(config.GRPCPort, server)
+
+	serve(fmt.Sprintf(":%d", config.Port), server.Handler, server.cleanup...)
+}
 
-	port := "9084"
+// New loads the configuration from args like Main and sets the service up
+// without listening, for the caller to serve.
+func New(args []string) (*Server, error) {
+	var err error
+	if config, err = loadConfig(args); err != nil {
+		return nil, err
+	}
+	return setup()
+}
 
-	if len(os.Args) > 1 {
-		port = os.Args[1]
+// setup builds the router and the gRPC server for the loaded configuration.
+func setup() (*Server, error) {
+	r, err := setupRouter()
+	if err != nil {
+		return nil, err
 	}
+
+	booksLimiter = newBooksLimiter()
+
+	grpcServer := newGRPCServer()
+	return &Server{Handler: r, grpc: grpcServer, cleanup: []func(context.Context){stopGRPC(grpcServer)}}, nil
+}
+
+// setupRouter registers the HTTP API behind the OpenAPI validation middleware.
+func setupRouter() (*gin.Engine, error) {
+	_, spec, err := loadOpenAPI()
+	if err != nil {
+		return nil, err
+	}
+
 	r := gin.Default()
+	// Without trusted proxies gin ignores X-Forwarded-For and the client IP
+	// is the peer address
+	if err := r.SetTrustedProxies(config.TrustedProxies); err != nil {
+		return nil, err
+	}
+	if limiter := rateLimitMiddleware(); limiter != nil {
+		r.Use(limiter)
+	}
+	r.Use(openAPIValidator(spec, config.OpenAPIValidation))
+
+	r.GET("/openapi.json", openAPIHandler)
 
 	r.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "Details is healthy"})
+		if draining.Load() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "Details is shutting down", "version": config.ServiceVersion})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "Details is healthy", "version": config.ServiceVersion})
 	})
 
 	r.GET("/details/:id", func(c *gin.Context) {
@@ -48,7 +118,17 @@ func main() {
 		}
 
 		headers := getForwardHeaders(c.Request)
-		details, err := getBookDetails(id, headers)
+		details, err := getBookDetails(id, headers, displayLanguage(c.GetHeader("Accept-Language")))
+		var quota *quotaError
+		if errors.As(err, &quota) {
+			c.Header("Retry-After", ratelimit.RetryAfter(quota.retryAfter))
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, errUnknownProduct) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -57,13 +137,30 @@ func main() {
 		c.JSON(http.StatusOK, details)
 	})
 
-	r.Run(":" + port)
+	return r, nil
+}
+
+// productISBNs maps the ids of the productpage catalog to the edition looked
+// up in the external book service.
+var productISBNs = map[int]string{
+	0: "0486424618", // The Comedy of Errors
+	1: "0486272788", // Hamlet
+	4: "0486275574", // Romeo and Juliet
 }
 
-func getBookDetails(id int, headers map[string]string) (BookDetails, error) {
-	if os.Getenv("ENABLE_EXTERNAL_BOOK_SERVICE") == "true" {
-		isbn := "0486424618"
-		return fetchDetailsFromExternalService(isbn, id, headers)
+// errUnknownProduct is returned when the external book service is enabled and
+// the product has no ISBN to look up.
+var errUnknownProduct = errors.New("product not found")
+
+// getBookDetails returns the details of the book, with its language named in
+// lang.
+func getBookDetails(id int, headers map[string]string, lang language.Tag) (BookDetails, error) {
+	if config.ExternalBookService {
+		isbn, ok := productISBNs[id]
+		if !ok {
+			return BookDetails{}, errUnknownProduct
+		}
+		return fetchDetailsFromExternalService(isbn, id, headers, lang)
 	}
 
 	return BookDetails{
@@ -73,15 +170,78 @@ func getBookDetails(id int, headers map[string]string) (BookDetails, error) {
 		Type:      "paperback",
 		Pages:     200,
 		Publisher: "PublisherA",
-		Language:  "English",
+		Language:  languageName("en", lang),
 		ISBN10:    "1234567890",
 		ISBN13:    "123-1234567890",
 	}, nil
 }
 
-func fetchDetailsFromExternalService(isbn string, id int, headers map[string]string) (BookDetails, error) {
+// booksLimiter paces the calls to Google Books so details stays within the
+// provider quota. It is nil when GOOGLE_BOOKS_RATE_LIMIT is not set.
+var booksLimiter *outboundLimiter
+
+// outboundLimiter is a token bucket shared by all outgoing calls. Callers
+// wait for their turn, unless the wait would be longer than maxWait.
+type outboundLimiter struct {
+	rule    ratelimit.Rule
+	maxWait time.Duration
+	mu      sync.Mutex
+	bucket  ratelimit.Bucket
+}
+
+// quotaError is returned instead of calling the provider when the outbound
+// limiter is exhausted.
+type quotaError struct {
+	retryAfter time.Duration
+}
+
+func (e *quotaError) Error() string {
+	return "external book service quota exceeded"
+}
+
+// newBooksLimiter builds the limiter from googleBooksRateLimit, written in the
+// rateLimits rule syntax (e.g. "1/s,burst=5"). The rule was checked when the
+// configuration was loaded.
+func newBooksLimiter() *outboundLimiter {
+	if config.GoogleBooksRateLimit == "" {
+		return nil
+	}
+	rule, _ := ratelimit.ParseRule(config.GoogleBooksRateLimit)
+
+	return &outboundLimiter{
+		rule:    rule,
+		maxWait: config.GoogleBooksMaxWait,
+		bucket:  ratelimit.Bucket{Tokens: rule.Burst, Last: time.Now()},
+	}
+}
+
+// Wait blocks until a call may be made.
+func (l *outboundLimiter) Wait() error {
+	l.mu.Lock()
+	l.bucket.Refill(l.rule, time.Now())
+	wait := l.bucket.Wait(l.rule)
+	if wait > l.maxWait {
+		l.mu.Unlock()
+		return &quotaError{retryAfter: wait}
+	}
+	// Reserve the token before sleeping, so concurrent callers queue up
+	// behind this one instead of all waking up at once.
+	l.bucket.Tokens--
+	l.mu.Unlock()
+
+	time.Sleep(wait)
+	return nil
+}
+
+func fetchDetailsFromExternalService(isbn string, id int, headers map[string]string, lang language.Tag) (BookDetails, error) {
+	if booksLimiter != nil {
+		if err := booksLimiter.Wait(); err != nil {
+			return BookDetails{}, err
+		}
+	}
+
 	client := &http.Client{Timeout: 5 * time.Second}
-	url := "https://www.googleapis.com/books/v1/volumes?q=isbn:" + isbn
+	url := strings.TrimSuffix(config.GoogleBooksURL, "/") + "/volumes?q=isbn:" + isbn
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -98,55 +258,73 @@ func fetchDetailsFromExternalService(isbn string, id int, headers map[string]str
 	}
 	defer resp.Body.Close()
 
-	var result map[string]interface{}
+	if resp.StatusCode != http.StatusOK {
+		return BookDetails{}, fmt.Errorf("external book service returned status %d", resp.StatusCode)
+	}
+
+	var result volumesResponse
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return BookDetails{}, err
 	}
-
-	book := result["items"].([]interface{})[0].(map[string]interface{})["volumeInfo"].(map[string]interface{})
-
-	language := book["language"].(string)
-	if language == "en" {
-		language = "English"
-	} else {
-		language = "unknown"
+	if len(result.Items) == 0 {
+		return BookDetails{}, fmt.Errorf("external book service found no book with ISBN %s", isbn)
 	}
+	book := result.Items[0].VolumeInfo
 
-	bookType := book["printType"].(string)
-	if bookType == "BOOK" {
-		bookType = "paperback"
-	} else {
-		bookType = "unknown"
+	if len(book.Authors) == 0 {
+		return BookDetails{}, fmt.Errorf("external book service returned no author for ISBN %s", isbn)
 	}
-
-	isbn10 := getISBN(book, "ISBN_10")
-	isbn13 := getISBN(book, "ISBN_13")
-
-	yearStr := book["publishedDate"].(string)
-	year, err := strconv.Atoi(yearStr[:4])
+	if len(book.PublishedDate) < 4 {
+		return BookDetails{}, fmt.Errorf("external book service returned publishedDate %q for ISBN %s", book.PublishedDate, isbn)
+	}
+	year, err := strconv.Atoi(book.PublishedDate[:4])
 	if err != nil {
-		log.Printf("Failed to extract year: %v", err)
-		year = 0
+		return BookDetails{}, fmt.Errorf("external book service returned publishedDate %q for ISBN %s", book.PublishedDate, isbn)
+	}
+
+	bookType := "unknown"
+	if book.PrintType == "BOOK" {
+		bookType = "paperback"
 	}
 
 	return BookDetails{
 		ID:        id,
-		Author:    book["authors"].([]interface{})[0].(string),
+		Author:    book.Authors[0],
 		Year:      year,
 		Type:      bookType,
-		Pages:     int(book["pageCount"].(float64)),
-		Publisher: book["publisher"].(string),
-		Language:  language,
-		ISBN10:    isbn10,
-		ISBN13:    isbn13,
+		Pages:     book.PageCount,
+		Publisher: book.Publisher,
+		Language:  languageName(book.Language, lang),
+		ISBN10:    book.isbn("ISBN_10"),
+		ISBN13:    book.isbn("ISBN_13"),
 	}, nil
 }
 
-func getISBN(book map[string]interface{}, isbnType string) string {
-	for _, identifier := range book["industryIdentifiers"].([]interface{}) {
-		id := identifier.(map[string]interface{})
-		if id["type"] == isbnType {
-			return id["identifier"].(string)
+// volumesResponse is the part of a Google Books volumes search that details
+// reads.
+type volumesResponse struct {
+	Items []struct {
+		VolumeInfo volumeInfo `json:"volumeInfo"`
+	} `json:"items"`
+}
+
+type volumeInfo struct {
+	Authors             []string `json:"authors"`
+	Publisher           string   `json:"publisher"`
+	PublishedDate       string   `json:"publishedDate"`
+	PrintType           string   `json:"printType"`
+	PageCount           int      `json:"pageCount"`
+	Language            string   `json:"language"`
+	IndustryIdentifiers []struct {
+		Type       string `json:"type"`
+		Identifier string `json:"identifier"`
+	} `json:"industryIdentifiers"`
+}
+
+func (v volumeInfo) isbn(isbnType string) string {
+	for _, id := range v.IndustryIdentifiers {
+		if id.Type == isbnType {
+			return id.Identifier
 		}
 	}
 	return ""
@@ -154,12 +332,6 @@ func getISBN(book map[string]interface{}, isbnType string) string {
 
 func getForwardHeaders(req *http.Request) map[string]string {
 	headers := make(map[string]string)
-	incomingHeaders := []string{
-		"x-request-id", "x-ot-span-context", "x-datadog-trace-id", "x-datadog-parent-id",
-		"x-datadog-sampling-priority", "traceparent", "tracestate", "x-cloud-trace-context",
-		"grpc-trace-bin", "x-b3-traceid", "x-b3-spanid", "x-b3-parentspanid", "x-b3-sampled",
-		"x-b3-flags", "sw8", "end-user", "user-agent", "cookie", "authorization", "jwt",
-	}
 
 	for _, header := range incomingHeaders {
 		if val := req.Header.Get(header); val != "" {
@@ -169,3 +341,10 @@ func getForwardHeaders(req *http.Request) map[string]string {
 
 	return headers
 }
+
+var incomingHeaders = []string{
+	"x-request-id", "x-ot-span-context", "x-datadog-trace-id", "x-datadog-parent-id",
+	"x-datadog-sampling-priority", "traceparent", "tracestate", "x-cloud-trace-context",
+	"grpc-trace-bin", "x-b3-traceid", "x-b3-spanid", "x-b3-parentspanid", "x-b3-sampled",
+	"x-b3-flags", "sw8", "end-user", "user-agent", "cookie", "authorization", "jwt",
+}
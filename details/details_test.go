@@ -0,0 +1,95 @@
+package details
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/language"
+)
+
+// useGoogleBooks points details at a fake Google Books that answers every
+// volumes search with body.
+func useGoogleBooks(t *testing.T, body string) *[]string {
+	t.Helper()
+	var queries []string
+	books := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query().Get("q"))
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(books.Close)
+	useConfig(t, func(c *Config) {
+		c.ExternalBookService = true
+		c.GoogleBooksURL = books.URL
+	})
+	return &queries
+}
+
+func TestFetchDetailsFromExternalService(t *testing.T) {
+	queries := useGoogleBooks(t, `{"items":[{"volumeInfo":{
+		"authors":["William Shakespeare"],"publisher":"Courier Corporation","publishedDate":"1996-01-01",
+		"printType":"BOOK","pageCount":96,"language":"en",
+		"industryIdentifiers":[{"type":"ISBN_13","identifier":"9780486272788"},{"type":"ISBN_10","identifier":"0486272788"}]}}]}`)
+
+	details, err := getBookDetails(1, nil, language.English)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := BookDetails{ID: 1, Author: "William Shakespeare", Year: 1996, Type: "paperback", Pages: 96,
+		Publisher: "Courier Corporation", Language: "English", ISBN10: "0486272788", ISBN13: "9780486272788"}
+	if details != want {
+		t.Errorf("got %+v, want %+v", details, want)
+	}
+	if len(*queries) != 1 || (*queries)[0] != "isbn:0486272788" {
+		t.Errorf("got queries %q, want the ISBN of product 1", *queries)
+	}
+}
+
+func TestFetchDetailsRejectsIncompleteVolumes(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"no items", `{"totalItems":0}`, "no book"},
+		{"no authors", `{"items":[{"volumeInfo":{"publishedDate":"1996"}}]}`, "no author"},
+		{"no published date", `{"items":[{"volumeInfo":{"authors":["A"]}}]}`, "publishedDate"},
+		{"short published date", `{"items":[{"volumeInfo":{"authors":["A"],"publishedDate":"96"}}]}`, "publishedDate"},
+		{"non-numeric year", `{"items":[{"volumeInfo":{"authors":["A"],"publishedDate":"circa 1600"}}]}`, "publishedDate"},
+		{"wrong type", `{"items":[{"volumeInfo":{"authors":"A"}}]}`, "cannot unmarshal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useGoogleBooks(t, tt.body)
+			if _, err := getBookDetails(0, nil, language.English); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want one mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExternalDetailsOfUnknownProduct(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	queries := useGoogleBooks(t, `{}`)
+
+	if _, err := getBookDetails(99, nil, language.English); !errors.Is(err, errUnknownProduct) {
+		t.Errorf("got error %v, want errUnknownProduct", err)
+	}
+
+	r, err := setupRouter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/details/99", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("got status %d, want 404", rec.Code)
+	}
+	if len(*queries) != 0 {
+		t.Errorf("got queries %q for a product without an ISBN", *queries)
+	}
+}
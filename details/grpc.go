@@ -0,0 +1,107 @@
+package details
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/camilamedeir0s/bookinfo-go/bookinfopb"
+)
+
+type detailsServer struct {
+	bookinfopb.UnimplementedDetailsServer
+}
+
+func (detailsServer) GetDetails(ctx context.Context, req *bookinfopb.GetDetailsRequest) (*bookinfopb.BookDetails, error) {
+	var acceptLanguage string
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get("accept-language")) > 0 {
+		acceptLanguage = md.Get("accept-language")[0]
+	}
+	details, err := getBookDetails(int(req.GetProductId()), getGRPCForwardHeaders(ctx), displayLanguage(acceptLanguage))
+	var quota *quotaError
+	if errors.As(err, &quota) {
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
+	if errors.Is(err, errUnknownProduct) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &bookinfopb.BookDetails{
+		Id:        int32(details.ID),
+		Author:    details.Author,
+		Year:      int32(details.Year),
+		Type:      details.Type,
+		Pages:     int32(details.Pages),
+		Publisher: details.Publisher,
+		Language:  details.Language,
+		Isbn_10:   details.ISBN10,
+		Isbn_13:   details.ISBN13,
+	}, nil
+}
+
+// newGRPCServer registers the gRPC API, which is served next to the HTTP one.
+func newGRPCServer() *grpc.Server {
+	server := grpc.NewServer()
+	bookinfopb.RegisterDetailsServer(server, detailsServer{})
+	return server
+}
+
+// serveGRPC starts serving the gRPC API of server on port.
+func serveGRPC(port int, server *Server) {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		log.Fatalf("Could not listen on gRPC port %d: %v", port, err)
+	}
+
+	go func() {
+		log.Printf("gRPC server started at :%d", port)
+		if err := server.ServeGRPC(lis); err != nil {
+			log.Fatal(err)
+		}
+	}()
+}
+
+// stopGRPC lets in-flight RPCs finish, closing the server outright if ctx
+// expires first.
+func stopGRPC(server *grpc.Server) func(context.Context) {
+	return func(ctx context.Context) {
+		done := make(chan struct{})
+		go func() {
+			server.GracefulStop()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			server.Stop()
+		}
+	}
+}
+
+// getGRPCForwardHeaders is the gRPC counterpart of getForwardHeaders, reading
+// the tracing headers from the incoming metadata.
+func getGRPCForwardHeaders(ctx context.Context) map[string]string {
+	headers := make(map[string]string)
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return headers
+	}
+
+	for _, header := range incomingHeaders {
+		if values := md.Get(header); len(values) > 0 {
+			headers[header] = values[0]
+		}
+	}
+
+	return headers
+}
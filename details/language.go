@@ -0,0 +1,45 @@
+package details
+
+import (
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+// The languages display has names in.
+var (
+	displayTags     = display.Supported.Tags()
+	languageMatcher = language.NewMatcher(displayTags)
+)
+
+// displayLanguage picks the language book languages are named in from an
+// Accept-Language value, falling back to English when it names none that is
+// supported.
+func displayLanguage(acceptLanguage string) language.Tag {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return language.English
+	}
+	_, index, confidence := languageMatcher.Match(tags...)
+	if confidence == language.No {
+		return language.English
+	}
+	return displayTags[index]
+}
+
+// languageName names the book language code, an ISO 639 code such as "en"
+// or "fra" optionally followed by a region, in the display language. Codes
+// that are not a known language are "unknown".
+func languageName(code string, in language.Tag) string {
+	tag, err := language.Parse(code)
+	if err != nil || tag == language.Und {
+		return "unknown"
+	}
+	namer := display.Languages(in)
+	if namer == nil {
+		namer = display.English.Languages()
+	}
+	if name := namer.Name(tag); name != "" {
+		return name
+	}
+	return "unknown"
+}
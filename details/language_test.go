@@ -0,0 +1,46 @@
+package details
+
+import (
+	"testing"
+
+	"golang.org/x/text/language"
+)
+
+func TestDisplayLanguage(t *testing.T) {
+	tests := map[string]string{
+		"":                        "en",
+		"pt-BR,pt;q=0.9,en;q=0.8": "pt",
+		"es-MX":                   "es-MX",
+		"de;q=0.2,fr;q=0.8":       "fr",
+		"tlh":                     "en",
+		"not a list;;":            "en",
+	}
+	for acceptLanguage, want := range tests {
+		if got := displayLanguage(acceptLanguage); got.String() != want {
+			t.Errorf("displayLanguage(%q) = %s, want %s", acceptLanguage, got, want)
+		}
+	}
+}
+
+func TestLanguageName(t *testing.T) {
+	tests := []struct {
+		code string
+		in   string
+		want string
+	}{
+		{"en", "en", "English"},
+		{"fr", "en", "French"},
+		{"fra", "en", "French"},
+		{"pt-BR", "en", "Brazilian Portuguese"},
+		{"en", "pt-BR", "inglês"},
+		{"de", "es", "alemán"},
+		{"und", "en", "unknown"},
+		{"", "en", "unknown"},
+		{"not-a-language", "en", "unknown"},
+	}
+	for _, tt := range tests {
+		if got := languageName(tt.code, language.MustParse(tt.in)); got != tt.want {
+			t.Errorf("languageName(%q, %s) = %q, want %q", tt.code, tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package details
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/gin-gonic/gin"
+)
+
+func TestHandlersConformToOpenAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	useConfig(t, func(c *Config) { c.OpenAPIValidation = "off" })
+
+	doc, specRouter, err := loadOpenAPI()
+	if err != nil {
+		t.Fatalf("loading spec: %v", err)
+	}
+	r, err := setupRouter()
+	if err != nil {
+		t.Fatalf("setting up router: %v", err)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{"GET", "/health", http.StatusOK},
+		{"GET", "/details/1", http.StatusOK},
+		{"GET", "/details/abc", http.StatusBadRequest},
+		{"GET", "/openapi.json", http.StatusOK},
+	}
+
+	covered := map[string]bool{}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		if rec.Code != tt.status {
+			t.Errorf("%s %s: got status %d, want %d", tt.method, tt.path, rec.Code, tt.status)
+		}
+		covered[assertConforms(t, specRouter, req, rec)] = true
+	}
+
+	for _, path := range doc.Paths.InMatchingOrder() {
+		for _, op := range doc.Paths.Value(path).Operations() {
+			if !covered[op.OperationID] {
+				t.Errorf("operation %s is not covered by the contract test", op.OperationID)
+			}
+		}
+	}
+}
+
+// assertConforms validates a recorded response against the spec and returns
+// the id of the matched operation.
+func assertConforms(t *testing.T, specRouter routers.Router, req *http.Request, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+
+	route, pathParams, err := specRouter.FindRoute(req)
+	if err != nil {
+		t.Errorf("%s %s: no operation in spec: %v", req.Method, req.URL.Path, err)
+		return ""
+	}
+
+	err = openapi3filter.ValidateResponse(req.Context(), &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: &openapi3filter.RequestValidationInput{Request: req, PathParams: pathParams, Route: route},
+		Status:                 rec.Code,
+		Header:                 rec.Header(),
+		Body:                   io.NopCloser(bytes.NewReader(rec.Body.Bytes())),
+		Options:                &openapi3filter.Options{IncludeResponseStatus: true},
+	})
+	if err != nil {
+		t.Errorf("%s %s: response does not conform: %v", req.Method, req.URL.Path, err)
+	}
+	return route.Operation.OperationID
+}
+
+func TestOpenAPIValidatorModes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, specRouter, err := loadOpenAPI()
+	if err != nil {
+		t.Fatalf("loading spec: %v", err)
+	}
+
+	tests := []struct {
+		mode    string
+		path    string
+		status  int
+		handled bool
+		body    string
+	}{
+		// The health response lacks its required status
+		{"off", "/health", http.StatusOK, true, `{"version":"v1"}`},
+		{"warn", "/health", http.StatusOK, true, `{"version":"v1"}`},
+		{"strict", "/health", http.StatusInternalServerError, true, `{"error":"response does not conform to the API specification"}`},
+		// The id is not a number
+		{"warn", "/details/abc", http.StatusOK, true, `{"version":"v1"}`},
+		{"strict", "/details/abc", http.StatusBadRequest, false, ""},
+		{"strict", "/openapi.json", http.StatusOK, true, string(openAPISpec)},
+		{"strict", "/unknown", http.StatusNotFound, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode+" "+tt.path, func(t *testing.T) {
+			handled := false
+			r := gin.New()
+			r.Use(openAPIValidator(specRouter, tt.mode))
+			invalid := func(c *gin.Context) {
+				handled = true
+				c.JSON(http.StatusOK, gin.H{"version": "v1"})
+			}
+			r.GET("/health", invalid)
+			r.GET("/details/:id", invalid)
+			r.GET("/openapi.json", func(c *gin.Context) {
+				handled = true
+				openAPIHandler(c)
+			})
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest("GET", tt.path, nil))
+			if rec.Code != tt.status || handled != tt.handled {
+				t.Fatalf("got status %d, handled %v; want %d, %v", rec.Code, handled, tt.status, tt.handled)
+			}
+			if tt.body != "" && rec.Body.String() != tt.body {
+				t.Errorf("got body %s, want %s", rec.Body, tt.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,12 @@
+// Package integration holds the end-to-end tests of bookinfo.
+//
+// The tests set the services up in the test process and serve them on free
+// ports. Google Books is replaced by bookstub, and MySQL and MongoDB by
+// stand-ins that also run inside the test process.
+//
+// Run the tests from this directory with:
+//
+//	go test ./...
+//
+// With -short they are skipped.
+package integration
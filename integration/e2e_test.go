@@ -0,0 +1,412 @@
+package integration
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// get fetches url with the given headers and returns the status and body.
+func get(t *testing.T, client *http.Client, url string, headers map[string]string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func getJSON(t *testing.T, url string, v interface{}) {
+	t.Helper()
+	status, body := get(t, http.DefaultClient, url, nil)
+	if status != http.StatusOK {
+		t.Fatalf("GET %s: status %d: %s", url, status, body)
+	}
+	if err := json.Unmarshal([]byte(body), v); err != nil {
+		t.Fatalf("GET %s: %v: %s", url, err, body)
+	}
+}
+
+func TestProductPage(t *testing.T) {
+	for _, protocol := range []string{"http", "grpc"} {
+		t.Run(protocol, func(t *testing.T) {
+			app := startBookinfo(t, bookinfoOptions{args: map[string][]string{
+				"productpage": {"--client-protocol=" + protocol},
+			}})
+
+			status, body := get(t, http.DefaultClient, app.productpage.URL+"/productpage", nil)
+			if status != http.StatusOK {
+				t.Fatalf("status %d: %s", status, body)
+			}
+			for _, want := range []string{
+				"The Comedy of Errors",
+				"William Shakespeare",
+				"Reviewer1",
+				"Reviewer2",
+				"glyphicon-star",
+			} {
+				if !strings.Contains(body, want) {
+					t.Errorf("product page does not contain %q", want)
+				}
+			}
+			if strings.Contains(body, "currently unavailable") {
+				t.Errorf("product page reports an unavailable service:\n%s", body)
+			}
+
+			// The same page as its JSON view model, and the reviews alone.
+			var view struct {
+				Product struct{ Title string }
+				Details struct{ Data struct{ Author string } }
+				Reviews struct {
+					Data struct{ Reviews []json.RawMessage }
+				}
+			}
+			_, body = get(t, http.DefaultClient, app.productpage.URL+"/productpage", map[string]string{"Accept": "application/json"})
+			if err := json.Unmarshal([]byte(body), &view); err != nil || view.Product.Title != "The Comedy of Errors" || view.Details.Data.Author != "William Shakespeare" || len(view.Reviews.Data.Reviews) == 0 {
+				t.Errorf("JSON view = %+v, %v:\n%s", view, err, body)
+			}
+			_, body = get(t, http.DefaultClient, app.productpage.URL+"/products/0/reviews", nil)
+			if !strings.Contains(body, `id="reviews"`) || !strings.Contains(body, "Reviewer1") || strings.Contains(body, "<title>") {
+				t.Errorf("reviews fragment:\n%s", body)
+			}
+
+			// The language reaches details, which names the book language in it.
+			_, body = get(t, http.DefaultClient, app.productpage.URL+"/productpage", map[string]string{"Accept-Language": "pt-BR,pt;q=0.9"})
+			for _, want := range []string{"Detalhes do livro", "inglês", "Avaliações do livro"} {
+				if !strings.Contains(body, want) {
+					t.Errorf("Portuguese product page does not contain %q", want)
+				}
+			}
+		})
+	}
+}
+
+func TestProductAPI(t *testing.T) {
+	app := startBookinfo(t, bookinfoOptions{})
+	api := app.productpage.URL + "/api/v1/products/0"
+
+	var details struct {
+		ID     int    `json:"id"`
+		Author string `json:"author"`
+		ISBN10 string `json:"ISBN-10"`
+	}
+	getJSON(t, api, &details)
+	if details.Author != "William Shakespeare" || details.ISBN10 == "" {
+		t.Errorf("details = %+v", details)
+	}
+
+	var reviews struct {
+		Reviews []struct {
+			Reviewer string `json:"reviewer"`
+			Rating   struct {
+				Stars int `json:"stars"`
+			} `json:"rating"`
+		} `json:"reviews"`
+	}
+	getJSON(t, api+"/reviews", &reviews)
+	if len(reviews.Reviews) != 2 {
+		t.Fatalf("got %d reviews, want 2", len(reviews.Reviews))
+	}
+	for _, review := range reviews.Reviews {
+		if review.Rating.Stars == 0 {
+			t.Errorf("review by %s has no stars", review.Reviewer)
+		}
+	}
+
+	var ratings struct {
+		Ratings map[string]int `json:"ratings"`
+	}
+	getJSON(t, api+"/ratings", &ratings)
+	if ratings.Ratings["Reviewer1"] != 5 || ratings.Ratings["Reviewer2"] != 4 {
+		t.Errorf("ratings = %v", ratings.Ratings)
+	}
+
+	var full map[string]json.RawMessage
+	getJSON(t, api+"/full", &full)
+	for _, key := range []string{"details", "reviews"} {
+		if _, exists := full[key]; !exists {
+			t.Errorf("full product has no %q: %v", key, full)
+		}
+	}
+}
+
+// A rating posted to ratings reaches pages open on productpage through the
+// relayed event stream.
+func TestRatingsStream(t *testing.T) {
+	app := startBookinfo(t, bookinfoOptions{})
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(app.productpage.URL + "/api/v1/products/3/ratings/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+
+	lines := bufio.NewScanner(resp.Body)
+	next := func() map[string]int {
+		t.Helper()
+		for lines.Scan() {
+			if data, found := strings.CutPrefix(lines.Text(), "data: "); found {
+				var event struct {
+					Ratings map[string]int `json:"ratings"`
+				}
+				if err := json.Unmarshal([]byte(data), &event); err != nil {
+					t.Fatalf("%v: %s", err, data)
+				}
+				return event.Ratings
+			}
+		}
+		t.Fatalf("stream ended: %v", lines.Err())
+		return nil
+	}
+
+	if ratings := next(); ratings["Reviewer1"] != 5 {
+		t.Errorf("first event: ratings = %v", ratings)
+	}
+
+	post, err := http.Post(app.ratings.URL+"/ratings/3", "application/json", strings.NewReader(`{"Reviewer1": 2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	post.Body.Close()
+	if post.StatusCode != http.StatusOK {
+		t.Fatalf("POST /ratings/3: status %d", post.StatusCode)
+	}
+
+	if ratings := next(); ratings["Reviewer1"] != 2 {
+		t.Errorf("event after POST: ratings = %v", ratings)
+	}
+}
+
+// Rating changes go through the event bus: reviews evicts its cached ratings
+// and other subscribers see every change without polling.
+func TestRatingChangesOnEventBus(t *testing.T) {
+	broker := startFakeNATS(t)
+	app := startBookinfo(t, bookinfoOptions{args: map[string][]string{
+		"ratings": {"--event-bus-url=" + broker.url()},
+		"reviews": {"--event-bus-url=" + broker.url(), "--ratings-cache-ttl=1h"},
+	}})
+	for deadline := time.Now().Add(5 * time.Second); !broker.subscribed("ratings.*"); {
+		if time.Now().After(deadline) {
+			t.Fatal("reviews did not subscribe to rating changes")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	stars := func() int {
+		t.Helper()
+		var reviews struct {
+			Reviews []struct {
+				Reviewer string `json:"reviewer"`
+				Rating   struct {
+					Stars int `json:"stars"`
+				} `json:"rating"`
+			} `json:"reviews"`
+		}
+		getJSON(t, app.reviews.URL+"/reviews/4", &reviews)
+		for _, review := range reviews.Reviews {
+			if review.Reviewer == "Reviewer1" {
+				return review.Rating.Stars
+			}
+		}
+		t.Fatalf("no review by Reviewer1: %+v", reviews)
+		return 0
+	}
+	if got := stars(); got != 5 {
+		t.Fatalf("got %d stars before the change, want 5", got)
+	}
+
+	post, err := http.Post(app.ratings.URL+"/ratings/4", "application/json", strings.NewReader(`{"Reviewer1": 2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	post.Body.Close()
+
+	// The cached 5 stars would last an hour without the eviction
+	for deadline := time.Now().Add(5 * time.Second); stars() != 2; {
+		if time.Now().After(deadline) {
+			t.Fatal("reviews kept the cached ratings after the change")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	want := `ratings.4 {"seq":1,"id":4,"ratings":{"Reviewer1":2}}`
+	if got := broker.messages(); len(got) != 1 || got[0] != want {
+		t.Errorf("event bus got %q, want %q", got, want)
+	}
+}
+
+func TestHeaderPropagation(t *testing.T) {
+	// jason logs in with the password "password".
+	users := filepath.Join(t.TempDir(), "users.yaml")
+	if err := os.WriteFile(users, []byte("jason: $2a$04$vQ2ggF9.5VvHd/yEtp1RKey97bHdjqRXe.REnzKJaPLjzGIg6srFe\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	proxies := map[string]*recordingProxy{}
+	app := startBookinfo(t, bookinfoOptions{
+		args: map[string][]string{
+			"productpage": {"--users-file=" + users, "--jwt-hmac-secret=e2e-secret"},
+		},
+		wrap: func(name, url string) string {
+			proxies[name] = newRecordingProxy(t, url)
+			return proxies[name].URL
+		},
+	})
+
+	// Log in without following the redirect, to keep the session cookie.
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.PostForm(app.productpage.URL+"/login", url.Values{"username": {"jason"}, "passwd": {"password"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	var cookies []string
+	for _, cookie := range resp.Cookies() {
+		cookies = append(cookies, cookie.Name+"="+cookie.Value)
+	}
+	if len(cookies) == 0 {
+		t.Fatalf("login set no cookie, status %d", resp.StatusCode)
+	}
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	status, body := get(t, client, app.productpage.URL+"/productpage", map[string]string{
+		"x-request-id": "e2e-request",
+		"traceparent":  traceparent,
+		"Cookie":       strings.Join(cookies, "; "),
+	})
+	if status != http.StatusOK {
+		t.Fatalf("status %d: %s", status, body)
+	}
+
+	// ratings is called by reviews, not by productpage.
+	for _, name := range []string{"details", "reviews", "ratings"} {
+		received := proxies[name].received()
+		// productpage also calls details on its own, to build the search
+		// index, so the page's call is told apart by its request id
+		var headers http.Header
+		for _, h := range received {
+			if h.Get("x-request-id") == "e2e-request" {
+				headers = h
+			}
+		}
+		if headers == nil {
+			t.Errorf("%s received no request of the page", name)
+			continue
+		}
+		for key, want := range map[string]string{
+			"x-request-id": "e2e-request",
+			"traceparent":  traceparent,
+			"end-user":     "jason",
+		} {
+			if got := headers.Get(key); got != want {
+				t.Errorf("%s received %s = %q, want %q", name, key, got, want)
+			}
+		}
+	}
+}
+
+func TestDetailsFromBookstub(t *testing.T) {
+	books := startService(t, "bookstub")
+	details := startService(t, "details", "--external-book-service=true", "--google-books-url="+books.URL+"/books/v1")
+
+	var got struct {
+		Author    string `json:"author"`
+		Publisher string `json:"publisher"`
+		Pages     int    `json:"pages"`
+		Language  string `json:"language"`
+		ISBN13    string `json:"ISBN-13"`
+	}
+	getJSON(t, details.URL+"/details/0", &got)
+	if got.Author != "William Shakespeare" || got.Pages != 80 || got.Language != "English" || got.ISBN13 != "9780486424613" {
+		t.Errorf("details = %+v", got)
+	}
+
+	// With every Google Books call failing, details reports the error
+	// instead of crashing.
+	req, _ := http.NewRequest(http.MethodPut, books.URL+"/admin/faults", strings.NewReader(`{"errorRate": 1}`))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	status, body := get(t, http.DefaultClient, details.URL+"/details/0", nil)
+	if status != http.StatusInternalServerError || !strings.Contains(body, "status 503") {
+		t.Errorf("with injected errors: status %d: %s", status, body)
+	}
+}
+
+func TestRatingsDatabases(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  func(t *testing.T) []string
+		want1 int
+		want2 int
+	}{
+		{
+			name: "mysql",
+			args: func(t *testing.T) []string {
+				db := startFakeMySQL(t, "3", "1")
+				return []string{
+					"--db-type=mysql",
+					"--mysql-host=127.0.0.1",
+					fmt.Sprintf("--mysql-port=%d", db.port()),
+					"--mysql-user=root",
+					"--mysql-password=password",
+				}
+			},
+			want1: 3,
+			want2: 1,
+		},
+		{
+			name: "mongodb",
+			args: func(t *testing.T) []string {
+				db := startFakeMongo(t, bson.M{"rating": int32(2)}, bson.M{"rating": int32(5)})
+				return []string{"--db-type=mongodb", "--mongo-url=" + db.url()}
+			},
+			want1: 2,
+			want2: 5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ratings := startService(t, "ratings", append(tt.args(t), "--service-version=v2")...)
+
+			var got struct {
+				Ratings map[string]int `json:"ratings"`
+			}
+			getJSON(t, ratings.URL+"/ratings/1", &got)
+			if got.Ratings["Reviewer1"] != tt.want1 || got.Ratings["Reviewer2"] != tt.want2 {
+				t.Errorf("ratings = %v, want Reviewer1=%d Reviewer2=%d", got.Ratings, tt.want1, tt.want2)
+			}
+		})
+	}
+}
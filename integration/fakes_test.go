@@ -0,0 +1,503 @@
+package integration
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// recordingProxy forwards requests to target and keeps their headers, to
+// check what a service received from its caller.
+type recordingProxy struct {
+	*httptest.Server
+	mu      sync.Mutex
+	headers []http.Header
+}
+
+func newRecordingProxy(t *testing.T, target string) *recordingProxy {
+	u, err := url.Parse(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &recordingProxy{}
+	proxy := httputil.NewSingleHostReverseProxy(u)
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			p.mu.Lock()
+			p.headers = append(p.headers, r.Header.Clone())
+			p.mu.Unlock()
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	t.Cleanup(p.Close)
+	return p
+}
+
+// received returns the headers of the requests proxied so far.
+func (p *recordingProxy) received() []http.Header {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]http.Header(nil), p.headers...)
+}
+
+// fakeMySQL speaks enough of the MySQL client/server protocol for the ratings
+// service: it accepts any login, answers pings, and returns the ratings
+// column for every query.
+type fakeMySQL struct {
+	listener net.Listener
+	ratings  []string
+}
+
+func startFakeMySQL(t *testing.T, ratings ...string) *fakeMySQL {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeMySQL{listener: l, ratings: ratings}
+	go f.serve()
+	t.Cleanup(func() { l.Close() })
+	return f
+}
+
+func (f *fakeMySQL) port() int {
+	return f.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (f *fakeMySQL) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+const (
+	mysqlComQuit  = 0x01
+	mysqlComQuery = 0x03
+	mysqlComPing  = 0x0e
+)
+
+func (f *fakeMySQL) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	// Protocol 41, secure connection, transactions, long password and
+	// connect with database.
+	capabilities := uint32(0x0001 | 0x0008 | 0x0200 | 0x2000 | 0x8000 | 0x80000)
+	handshake := []byte{10}
+	handshake = append(handshake, "8.0.0-fake\x00"...)
+	handshake = binary.LittleEndian.AppendUint32(handshake, 1)
+	handshake = append(handshake, "abcdefgh\x00"...)
+	handshake = binary.LittleEndian.AppendUint16(handshake, uint16(capabilities))
+	handshake = append(handshake, 0x21)
+	handshake = binary.LittleEndian.AppendUint16(handshake, 0x0002)
+	handshake = binary.LittleEndian.AppendUint16(handshake, uint16(capabilities>>16))
+	handshake = append(handshake, 21)
+	handshake = append(handshake, make([]byte, 10)...)
+	handshake = append(handshake, "ijklmnopqrst\x00"...)
+	handshake = append(handshake, "mysql_native_password\x00"...)
+	if writeMySQLPacket(conn, 0, handshake) != nil {
+		return
+	}
+
+	// Any credentials are accepted.
+	if _, _, err := readMySQLPacket(r); err != nil {
+		return
+	}
+	if writeMySQLPacket(conn, 2, mysqlOK()) != nil {
+		return
+	}
+
+	for {
+		_, payload, err := readMySQLPacket(r)
+		if err != nil || len(payload) == 0 {
+			return
+		}
+		switch payload[0] {
+		case mysqlComQuit:
+			return
+		case mysqlComPing:
+			err = writeMySQLPacket(conn, 1, mysqlOK())
+		case mysqlComQuery:
+			err = f.writeRatings(conn)
+		default:
+			err = writeMySQLPacket(conn, 1, mysqlOK())
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// writeRatings sends a text result set with a single INT column, Rating.
+func (f *fakeMySQL) writeRatings(conn net.Conn) error {
+	var column []byte
+	for _, s := range []string{"def", "ratingsdb", "ratings", "ratings", "Rating", "Rating"} {
+		column = appendLengthEncoded(column, s)
+	}
+	column = append(column, 0x0c)
+	column = binary.LittleEndian.AppendUint16(column, 63)
+	column = binary.LittleEndian.AppendUint32(column, 11)
+	column = append(column, 0x03) // MYSQL_TYPE_LONG
+	column = binary.LittleEndian.AppendUint16(column, 0)
+	column = append(column, 0, 0, 0)
+
+	packets := [][]byte{{1}, column, mysqlEOF()}
+	for _, rating := range f.ratings {
+		packets = append(packets, appendLengthEncoded(nil, rating))
+	}
+	packets = append(packets, mysqlEOF())
+
+	for i, packet := range packets {
+		if err := writeMySQLPacket(conn, byte(i+1), packet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func mysqlOK() []byte {
+	return []byte{0x00, 0, 0, 0x02, 0, 0, 0}
+}
+
+func mysqlEOF() []byte {
+	return []byte{0xfe, 0, 0, 0x02, 0}
+}
+
+func appendLengthEncoded(b []byte, s string) []byte {
+	return append(append(b, byte(len(s))), s...)
+}
+
+func readMySQLPacket(r *bufio.Reader) (byte, []byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	length := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	payload := make([]byte, length)
+	_, err := io.ReadFull(r, payload)
+	return header[3], payload, err
+}
+
+func writeMySQLPacket(w io.Writer, seq byte, payload []byte) error {
+	header := []byte{byte(len(payload)), byte(len(payload) >> 8), byte(len(payload) >> 16), seq}
+	_, err := w.Write(append(header, payload...))
+	return err
+}
+
+// fakeMongo speaks enough of the MongoDB wire protocol for the ratings
+// service: the connection handshake, the monitoring hellos and find, which
+// returns the configured documents whatever the filter.
+type fakeMongo struct {
+	listener net.Listener
+	docs     []bson.M
+}
+
+func startFakeMongo(t *testing.T, docs ...bson.M) *fakeMongo {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeMongo{listener: l, docs: docs}
+	go f.serve()
+	t.Cleanup(func() { l.Close() })
+	return f
+}
+
+func (f *fakeMongo) url() string {
+	return "mongodb://" + f.listener.Addr().String() + "/?directConnection=true"
+}
+
+func (f *fakeMongo) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+const (
+	mongoOpReply = 1
+	mongoOpQuery = 2004
+	mongoOpMsg   = 2013
+)
+
+func (f *fakeMongo) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		requestID, opCode, body, err := readMongoMessage(r)
+		if err != nil {
+			return
+		}
+
+		switch opCode {
+		case mongoOpQuery:
+			// flags, collection name, skip and limit come before the query.
+			end := bytes.IndexByte(body[4:], 0)
+			if end < 0 {
+				return
+			}
+			command, err := firstDocument(body[4+end+1+8:])
+			if err != nil {
+				return
+			}
+			reply, _ := bson.Marshal(f.reply(command))
+			var msg []byte
+			msg = binary.LittleEndian.AppendUint32(msg, 0) // response flags
+			msg = binary.LittleEndian.AppendUint64(msg, 0) // cursor id
+			msg = binary.LittleEndian.AppendUint32(msg, 0) // starting from
+			msg = binary.LittleEndian.AppendUint32(msg, 1) // documents returned
+			msg = append(msg, reply...)
+			err = writeMongoMessage(conn, requestID, mongoOpReply, msg)
+		case mongoOpMsg:
+			// flag bits, then a kind 0 section with the command.
+			if len(body) < 5 || body[4] != 0 {
+				return
+			}
+			command, err := firstDocument(body[5:])
+			if err != nil {
+				return
+			}
+			reply, _ := bson.Marshal(f.reply(command))
+			msg := binary.LittleEndian.AppendUint32(nil, 0)
+			msg = append(msg, 0)
+			msg = append(msg, reply...)
+			err = writeMongoMessage(conn, requestID, mongoOpMsg, msg)
+		default:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeMongo) reply(command bson.D) bson.D {
+	if len(command) == 0 {
+		return bson.D{{Key: "ok", Value: 0.0}}
+	}
+	switch strings.ToLower(command[0].Key) {
+	case "ismaster", "hello":
+		return bson.D{
+			{Key: "ismaster", Value: true},
+			{Key: "isWritablePrimary", Value: true},
+			{Key: "helloOk", Value: true},
+			{Key: "maxBsonObjectSize", Value: int32(16 * 1024 * 1024)},
+			{Key: "maxMessageSizeBytes", Value: int32(48000000)},
+			{Key: "maxWriteBatchSize", Value: int32(100000)},
+			{Key: "localTime", Value: time.Now()},
+			{Key: "logicalSessionTimeoutMinutes", Value: int32(30)},
+			{Key: "connectionId", Value: int32(1)},
+			{Key: "minWireVersion", Value: int32(0)},
+			{Key: "maxWireVersion", Value: int32(17)},
+			{Key: "readOnly", Value: false},
+			{Key: "ok", Value: 1.0},
+		}
+	case "find":
+		batch := make(bson.A, len(f.docs))
+		for i, doc := range f.docs {
+			batch[i] = doc
+		}
+		return bson.D{
+			{Key: "cursor", Value: bson.D{
+				{Key: "firstBatch", Value: batch},
+				{Key: "id", Value: int64(0)},
+				{Key: "ns", Value: "test." + command[0].Value.(string)},
+			}},
+			{Key: "ok", Value: 1.0},
+		}
+	}
+	return bson.D{{Key: "ok", Value: 1.0}}
+}
+
+func firstDocument(b []byte) (bson.D, error) {
+	if len(b) < 4 {
+		return nil, errors.New("short document")
+	}
+	length := int(binary.LittleEndian.Uint32(b))
+	if length > len(b) {
+		return nil, errors.New("short document")
+	}
+	var doc bson.D
+	err := bson.Unmarshal(b[:length], &doc)
+	return doc, err
+}
+
+func readMongoMessage(r *bufio.Reader) (requestID int32, opCode int32, body []byte, err error) {
+	var header [16]byte
+	if _, err = io.ReadFull(r, header[:]); err != nil {
+		return
+	}
+	length := int(binary.LittleEndian.Uint32(header[0:]))
+	requestID = int32(binary.LittleEndian.Uint32(header[4:]))
+	opCode = int32(binary.LittleEndian.Uint32(header[12:]))
+	if length < 16 {
+		return 0, 0, nil, errors.New("bad message length")
+	}
+	body = make([]byte, length-16)
+	_, err = io.ReadFull(r, body)
+	return
+}
+
+func writeMongoMessage(w io.Writer, responseTo int32, opCode int32, body []byte) error {
+	var msg []byte
+	msg = binary.LittleEndian.AppendUint32(msg, uint32(16+len(body)))
+	msg = binary.LittleEndian.AppendUint32(msg, uint32(responseTo)+1000)
+	msg = binary.LittleEndian.AppendUint32(msg, uint32(responseTo))
+	msg = binary.LittleEndian.AppendUint32(msg, uint32(opCode))
+	_, err := w.Write(append(msg, body...))
+	return err
+}
+
+// fakeNATS speaks enough of the NATS protocol for ratings and reviews: it
+// routes published messages to the matching subscriptions, wildcards
+// included, and keeps them for the test to inspect, as an analytics
+// subscriber would see them.
+type fakeNATS struct {
+	listener net.Listener
+
+	mu        sync.Mutex
+	subs      []natsSubscription
+	published []string
+}
+
+type natsSubscription struct {
+	subject string
+	sid     string
+	conn    *natsClient
+}
+
+// natsClient serializes the writes to a connection.
+type natsClient struct {
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (c *natsClient) write(s string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	io.WriteString(c.conn, s)
+}
+
+func startFakeNATS(t *testing.T) *fakeNATS {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeNATS{listener: l}
+	go f.serve()
+	t.Cleanup(func() { l.Close() })
+	return f
+}
+
+func (f *fakeNATS) url() string {
+	return "nats://" + f.listener.Addr().String()
+}
+
+func (f *fakeNATS) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeNATS) handle(conn net.Conn) {
+	defer conn.Close()
+	client := &natsClient{conn: conn}
+	client.write("INFO {\"server_id\":\"fake\",\"max_payload\":1048576}\r\n")
+
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+		case fields[0] == "PING":
+			client.write("PONG\r\n")
+		case fields[0] == "SUB" && len(fields) == 3:
+			f.mu.Lock()
+			f.subs = append(f.subs, natsSubscription{subject: fields[1], sid: fields[2], conn: client})
+			f.mu.Unlock()
+		case fields[0] == "PUB" && len(fields) == 3:
+			size, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return
+			}
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			f.route(fields[1], payload[:size])
+		}
+	}
+}
+
+func (f *fakeNATS) route(subject string, payload []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.published = append(f.published, subject+" "+string(payload))
+	for _, sub := range f.subs {
+		if natsSubjectMatches(sub.subject, subject) {
+			sub.conn.write(fmt.Sprintf("MSG %s %s %d\r\n%s\r\n", subject, sub.sid, len(payload), payload))
+		}
+	}
+}
+
+// subscribed reports whether someone subscribed to subject.
+func (f *fakeNATS) subscribed(subject string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, sub := range f.subs {
+		if sub.subject == subject {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fakeNATS) messages() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.published...)
+}
+
+// natsSubjectMatches matches a subject against a subscription, where *
+// stands for one token and > for the remaining ones.
+func natsSubjectMatches(pattern, subject string) bool {
+	patternTokens, subjectTokens := strings.Split(pattern, "."), strings.Split(subject, ".")
+	for i, token := range patternTokens {
+		if token == ">" {
+			return len(subjectTokens) > i
+		}
+		if i >= len(subjectTokens) || (token != "*" && token != subjectTokens[i]) {
+			return false
+		}
+	}
+	return len(patternTokens) == len(subjectTokens)
+}
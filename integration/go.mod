@@ -0,0 +1,81 @@
+module github.com/camilamedeir0s/bookinfo-go/integration
+
+go 1.22.4
+
+require (
+	github.com/camilamedeir0s/bookinfo-go/bookstub v0.0.0-00010101000000-000000000000
+	github.com/camilamedeir0s/bookinfo-go/details v0.0.0-00010101000000-000000000000
+	github.com/camilamedeir0s/bookinfo-go/productpage v0.0.0-00010101000000-000000000000
+	github.com/camilamedeir0s/bookinfo-go/ratings v0.0.0-00010101000000-000000000000
+	github.com/camilamedeir0s/bookinfo-go/reviews v0.0.0-00010101000000-000000000000
+	go.mongodb.org/mongo-driver v1.17.0
+)
+
+require (
+	filippo.io/edwards25519 v1.1.0 // indirect
+	github.com/bytedance/sonic v1.11.6 // indirect
+	github.com/bytedance/sonic/loader v0.1.1 // indirect
+	github.com/camilamedeir0s/bookinfo-go/bookinfopb v0.0.0-00010101000000-000000000000 // indirect
+	github.com/camilamedeir0s/bookinfo-go/ratelimit v0.0.0-00010101000000-000000000000 // indirect
+	github.com/cloudwego/base64x v0.1.4 // indirect
+	github.com/cloudwego/iasm v0.2.0 // indirect
+	github.com/gabriel-vasile/mimetype v1.4.3 // indirect
+	github.com/getkin/kin-openapi v0.127.0 // indirect
+	github.com/gin-contrib/sse v0.1.0 // indirect
+	github.com/gin-gonic/gin v1.10.0 // indirect
+	github.com/go-openapi/jsonpointer v0.21.0 // indirect
+	github.com/go-openapi/swag v0.23.0 // indirect
+	github.com/go-playground/locales v0.14.1 // indirect
+	github.com/go-playground/universal-translator v0.18.1 // indirect
+	github.com/go-playground/validator/v10 v10.20.0 // indirect
+	github.com/go-sql-driver/mysql v1.8.1 // indirect
+	github.com/goccy/go-json v0.10.2 // indirect
+	github.com/golang-jwt/jwt/v5 v5.2.2 // indirect
+	github.com/golang/snappy v0.0.4 // indirect
+	github.com/gorilla/mux v1.8.1 // indirect
+	github.com/invopop/yaml v0.3.1 // indirect
+	github.com/josharian/intern v1.0.0 // indirect
+	github.com/json-iterator/go v1.1.12 // indirect
+	github.com/klauspost/compress v1.18.0 // indirect
+	github.com/klauspost/cpuid/v2 v2.2.7 // indirect
+	github.com/leodido/go-urn v1.4.0 // indirect
+	github.com/mailru/easyjson v0.7.7 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
+	github.com/modern-go/reflect2 v1.0.2 // indirect
+	github.com/mohae/deepcopy v0.0.0-20170929034955-c48cc78d4826 // indirect
+	github.com/montanaflynn/stats v0.7.1 // indirect
+	github.com/nats-io/nats.go v1.39.1 // indirect
+	github.com/nats-io/nkeys v0.4.9 // indirect
+	github.com/nats-io/nuid v1.0.1 // indirect
+	github.com/pelletier/go-toml/v2 v2.2.2 // indirect
+	github.com/perimeterx/marshmallow v1.1.5 // indirect
+	github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
+	github.com/ugorji/go/codec v1.2.12 // indirect
+	github.com/xdg-go/pbkdf2 v1.0.0 // indirect
+	github.com/xdg-go/scram v1.1.2 // indirect
+	github.com/xdg-go/stringprep v1.0.4 // indirect
+	github.com/youmark/pkcs8 v0.0.0-20240726163527-a2c0da244d78 // indirect
+	golang.org/x/arch v0.8.0 // indirect
+	golang.org/x/crypto v0.31.0 // indirect
+	golang.org/x/net v0.25.0 // indirect
+	golang.org/x/sync v0.10.0 // indirect
+	golang.org/x/sys v0.28.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240528184218-531527333157 // indirect
+	google.golang.org/grpc v1.65.0 // indirect
+	google.golang.org/protobuf v1.34.2 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+// The services and the modules they share are in this repository. Replaces in
+// the services' go.mod don't apply here, so they are repeated.
+replace (
+	github.com/camilamedeir0s/bookinfo-go/bookinfopb => ../bookinfopb
+	github.com/camilamedeir0s/bookinfo-go/bookstub => ../bookstub
+	github.com/camilamedeir0s/bookinfo-go/details => ../details
+	github.com/camilamedeir0s/bookinfo-go/productpage => ../productpage
+	github.com/camilamedeir0s/bookinfo-go/ratelimit => ../ratelimit
+	github.com/camilamedeir0s/bookinfo-go/ratings => ../ratings
+	github.com/camilamedeir0s/bookinfo-go/reviews => ../reviews
+)
@@ -0,0 +1,161 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/camilamedeir0s/bookinfo-go/bookstub"
+	"github.com/camilamedeir0s/bookinfo-go/details"
+	"github.com/camilamedeir0s/bookinfo-go/productpage"
+	"github.com/camilamedeir0s/bookinfo-go/ratings"
+	"github.com/camilamedeir0s/bookinfo-go/reviews"
+)
+
+// service is a bookinfo service running in the test process, its HTTP API
+// served at URL.
+type service struct {
+	*httptest.Server
+	grpcPort int
+}
+
+// grpcAPI is implemented by the services that also serve gRPC.
+type grpcAPI interface {
+	ServeGRPC(lis net.Listener) error
+}
+
+// startService sets a service up from command line arguments and serves it on
+// free ports. It is closed when the test ends. The services validate their
+// requests and responses against their OpenAPI spec.
+func startService(t *testing.T, name string, args ...string) *service {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("integration tests are skipped with -short")
+	}
+
+	var (
+		handler http.Handler
+		grpc    grpcAPI
+		closer  func(context.Context)
+		err     error
+	)
+	strict := append([]string{"--openapi-validation=strict"}, args...)
+	switch name {
+	case "details":
+		var server *details.Server
+		if server, err = details.New(strict); err == nil {
+			handler, grpc, closer = server.Handler, server, server.Close
+		}
+	case "reviews":
+		var server *reviews.Server
+		if server, err = reviews.New(strict); err == nil {
+			handler, grpc, closer = server.Handler, server, server.Close
+		}
+	case "ratings":
+		var server *ratings.Server
+		if server, err = ratings.New(strict); err == nil {
+			handler, grpc, closer = server.Handler, server, server.Close
+		}
+	case "productpage":
+		var server *productpage.Server
+		if server, err = productpage.New(strict); err == nil {
+			handler, closer = server.Handler, server.Close
+		}
+	case "bookstub":
+		handler, err = bookstub.New(args)
+	default:
+		t.Fatalf("unknown service %s", name)
+	}
+	if err != nil {
+		t.Fatalf("setting up %s: %v", name, err)
+	}
+
+	s := &service{Server: httptest.NewServer(handler)}
+	if grpc != nil {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.grpcPort = lis.Addr().(*net.TCPAddr).Port
+		go grpc.ServeGRPC(lis)
+	}
+
+	t.Cleanup(func() {
+		s.Close()
+		if closer != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			closer(ctx)
+		}
+	})
+	return s
+}
+
+// bookinfo is the whole application: productpage calling details and
+// reviews, and reviews calling ratings.
+type bookinfo struct {
+	details     *service
+	reviews     *service
+	ratings     *service
+	productpage *service
+}
+
+// bookinfoOptions changes how startBookinfo wires the services.
+type bookinfoOptions struct {
+	// Extra command line arguments of each service, by service name.
+	args map[string][]string
+	// wrap, when set, may put a proxy in front of a service. It gets the
+	// service name and URL and returns the URL callers should use.
+	wrap func(name, url string) string
+}
+
+// startBookinfo starts ratings, details and reviews, then productpage wired to
+// them.
+func startBookinfo(t *testing.T, opts bookinfoOptions) *bookinfo {
+	t.Helper()
+	wrap := func(name, url string) string {
+		if opts.wrap == nil {
+			return url
+		}
+		return opts.wrap(name, url)
+	}
+
+	b := &bookinfo{}
+	b.ratings = startService(t, "ratings", opts.args["ratings"]...)
+	b.details = startService(t, "details", opts.args["details"]...)
+
+	ratingsURL := wrap("ratings", b.ratings.URL)
+	ratingsHost, ratingsPort := hostPort(t, ratingsURL)
+	b.reviews = startService(t, "reviews", append([]string{
+		"--pod-name=reviews-v2-test",
+		"--enable-ratings=true",
+		"--ratings-hostname=" + ratingsHost,
+		"--ratings-service-port=" + ratingsPort,
+		fmt.Sprintf("--ratings-grpc-port=%d", b.ratings.grpcPort),
+	}, opts.args["reviews"]...)...)
+
+	b.productpage = startService(t, "productpage", append([]string{
+		"--details-hostname=127.0.0.1",
+		"--details-endpoints=" + wrap("details", b.details.URL),
+		fmt.Sprintf("--details-grpc-port=%d", b.details.grpcPort),
+		"--reviews-hostname=127.0.0.1",
+		"--reviews-endpoints=" + wrap("reviews", b.reviews.URL),
+		fmt.Sprintf("--reviews-grpc-port=%d", b.reviews.grpcPort),
+		"--ratings-endpoints=" + ratingsURL,
+		"--topology-probe-interval=0s",
+	}, opts.args["productpage"]...)...)
+	return b
+}
+
+func hostPort(t *testing.T, url string) (string, string) {
+	t.Helper()
+	host, port, err := net.SplitHostPort(url[len("http://"):])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return host, port
+}
@@ -0,0 +1,119 @@
+package productpage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Tempo máximo de espera por cada serviço ao montar a resposta agregada
+const upstreamTimeout = 5 * time.Second
+
+var upstreamClient = &http.Client{Timeout: upstreamTimeout}
+
+// Section é uma parte da resposta agregada. Status é o código HTTP devolvido
+// pelo serviço (ou 0 se ele não respondeu) e Data só é preenchido em caso de
+// sucesso.
+type Section[T any] struct {
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Data   *T     `json:"data,omitempty"`
+}
+
+// FullProduct reúne o produto do catálogo e as respostas de details, reviews e
+// ratings em um único documento
+type FullProduct struct {
+	Product Product                 `json:"product"`
+	Details Section[BookDetails]    `json:"details"`
+	Reviews Section[ReviewData]     `json:"reviews"`
+	Ratings Section[ProductRatings] `json:"ratings"`
+}
+
+func productFullHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || productID < 0 {
+		writeAPIError(w, http.StatusBadRequest, "", "please provide a non-negative numeric product id")
+		return
+	}
+
+	product, ok := catalog.Product(productID)
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "", fmt.Sprintf("product %d not found", productID))
+		return
+	}
+
+	headers := forwardHeaders(r)
+	full := FullProduct{Product: product}
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		full.Details = fetchSection[BookDetails](r.Context(), "details", fmt.Sprintf("/details/%d", productID), headers)
+	}()
+	go func() {
+		defer wg.Done()
+		full.Reviews = fetchSection[ReviewData](r.Context(), "reviews", fmt.Sprintf("/reviews/%d", productID), headers)
+		if full.Reviews.Data != nil || full.Reviews.Unavailable() {
+			recordReviews(full.Reviews.Data)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		full.Ratings = fetchSection[ProductRatings](r.Context(), "ratings", fmt.Sprintf("/ratings/%d", productID), headers)
+	}()
+	wg.Wait()
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(full); err != nil {
+		http.Error(w, "Error encoding JSON", http.StatusInternalServerError)
+	}
+}
+
+// fetchSection faz um GET em path no serviço upstream e decodifica a resposta
+// em T. Falhas viram Status/Error na seção em vez de derrubar a resposta
+// inteira.
+func fetchSection[T any](ctx context.Context, upstream, path string, headers map[string]string) Section[T] {
+	resp, err := upstreamGet(ctx, upstreamClient, upstream, path, headers)
+	if err != nil {
+		return Section[T]{Error: err.Error()}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Section[T]{Status: resp.StatusCode, Error: err.Error()}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return Section[T]{Status: resp.StatusCode, Error: upstreamError(resp.StatusCode, body).Error()}
+	}
+
+	var data T
+	if err := json.Unmarshal(body, &data); err != nil {
+		return Section[T]{Status: resp.StatusCode, Error: "invalid response: " + err.Error()}
+	}
+	return Section[T]{Status: resp.StatusCode, Data: &data}
+}
+
+// upstreamError extrai a mensagem do campo "error" devolvido pelos serviços,
+// caindo para o texto padrão do status quando o corpo não a contém
+func upstreamError(status int, body []byte) error {
+	var payload struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &payload) == nil && payload.Error != "" {
+		return errors.New(payload.Error)
+	}
+	return errors.New(http.StatusText(status))
+}
@@ -0,0 +1,243 @@
+package productpage
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// Validade dos tokens emitidos no login
+const tokenTTL = time.Hour
+
+const sessionCookie = "session"
+
+// Claims são as claims dos tokens emitidos pela productpage, verificadas por
+// reviews e ratings
+type Claims struct {
+	Roles []string `json:"roles,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// tokenIssuer assina os tokens de sessão. É nil quando nem jwtHmacSecret nem
+// jwtPrivateKeyFile estão definidos; nesse caso a autenticação fica
+// desabilitada: o login é recusado e todas as requisições são anônimas.
+var tokenIssuer *jwtIssuer
+
+// credentials guarda as senhas dos usuários que podem fazer login. É nil
+// quando usersFile não está definido, e então o login é recusado.
+var credentials credentialStore
+
+// credentialStore associa cada usuário ao hash bcrypt da sua senha
+type credentialStore map[string][]byte
+
+// Hash comparado quando o usuário não existe, para que a resposta demore o
+// mesmo que a de uma senha errada e não revele quais usuários existem
+var unknownUserHash = []byte("$2a$10$DOOjojIY/.Z0MKihrKXpMugdFdo5k6Py9rA1Mgk1sZt3tU3NnCrWm")
+
+// loadCredentials lê o arquivo YAML em path, um mapa de usuário para o hash
+// bcrypt da senha (gerado, por exemplo, com htpasswd -nbB)
+func loadCredentials(path string) (credentialStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var hashes map[string]string
+	if err := yaml.Unmarshal(data, &hashes); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	store := make(credentialStore, len(hashes))
+	for user, hash := range hashes {
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("password of %s in %s is not a bcrypt hash: %w", user, path, err)
+		}
+		store[user] = []byte(hash)
+	}
+	return store, nil
+}
+
+// check confere a senha do usuário
+func (s credentialStore) check(user, password string) bool {
+	hash, exists := s[user]
+	if !exists {
+		hash = unknownUserHash
+	}
+	return bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil && exists
+}
+
+type jwtIssuer struct {
+	method     jwt.SigningMethod
+	signingKey interface{}
+	verifyKey  interface{}
+	keyID      string
+	issuer     string
+	admins     map[string]bool
+}
+
+// loadTokenIssuer configura a assinatura HS256 (jwtHmacSecret) ou RS256
+// (jwtPrivateKeyFile, chave RSA em PEM)
+func loadTokenIssuer() (*jwtIssuer, error) {
+	issuer := &jwtIssuer{
+		keyID:  config.JWTKeyID,
+		issuer: config.JWTIssuer,
+		admins: map[string]bool{},
+	}
+	for _, admin := range config.AdminUsers {
+		issuer.admins[admin] = true
+	}
+
+	if secret := config.JWTHMACSecret; secret != "" {
+		issuer.method = jwt.SigningMethodHS256
+		issuer.signingKey = []byte(secret)
+		issuer.verifyKey = []byte(secret)
+		return issuer, nil
+	}
+
+	if path := config.JWTPrivateKeyFile; path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+		issuer.method = jwt.SigningMethodRS256
+		issuer.signingKey = key
+		issuer.verifyKey = &key.PublicKey
+		return issuer, nil
+	}
+
+	return nil, nil
+}
+
+// Issue emite um token para o usuário, com o papel admin se ele estiver em
+// ADMIN_USERS
+func (i *jwtIssuer) Issue(user string) (string, error) {
+	roles := []string{"user"}
+	if i.admins[user] {
+		roles = append(roles, "admin")
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(i.method, Claims{
+		Roles: roles,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   user,
+			Issuer:    i.issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(tokenTTL)),
+		},
+	})
+	token.Header["kid"] = i.keyID
+	return token.SignedString(i.signingKey)
+}
+
+// Verify valida um token emitido por esta productpage
+func (i *jwtIssuer) Verify(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(*jwt.Token) (interface{}, error) {
+		return i.verifyKey, nil
+	}, jwt.WithValidMethods([]string{i.method.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// Registra uma única vez que cookies de sessão estão sendo ignorados
+var logAuthDisabled sync.Once
+
+// sessionUser devolve o usuário logado e o token da sessão. Só tokens
+// assinados por esta productpage são aceitos; sem emissor configurado todas
+// as requisições são anônimas.
+func sessionUser(r *http.Request) (user, token string) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil || cookie.Value == "" {
+		return "", ""
+	}
+
+	if tokenIssuer == nil {
+		logAuthDisabled.Do(func() {
+			log.Println("Ignoring session cookies: authentication is disabled without a JWT signing key")
+		})
+		return "", ""
+	}
+
+	claims, err := tokenIssuer.Verify(cookie.Value)
+	if err != nil {
+		return "", ""
+	}
+	return claims.Subject, cookie.Value
+}
+
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	user := strings.TrimSpace(r.FormValue("username"))
+	password := r.FormValue("passwd")
+	if user == "" || password == "" {
+		writeAPIError(w, http.StatusBadRequest, "", "please provide a username and password")
+		return
+	}
+
+	if tokenIssuer == nil || credentials == nil {
+		writeAPIError(w, http.StatusNotImplemented, "", "login is disabled")
+		return
+	}
+	if !credentials.check(user, password) {
+		log.Printf("Rejected login of %s", user)
+		writeAPIError(w, http.StatusUnauthorized, "", "invalid username or password")
+		return
+	}
+
+	token, err := tokenIssuer.Issue(user)
+	if err != nil {
+		log.Printf("Could not issue token for %s: %v", user, err)
+		writeAPIError(w, http.StatusInternalServerError, "", "could not issue token")
+		return
+	}
+
+	// Clientes de API recebem o token no corpo em vez de um redirecionamento
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"user":      user,
+			"token":     token,
+			"expiresIn": int(tokenTTL.Seconds()),
+		})
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(tokenTTL.Seconds()),
+	})
+	http.Redirect(w, r, redirectTarget(r), http.StatusSeeOther)
+}
+
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "", Path: "/", MaxAge: -1})
+	http.Redirect(w, r, redirectTarget(r), http.StatusSeeOther)
+}
+
+// redirectTarget volta para a página de origem, desde que seja deste mesmo host
+func redirectTarget(r *http.Request) string {
+	if referer := r.Header.Get("Referer"); referer != "" {
+		if target, err := r.URL.Parse(referer); err == nil && target.Host == r.Host {
+			return target.RequestURI()
+		}
+	}
+	return "/productpage"
+}
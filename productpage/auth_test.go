@@ -0,0 +1,207 @@
+package productpage
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// useAuth habilita o login durante o teste para os usuários e senhas
+// informados, com tokens HS256 e os administradores de admins
+func useAuth(t *testing.T, passwords map[string]string, admins ...string) {
+	t.Helper()
+	useConfig(t, func(c *Config) {
+		c.JWTHMACSecret = "test-secret"
+		c.AdminUsers = admins
+	})
+
+	store := credentialStore{}
+	for user, password := range passwords {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		store[user] = hash
+	}
+
+	previousIssuer, previousCredentials := tokenIssuer, credentials
+	issuer, err := loadTokenIssuer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenIssuer, credentials = issuer, store
+	t.Cleanup(func() { tokenIssuer, credentials = previousIssuer, previousCredentials })
+}
+
+// login envia o formulário de login e devolve a resposta
+func login(user, password string, accept string) *httptest.ResponseRecorder {
+	form := url.Values{"username": {user}, "passwd": {password}}
+	req := httptest.NewRequest("POST", "/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", accept)
+	rec := httptest.NewRecorder()
+	loginHandler(rec, req)
+	return rec
+}
+
+func TestLogin(t *testing.T) {
+	useAuth(t, map[string]string{"jason": "jason-password", "root": "root-password"}, "root")
+
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		status   int
+		roles    []string
+	}{
+		{"user", "jason", "jason-password", http.StatusOK, []string{"user"}},
+		{"admin", "root", "root-password", http.StatusOK, []string{"user", "admin"}},
+		{"wrong password", "jason", "root-password", http.StatusUnauthorized, nil},
+		{"wrong password of an admin", "root", "admin", http.StatusUnauthorized, nil},
+		{"unknown user", "admin", "jason-password", http.StatusUnauthorized, nil},
+		{"username with spaces", "  jason ", "jason-password", http.StatusOK, []string{"user"}},
+		{"no password", "jason", "", http.StatusBadRequest, nil},
+		{"no username", "", "jason-password", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := login(tt.user, tt.password, "application/json")
+			if rec.Code != tt.status {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status != http.StatusOK {
+				if strings.Contains(rec.Body.String(), "token") {
+					t.Errorf("a rejected login got a token: %s", rec.Body)
+				}
+				return
+			}
+
+			var body struct {
+				User  string `json:"user"`
+				Token string `json:"token"`
+			}
+			json.NewDecoder(rec.Body).Decode(&body)
+			claims, err := tokenIssuer.Verify(body.Token)
+			if err != nil {
+				t.Fatalf("verifying the issued token: %v", err)
+			}
+			if body.User != strings.TrimSpace(tt.user) || claims.Subject != body.User || !reflect.DeepEqual(claims.Roles, tt.roles) {
+				t.Errorf("got user %q, subject %q and roles %v, want roles %v", body.User, claims.Subject, claims.Roles, tt.roles)
+			}
+		})
+	}
+}
+
+func TestLoginSetsSessionCookie(t *testing.T) {
+	useAuth(t, map[string]string{"jason": "jason-password"})
+
+	rec := login("jason", "jason-password", "text/html")
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusSeeOther)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != sessionCookie {
+		t.Fatalf("got cookies %v", cookies)
+	}
+
+	req := httptest.NewRequest("GET", "/productpage", nil)
+	req.AddCookie(cookies[0])
+	if user, token := sessionUser(req); user != "jason" || token != cookies[0].Value {
+		t.Errorf("got session user %q", user)
+	}
+
+	if rec := login("jason", "wrong", "text/html"); rec.Code != http.StatusUnauthorized || len(rec.Result().Cookies()) != 0 {
+		t.Errorf("got status %d and cookies %v for a wrong password", rec.Code, rec.Result().Cookies())
+	}
+}
+
+func TestLoginDisabled(t *testing.T) {
+	// Sem arquivo de usuários
+	useAuth(t, nil)
+	credentials = nil
+	if rec := login("admin", "admin", "application/json"); rec.Code != http.StatusNotImplemented {
+		t.Errorf("got status %d without users, want %d", rec.Code, http.StatusNotImplemented)
+	}
+
+	// Sem chave para assinar os tokens
+	useAuth(t, map[string]string{"admin": "admin"})
+	tokenIssuer = nil
+	if rec := login("admin", "admin", "application/json"); rec.Code != http.StatusNotImplemented {
+		t.Errorf("got status %d without a signing key, want %d", rec.Code, http.StatusNotImplemented)
+	}
+}
+
+func TestSessionUserOnlyTrustsVerifiedTokens(t *testing.T) {
+	withCookie := func(value string) *http.Request {
+		req := httptest.NewRequest("GET", "/productpage", nil)
+		req.AddCookie(&http.Cookie{Name: sessionCookie, Value: value})
+		return req
+	}
+
+	// Sem emissor configurado o cookie não identifica ninguém
+	previous := tokenIssuer
+	tokenIssuer = nil
+	if user, token := sessionUser(withCookie("admin")); user != "" || token != "" {
+		t.Errorf("got user %q from a raw cookie without auth", user)
+	}
+	tokenIssuer = previous
+
+	useAuth(t, map[string]string{"jason": "jason-password"})
+	forged, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		Roles:            []string{"user", "admin"},
+		RegisteredClaims: jwt.RegisteredClaims{Subject: "admin"},
+	}).SignedString([]byte("another-secret"))
+	unsigned, _ := jwt.NewWithClaims(jwt.SigningMethodNone, Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: "admin"},
+	}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	for name, value := range map[string]string{"raw user name": "admin", "forged token": forged, "unsigned token": unsigned} {
+		if user, token := sessionUser(withCookie(value)); user != "" || token != "" {
+			t.Errorf("%s: got user %q", name, user)
+		}
+	}
+
+	token, _ := tokenIssuer.Issue("jason")
+	if user, _ := sessionUser(withCookie(token)); user != "jason" {
+		t.Errorf("got user %q from a token issued here", user)
+	}
+}
+
+func TestLoadCredentials(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "users.yaml")
+	os.WriteFile(path, []byte("jason: "+string(hash)+"\n"), 0o600)
+	store, err := loadCredentials(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !store.check("jason", "secret") || store.check("jason", "Secret") || store.check("root", "secret") {
+		t.Error("credentials checked wrongly")
+	}
+
+	plain := filepath.Join(dir, "plain.yaml")
+	os.WriteFile(plain, []byte("jason: secret\n"), 0o600)
+	if _, err := loadCredentials(plain); err == nil {
+		t.Error("expected an error for a password that is not hashed")
+	}
+	if _, err := loadCredentials(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("expected an error for a missing users file")
+	}
+}
+
+func TestNoAdminsByDefault(t *testing.T) {
+	if admins := defaultConfig().AdminUsers; len(admins) != 0 {
+		t.Errorf("got default admins %v, want none", admins)
+	}
+}
@@ -0,0 +1,158 @@
+package productpage
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Catálogo padrão embutido no binário, usado quando PRODUCTS_FILE não é definido
+//
+//go:embed data/products.json
+var defaultCatalog []byte
+
+// Catalog guarda os produtos exibidos pela productpage, indexados por ID
+type Catalog struct {
+	mu        sync.RWMutex
+	products  []Product
+	byID      map[int]Product
+	listeners []func([]Product)
+
+	// Data de modificação do arquivo lido por loadCatalog, de onde watch parte
+	modTime time.Time
+}
+
+// loadCatalog lê o catálogo do arquivo JSON ou YAML em path, ou do catálogo
+// embutido quando path é vazio
+func loadCatalog(path string) (*Catalog, error) {
+	catalog := &Catalog{}
+	var products []Product
+	if path != "" {
+		// A data é lida antes do conteúdo, para que uma modificação entre os
+		// dois ainda seja recarregada por watch
+		if info, err := os.Stat(path); err == nil {
+			catalog.modTime = info.ModTime()
+		}
+		var err error
+		if products, err = readCatalogFile(path); err != nil {
+			return nil, err
+		}
+	} else if err := json.Unmarshal(defaultCatalog, &products); err != nil {
+		return nil, fmt.Errorf("parsing embedded catalog: %w", err)
+	}
+
+	if err := catalog.set(products); err != nil {
+		return nil, err
+	}
+	return catalog, nil
+}
+
+// readCatalogFile lê um catálogo em YAML quando a extensão do arquivo é .yaml
+// ou .yml, e em JSON nos demais casos
+func readCatalogFile(path string) ([]Product, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading catalog %s: %w", path, err)
+	}
+	var products []Product
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &products)
+	default:
+		err = json.Unmarshal(data, &products)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing catalog: %w", err)
+	}
+	return products, nil
+}
+
+// watch recarrega o catálogo sempre que o arquivo em path for modificado
+func (c *Catalog) watch(path string, interval time.Duration) {
+	lastMod := c.modTime
+	for range time.Tick(interval) {
+		lastMod = c.reload(path, lastMod)
+	}
+}
+
+// reload relê o arquivo em path se ele foi modificado depois de lastMod e
+// devolve a data de modificação vista. Erros de leitura são registrados e o
+// catálogo atual é mantido até a próxima modificação.
+func (c *Catalog) reload(path string, lastMod time.Time) time.Time {
+	info, err := os.Stat(path)
+	if err != nil || !info.ModTime().After(lastMod) {
+		return lastMod
+	}
+
+	products, err := readCatalogFile(path)
+	if err == nil {
+		err = c.set(products)
+	}
+	if err != nil {
+		log.Printf("Could not reload product catalog: %v", err)
+	} else {
+		log.Printf("Product catalog reloaded from %s (%d products)", path, len(products))
+	}
+	return info.ModTime()
+}
+
+// OnChange registra uma função chamada com os produtos atuais agora e a cada
+// vez que o catálogo for substituído
+func (c *Catalog) OnChange(listener func([]Product)) {
+	c.mu.Lock()
+	c.listeners = append(c.listeners, listener)
+	c.mu.Unlock()
+
+	listener(c.Products())
+}
+
+func (c *Catalog) set(products []Product) error {
+	byID := make(map[int]Product, len(products))
+	for _, product := range products {
+		if _, exists := byID[product.ID]; exists {
+			return fmt.Errorf("duplicate product id %d in catalog", product.ID)
+		}
+		byID[product.ID] = product
+	}
+
+	sorted := make([]Product, len(products))
+	copy(sorted, products)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	c.mu.Lock()
+	c.products = sorted
+	c.byID = byID
+	listeners := c.listeners
+	c.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener(c.Products())
+	}
+	return nil
+}
+
+// Products devolve todos os produtos ordenados por ID
+func (c *Catalog) Products() []Product {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	products := make([]Product, len(c.products))
+	copy(products, c.products)
+	return products
+}
+
+// Product busca um produto pelo ID
+func (c *Catalog) Product(id int) (Product, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	product, ok := c.byID[id]
+	return product, ok
+}
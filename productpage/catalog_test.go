@@ -0,0 +1,179 @@
+package productpage
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeCatalog grava content em path com a data de modificação informada, para
+// que recargas seguidas não dependam da resolução do relógio do sistema
+func writeCatalog(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func titles(products []Product) []string {
+	var titles []string
+	for _, product := range products {
+		titles = append(titles, product.Title)
+	}
+	return titles
+}
+
+func TestLoadCatalog(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now()
+
+	tests := []struct {
+		file    string
+		content string
+		want    []string
+	}{
+		{"products.json", `[{"id": 2, "title": "B"}, {"id": 1, "title": "A", "descriptionHtml": "<b>a</b>"}]`, []string{"A", "B"}},
+		{"products.yaml", "- id: 2\n  title: B\n- id: 1\n  title: A\n  descriptionHtml: <b>a</b>\n", []string{"A", "B"}},
+		{"products.YML", "- id: 1\n  title: A\n  descriptionHtml: <b>a</b>\n", []string{"A"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			path := filepath.Join(dir, tt.file)
+			writeCatalog(t, path, tt.content, start)
+
+			catalog, err := loadCatalog(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := titles(catalog.Products()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got products %v, want %v", got, tt.want)
+			}
+			if product, ok := catalog.Product(1); !ok || product.DescriptionHtml != "<b>a</b>" {
+				t.Errorf("got product 1 %+v, %v", product, ok)
+			}
+		})
+	}
+
+	for name, content := range map[string]string{
+		"duplicate.json": `[{"id": 1, "title": "A"}, {"id": 1, "title": "B"}]`,
+		"invalid.yaml":   "id: [1",
+		"yaml.json":      "- id: 1\n  title: A\n",
+	} {
+		path := filepath.Join(dir, name)
+		writeCatalog(t, path, content, start)
+		if _, err := loadCatalog(path); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	if _, err := loadCatalog(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("expected an error for a missing catalog")
+	}
+
+	catalog, err := loadCatalog("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if product, ok := catalog.Product(0); !ok || product.Title != "The Comedy of Errors" {
+		t.Errorf("got product 0 %+v from the embedded catalog", product)
+	}
+}
+
+func TestCatalogReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "products.yaml")
+	start := time.Now().Add(-time.Hour)
+	writeCatalog(t, path, "- id: 1\n  title: A\n", start)
+
+	catalog, err := loadCatalog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var notified [][]string
+	catalog.OnChange(func(products []Product) {
+		notified = append(notified, titles(products))
+	})
+	if want := [][]string{{"A"}}; !reflect.DeepEqual(notified, want) {
+		t.Fatalf("got notifications %v on registering, want %v", notified, want)
+	}
+
+	// Sem modificação o arquivo não é relido
+	lastMod := catalog.reload(path, start)
+	if !lastMod.Equal(start) || len(notified) != 1 {
+		t.Fatalf("reloaded an unchanged catalog")
+	}
+
+	writeCatalog(t, path, "- id: 1\n  title: A\n- id: 2\n  title: B\n", start.Add(time.Minute))
+	lastMod = catalog.reload(path, lastMod)
+	if got := titles(catalog.Products()); !reflect.DeepEqual(got, []string{"A", "B"}) {
+		t.Errorf("got products %v after the change", got)
+	}
+	if want := [][]string{{"A"}, {"A", "B"}}; !reflect.DeepEqual(notified, want) {
+		t.Errorf("got notifications %v, want %v", notified, want)
+	}
+
+	// Um arquivo inválido mantém o catálogo anterior e não notifica ninguém
+	for i, content := range []string{"- id: [", "- id: 3\n  title: C\n- id: 3\n  title: D\n"} {
+		writeCatalog(t, path, content, start.Add(time.Duration(2+i)*time.Minute))
+		lastMod = catalog.reload(path, lastMod)
+		if got := titles(catalog.Products()); !reflect.DeepEqual(got, []string{"A", "B"}) {
+			t.Errorf("got products %v after an invalid change", got)
+		}
+		if _, ok := catalog.Product(3); ok {
+			t.Error("product 3 of an invalid catalog was loaded")
+		}
+	}
+	if len(notified) != 2 {
+		t.Errorf("got %d notifications after invalid changes, want 2", len(notified))
+	}
+
+	// Um arquivo removido também mantém o catálogo
+	os.Remove(path)
+	if catalog.reload(path, lastMod); len(catalog.Products()) != 2 {
+		t.Error("lost the catalog when its file was removed")
+	}
+
+	// O arquivo corrigido volta a ser carregado
+	writeCatalog(t, path, "- id: 3\n  title: C\n", start.Add(10*time.Minute))
+	catalog.reload(path, lastMod)
+	if got := titles(catalog.Products()); !reflect.DeepEqual(got, []string{"C"}) {
+		t.Errorf("got products %v after fixing the file", got)
+	}
+	if last := notified[len(notified)-1]; !reflect.DeepEqual(last, []string{"C"}) || len(notified) != 3 {
+		t.Errorf("got notifications %v after fixing the file", notified)
+	}
+	if _, ok := catalog.Product(1); ok {
+		t.Error("product 1 is still listed after being removed from the catalog")
+	}
+}
+
+func TestCatalogWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "products.json")
+	writeCatalog(t, path, `[{"id": 1, "title": "A"}]`, time.Now().Add(-time.Hour))
+
+	catalog, err := loadCatalog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := make(chan []Product, 10)
+	catalog.OnChange(func(products []Product) { changed <- products })
+	<-changed
+
+	go catalog.watch(path, 10*time.Millisecond)
+	writeCatalog(t, path, `[{"id": 1, "title": "A"}, {"id": 2, "title": "B"}]`, time.Now())
+
+	select {
+	case products := <-changed:
+		if got := strings.Join(titles(products), ","); got != "A,B" {
+			t.Errorf("got products %s from the watcher", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the watcher did not reload the changed catalog")
+	}
+}
@@ -0,0 +1,12 @@
+// Command productpage serve a productpage; veja o pacote productpage.
+package main
+
+import (
+	"os"
+
+	"github.com/camilamedeir0s/bookinfo-go/productpage"
+)
+
+func main() {
+	productpage.Main(os.Args[1:])
+}
@@ -0,0 +1,373 @@
+package productpage
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/camilamedeir0s/bookinfo-go/ratelimit"
+	"gopkg.in/yaml.v3"
+)
+
+// Config é a configuração da productpage. Cada campo indica sua chave no YAML,
+// sua variável de ambiente e sua flag; a precedência está em loadConfig.
+type Config struct {
+	ConfigFile  string `yaml:"-" env:"CONFIG_FILE" flag:"config" help:"YAML configuration file"`
+	PrintConfig bool   `yaml:"-" flag:"print-config" help:"print the effective configuration and exit"`
+
+	Port              int           `yaml:"port" env:"PORT" flag:"port" help:"HTTP port"`
+	ServiceVersion    string        `yaml:"serviceVersion" env:"SERVICE_VERSION" flag:"service-version" help:"version shown in the topology"`
+	OpenAPIValidation string        `yaml:"openapiValidation" env:"OPENAPI_VALIDATION" flag:"openapi-validation" help:"off, warn or strict"`
+	RateLimits        string        `yaml:"rateLimits" env:"RATE_LIMITS" flag:"rate-limits" help:"per-route rate limits, e.g. *=100/s"`
+	TrustedProxies    []string      `yaml:"trustedProxies" env:"TRUSTED_PROXIES" flag:"trusted-proxies" help:"IPs or CIDRs of the proxies whose X-Forwarded-For gives the client IP; by default the client IP is the peer address"`
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout" env:"HTTP_READ_HEADER_TIMEOUT" flag:"read-header-timeout" help:"time allowed to read request headers"`
+	ReadTimeout       time.Duration `yaml:"readTimeout" env:"HTTP_READ_TIMEOUT" flag:"read-timeout" help:"time allowed to read a request"`
+	WriteTimeout      time.Duration `yaml:"writeTimeout" env:"HTTP_WRITE_TIMEOUT" flag:"write-timeout" help:"time allowed to write a response"`
+	IdleTimeout       time.Duration `yaml:"idleTimeout" env:"HTTP_IDLE_TIMEOUT" flag:"idle-timeout" help:"keep-alive connection idle timeout"`
+	DrainPeriod       time.Duration `yaml:"drainPeriod" env:"DRAIN_PERIOD" flag:"drain-period" help:"time /health fails before connections are drained"`
+	ShutdownTimeout   time.Duration `yaml:"shutdownTimeout" env:"SHUTDOWN_TIMEOUT" flag:"shutdown-timeout" help:"time allowed for in-flight requests on shutdown"`
+
+	ServicesDomain  string `yaml:"servicesDomain" env:"SERVICES_DOMAIN" flag:"services-domain" help:"suffix added to the upstream hostnames"`
+	DetailsHostname string `yaml:"detailsHostname" env:"DETAILS_HOSTNAME" flag:"details-hostname" help:"host of the details service"`
+	DetailsPort     int    `yaml:"detailsPort" env:"DETAILS_SERVICE_PORT" flag:"details-port" help:"HTTP port of the details service"`
+	DetailsGRPCPort int    `yaml:"detailsGrpcPort" env:"DETAILS_GRPC_PORT" flag:"details-grpc-port" help:"gRPC port of the details service, on the host of each discovered endpoint"`
+	ReviewsHostname string `yaml:"reviewsHostname" env:"REVIEWS_HOSTNAME" flag:"reviews-hostname" help:"host of the reviews service"`
+	ReviewsPort     int    `yaml:"reviewsPort" env:"REVIEWS_SERVICE_PORT" flag:"reviews-port" help:"HTTP port of the reviews service"`
+	ReviewsGRPCPort int    `yaml:"reviewsGrpcPort" env:"REVIEWS_GRPC_PORT" flag:"reviews-grpc-port" help:"gRPC port of the reviews service, on the host of each discovered endpoint"`
+	RatingsHostname string `yaml:"ratingsHostname" env:"RATINGS_HOSTNAME" flag:"ratings-hostname" help:"host of the ratings service"`
+	RatingsPort     int    `yaml:"ratingsPort" env:"RATINGS_SERVICE_PORT" flag:"ratings-port" help:"HTTP port of the ratings service"`
+	ClientProtocol  string `yaml:"clientProtocol" env:"CLIENT_PROTOCOL" flag:"client-protocol" help:"protocol used to call details and reviews: http or grpc"`
+
+	Discovery                  string        `yaml:"discovery" env:"DISCOVERY" flag:"discovery" help:"how upstream endpoints are found: static, dns-srv or file"`
+	ClusterName                string        `yaml:"clusterName" env:"CLUSTER_NAME" flag:"cluster-name" help:"cluster of this productpage; endpoints tagged with other clusters are used only when no local one is healthy"`
+	Zone                       string        `yaml:"zone" env:"ZONE" flag:"zone" help:"zone of this productpage, preferred among the endpoints of its cluster"`
+	DetailsEndpoints           []string      `yaml:"detailsEndpoints" env:"DETAILS_ENDPOINTS" flag:"details-endpoints" help:"static details endpoints, instead of detailsHostname and detailsPort"`
+	ReviewsEndpoints           []string      `yaml:"reviewsEndpoints" env:"REVIEWS_ENDPOINTS" flag:"reviews-endpoints" help:"static reviews endpoints, instead of reviewsHostname and reviewsPort"`
+	RatingsEndpoints           []string      `yaml:"ratingsEndpoints" env:"RATINGS_ENDPOINTS" flag:"ratings-endpoints" help:"static ratings endpoints, instead of ratingsHostname and ratingsPort"`
+	DNSSRVPortName             string        `yaml:"dnsSrvPortName" env:"DNS_SRV_PORT_NAME" flag:"dns-srv-port-name" help:"port name of the SRV records, as in _http._tcp.<host>"`
+	DiscoveryFile              string        `yaml:"discoveryFile" env:"DISCOVERY_FILE" flag:"discovery-file" help:"YAML or JSON file listing the endpoints of each upstream"`
+	DiscoveryRefresh           time.Duration `yaml:"discoveryRefresh" env:"DISCOVERY_REFRESH" flag:"discovery-refresh" help:"how often dns-srv and file endpoints are refreshed"`
+	LoadBalancer               string        `yaml:"loadBalancer" env:"LOAD_BALANCER" flag:"load-balancer" help:"round-robin or least-requests"`
+	UpstreamRetries            int           `yaml:"upstreamRetries" env:"UPSTREAM_RETRIES" flag:"upstream-retries" help:"times a request is retried on another endpoint after a connection error"`
+	OutlierConsecutiveFailures int           `yaml:"outlierConsecutiveFailures" env:"OUTLIER_CONSECUTIVE_FAILURES" flag:"outlier-consecutive-failures" help:"failures in a row before an endpoint is ejected, 0 to disable"`
+	OutlierEjectionTime        time.Duration `yaml:"outlierEjectionTime" env:"OUTLIER_EJECTION_TIME" flag:"outlier-ejection-time" help:"base ejection time, multiplied by the number of ejections"`
+	OutlierMaxEjectionPercent  int           `yaml:"outlierMaxEjectionPercent" env:"OUTLIER_MAX_EJECTION_PERCENT" flag:"outlier-max-ejection-percent" help:"most endpoints of an upstream ejected at once, in percent"`
+
+	TopologyProbeInterval time.Duration `yaml:"topologyProbeInterval" env:"TOPOLOGY_PROBE_INTERVAL" flag:"topology-probe-interval" help:"how often upstream health is probed for the topology, 0 to disable"`
+	VersionStatsWindow    time.Duration `yaml:"versionStatsWindow" env:"VERSION_STATS_WINDOW" flag:"version-stats-window" help:"time covered by the reviews version distribution"`
+
+	ProductsFile string `yaml:"productsFile" env:"PRODUCTS_FILE" flag:"products-file" help:"JSON or YAML product catalog, reloaded when it changes"`
+
+	JWTHMACSecret     string   `yaml:"jwtHmacSecret" env:"JWT_HMAC_SECRET" flag:"jwt-hmac-secret" help:"secret for HS256 login tokens" secret:"true"`
+	JWTPrivateKeyFile string   `yaml:"jwtPrivateKeyFile" env:"JWT_PRIVATE_KEY_FILE" flag:"jwt-private-key-file" help:"PEM RSA key for RS256 login tokens"`
+	JWTKeyID          string   `yaml:"jwtKeyId" env:"JWT_KEY_ID" flag:"jwt-key-id" help:"kid header of the login tokens"`
+	JWTIssuer         string   `yaml:"jwtIssuer" env:"JWT_ISSUER" flag:"jwt-issuer" help:"iss claim of the login tokens"`
+	AdminUsers        []string `yaml:"adminUsers" env:"ADMIN_USERS" flag:"admin-users" help:"comma separated users that get the admin role"`
+	UsersFile         string   `yaml:"usersFile" env:"USERS_FILE" flag:"users-file" help:"YAML map of the users allowed to log in to their bcrypt password hashes"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		Port:              8083,
+		ServiceVersion:    "v1",
+		OpenAPIValidation: "warn",
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		DrainPeriod:       5 * time.Second,
+		ShutdownTimeout:   15 * time.Second,
+		DetailsHostname:   "details-go",
+		DetailsPort:       9084,
+		DetailsGRPCPort:   9094,
+		ReviewsHostname:   "reviews-go",
+		ReviewsPort:       9086,
+		ReviewsGRPCPort:   9096,
+		RatingsHostname:   "ratings-go",
+		RatingsPort:       8085,
+		ClientProtocol:    "http",
+
+		Discovery:                  "static",
+		DNSSRVPortName:             "http",
+		DiscoveryRefresh:           10 * time.Second,
+		LoadBalancer:               "round-robin",
+		UpstreamRetries:            1,
+		OutlierConsecutiveFailures: 5,
+		OutlierEjectionTime:        30 * time.Second,
+		OutlierMaxEjectionPercent:  50,
+
+		TopologyProbeInterval: 10 * time.Second,
+		VersionStatsWindow:    5 * time.Minute,
+
+		JWTKeyID: "productpage",
+	}
+}
+
+func (c Config) validate() error {
+	ports := map[string]int{
+		"port":            c.Port,
+		"detailsPort":     c.DetailsPort,
+		"detailsGrpcPort": c.DetailsGRPCPort,
+		"reviewsPort":     c.ReviewsPort,
+		"reviewsGrpcPort": c.ReviewsGRPCPort,
+		"ratingsPort":     c.RatingsPort,
+	}
+	for name, port := range ports {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("%s must be between 1 and 65535, got %d", name, port)
+		}
+	}
+	switch c.OpenAPIValidation {
+	case "off", "warn", "strict":
+	default:
+		return fmt.Errorf("openapiValidation must be one of: off, warn, strict")
+	}
+	if c.ClientProtocol != "http" && c.ClientProtocol != "grpc" {
+		return errors.New("clientProtocol must be http or grpc")
+	}
+	switch c.Discovery {
+	case "static", "dns-srv":
+	case "file":
+		if c.DiscoveryFile == "" {
+			return errors.New("discoveryFile is required when discovery is file")
+		}
+	default:
+		return errors.New("discovery must be one of: static, dns-srv, file")
+	}
+	for name, endpoints := range map[string][]string{"detailsEndpoints": c.DetailsEndpoints, "reviewsEndpoints": c.ReviewsEndpoints, "ratingsEndpoints": c.RatingsEndpoints} {
+		for _, spec := range endpoints {
+			url, _ := parseEndpoint(spec)
+			if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+				return fmt.Errorf("%s: %q is not [cluster[/zone]=]http(s)://host:port", name, spec)
+			}
+		}
+	}
+	if c.Zone != "" && c.ClusterName == "" {
+		return errors.New("zone requires clusterName")
+	}
+	if c.DiscoveryRefresh <= 0 {
+		return errors.New("discoveryRefresh must be positive")
+	}
+	if c.LoadBalancer != "round-robin" && c.LoadBalancer != "least-requests" {
+		return errors.New("loadBalancer must be round-robin or least-requests")
+	}
+	if c.UpstreamRetries < 0 {
+		return errors.New("upstreamRetries must not be negative")
+	}
+	if c.OutlierConsecutiveFailures < 0 || c.OutlierMaxEjectionPercent < 0 || c.OutlierMaxEjectionPercent > 100 {
+		return errors.New("outlierConsecutiveFailures must not be negative and outlierMaxEjectionPercent must be between 0 and 100")
+	}
+	if c.TopologyProbeInterval < 0 {
+		return errors.New("topologyProbeInterval must not be negative")
+	}
+	if c.VersionStatsWindow <= 0 {
+		return errors.New("versionStatsWindow must be positive")
+	}
+	if _, err := ratelimit.ParseRules(c.RateLimits); err != nil {
+		return fmt.Errorf("rateLimits: %w", err)
+	}
+	for _, proxy := range c.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return fmt.Errorf("trustedProxies: %q is not an IP address or CIDR", proxy)
+		}
+	}
+	if c.DrainPeriod < 0 || c.ShutdownTimeout <= 0 {
+		return errors.New("drainPeriod must not be negative and shutdownTimeout must be positive")
+	}
+	if c.JWTHMACSecret != "" && c.JWTPrivateKeyFile != "" {
+		return errors.New("set only one of jwtHmacSecret and jwtPrivateKeyFile")
+	}
+	return nil
+}
+
+// upstreamURL monta o endereço HTTP de um serviço de backend
+func (c Config) upstreamURL(hostname string, port int) string {
+	return fmt.Sprintf("http://%s%s:%d", hostname, c.ServicesDomain, port)
+}
+
+// Configuração carregada em main
+var config = defaultConfig()
+
+// loadConfig monta a configuração a partir de, em ordem crescente de
+// precedência: os valores padrão, o arquivo YAML indicado por --config ou
+// CONFIG_FILE, as variáveis de ambiente e as flags. Um argumento posicional é
+// aceito como porta HTTP, como nas versões anteriores.
+func loadConfig(args []string) (Config, error) {
+	cfg := defaultConfig()
+	fields := configFields(reflect.ValueOf(&cfg).Elem())
+
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	flagged := map[string]string{}
+	for _, field := range fields {
+		name := field.tag.Get("flag")
+		isBool := field.value.Kind() == reflect.Bool
+		fs.Var(&flagValue{name: name, values: flagged, def: defaultString(field.value), isBool: isBool},
+			name, field.tag.Get("help")+envHint(field.tag.Get("env"), isBool))
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+	if fs.NArg() > 1 {
+		return cfg, fmt.Errorf("unexpected arguments: %v", fs.Args()[1:])
+	}
+
+	path := flagged["config"]
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, err
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return cfg, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	for _, field := range fields {
+		if name := field.tag.Get("env"); name != "" {
+			if value, exists := os.LookupEnv(name); exists {
+				if err := setField(field.value, value); err != nil {
+					return cfg, fmt.Errorf("%s: %w", name, err)
+				}
+			}
+		}
+	}
+
+	for _, field := range fields {
+		name := field.tag.Get("flag")
+		if value, exists := flagged[name]; exists {
+			if err := setField(field.value, value); err != nil {
+				return cfg, fmt.Errorf("--%s: %w", name, err)
+			}
+		}
+	}
+	if fs.NArg() == 1 {
+		if err := setField(reflect.ValueOf(&cfg.Port).Elem(), fs.Arg(0)); err != nil {
+			return cfg, fmt.Errorf("port argument: %w", err)
+		}
+	}
+
+	cfg.ConfigFile = path
+	return cfg, cfg.validate()
+}
+
+// printConfig escreve a configuração em YAML, no mesmo formato aceito como
+// arquivo por loadConfig. Campos marcados como secret são mascarados.
+func printConfig(w io.Writer, cfg Config) error {
+	for _, field := range configFields(reflect.ValueOf(&cfg).Elem()) {
+		if field.tag.Get("secret") == "true" && !field.value.IsZero() {
+			field.value.SetString("********")
+		}
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	return encoder.Encode(cfg)
+}
+
+type configField struct {
+	value reflect.Value
+	tag   reflect.StructTag
+}
+
+// configFields lista os campos configuráveis de cfg, incluindo os das structs
+// embutidas
+func configFields(cfg reflect.Value) []configField {
+	var fields []configField
+	for i := 0; i < cfg.NumField(); i++ {
+		field := cfg.Type().Field(i)
+		if field.Anonymous {
+			fields = append(fields, configFields(cfg.Field(i))...)
+			continue
+		}
+		fields = append(fields, configField{value: cfg.Field(i), tag: field.Tag})
+	}
+	return fields
+}
+
+func setField(field reflect.Value, value string) error {
+	switch {
+	case field.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	case field.Kind() == reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		field.SetInt(int64(n))
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		field.SetBool(b)
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", field.Type())
+	}
+	return nil
+}
+
+func defaultString(field reflect.Value) string {
+	if field.IsZero() {
+		return ""
+	}
+	if field.Kind() == reflect.Slice {
+		return strings.Join(field.Interface().([]string), ",")
+	}
+	return fmt.Sprint(field.Interface())
+}
+
+// envHint cita a variável de ambiente na ajuda da flag. Entre crases, o nome
+// também aparece como o argumento da flag.
+func envHint(name string, isBool bool) string {
+	switch {
+	case name == "":
+		return ""
+	case isBool:
+		return " (env " + name + ")"
+	}
+	return " (env `" + name + "`)"
+}
+
+// flagValue guarda o valor bruto da flag, para que as flags sejam aplicadas
+// depois do arquivo e do ambiente
+type flagValue struct {
+	name   string
+	values map[string]string
+	def    string
+	isBool bool
+}
+
+func (f *flagValue) String() string { return f.def }
+
+func (f *flagValue) Set(value string) error {
+	f.values[f.name] = value
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool { return f.isBool }
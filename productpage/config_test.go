@@ -0,0 +1,49 @@
+package productpage
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// useConfig substitui a configuração da productpage durante um teste
+func useConfig(t *testing.T, change func(*Config)) {
+	t.Helper()
+	previous := config
+	config = defaultConfig()
+	change(&config)
+	t.Cleanup(func() { config = previous })
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "productpage.yaml")
+	file := "detailsHostname: details.file\ndetailsPort: 7084\nadminUsers: [root]\n"
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DETAILS_SERVICE_PORT", "7184")
+	t.Setenv("SERVICES_DOMAIN", ".bookinfo.svc")
+
+	cfg, err := loadConfig([]string{"--config", path, "--admin-users", "alice, bob", "9083"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := cfg.upstreamURL(cfg.DetailsHostname, cfg.DetailsPort); got != "http://details.file.bookinfo.svc:7184" {
+		t.Errorf("got details URL %s", got)
+	}
+	if !reflect.DeepEqual(cfg.AdminUsers, []string{"alice", "bob"}) {
+		t.Errorf("got admin users %v", cfg.AdminUsers)
+	}
+	if cfg.Port != 9083 {
+		t.Errorf("got port %d, want the positional 9083", cfg.Port)
+	}
+
+	if _, err := loadConfig([]string{"--jwt-hmac-secret=a", "--jwt-private-key-file=b"}); err == nil {
+		t.Error("expected an error with two signing keys")
+	}
+	if _, err := loadConfig([]string{"--trusted-proxies=proxy.local"}); err == nil {
+		t.Error("expected an error for a trusted proxy that is not an IP or CIDR")
+	}
+}
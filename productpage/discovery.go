@@ -0,0 +1,535 @@
+package productpage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Resolver descobre os endpoints (URLs base, como "http://10.0.0.7:9084") de um
+// serviço de backend. Cada endpoint pode vir marcado com sua localidade, no
+// formato "cluster[/zona]=url", como em "east/east-1a=http://10.0.0.7:9084".
+type Resolver interface {
+	Resolve(ctx context.Context) ([]string, error)
+}
+
+// staticResolver devolve sempre a mesma lista de endpoints
+type staticResolver []string
+
+func (r staticResolver) Resolve(context.Context) ([]string, error) {
+	return r, nil
+}
+
+// srvResolver consulta registros DNS SRV, como os que o Kubernetes publica para
+// serviços headless: _<porta>._tcp.<serviço>.<namespace>.svc.cluster.local
+type srvResolver struct {
+	service string
+	name    string
+	lookup  func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+func (r srvResolver) Resolve(ctx context.Context) ([]string, error) {
+	_, records, err := r.lookup(ctx, r.service, "tcp", r.name)
+	if err != nil {
+		return nil, err
+	}
+	endpoints := make([]string, 0, len(records))
+	for _, record := range records {
+		endpoints = append(endpoints, fmt.Sprintf("http://%s:%d", strings.TrimSuffix(record.Target, "."), record.Port))
+	}
+	return endpoints, nil
+}
+
+// fileResolver lê os endpoints de um arquivo YAML (ou JSON) com uma lista por
+// serviço, por exemplo:
+//
+//	details: ["http://details-v1:9084", "http://details-v2:9084"]
+//	reviews:
+//	  - "east=http://reviews.east:9086"
+//	  - {url: "http://reviews.west:9086", cluster: west, zone: west-1a}
+//
+// O arquivo só é relido quando sua data de modificação muda.
+type fileResolver struct {
+	path     string
+	upstream string
+
+	mu        sync.Mutex
+	modTime   time.Time
+	endpoints []string
+}
+
+func (r *fileResolver) Resolve(context.Context) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.ModTime().After(r.modTime) {
+		return r.endpoints, nil
+	}
+
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return nil, err
+	}
+	var upstreams map[string][]fileEndpoint
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(&upstreams); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", r.path, err)
+	}
+
+	r.modTime = info.ModTime()
+	r.endpoints = make([]string, len(upstreams[r.upstream]))
+	for i, ep := range upstreams[r.upstream] {
+		r.endpoints[i] = string(ep)
+	}
+	return r.endpoints, nil
+}
+
+// fileEndpoint aceita no arquivo de descoberta tanto o texto "cluster=url"
+// quanto um objeto com url, cluster e zone
+type fileEndpoint string
+
+func (e *fileEndpoint) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*e = fileEndpoint(node.Value)
+		return nil
+	}
+	var object struct {
+		URL     string `yaml:"url"`
+		Cluster string `yaml:"cluster"`
+		Zone    string `yaml:"zone"`
+	}
+	if err := node.Decode(&object); err != nil {
+		return err
+	}
+	if object.URL == "" {
+		return fmt.Errorf("line %d: endpoint without url", node.Line)
+	}
+	*e = fileEndpoint(locality{object.Cluster, object.Zone}.tag(object.URL))
+	return nil
+}
+
+// locality é o cluster e a zona de um endpoint ou da própria productpage
+type locality struct {
+	cluster string
+	zone    string
+}
+
+// tag escreve url com o prefixo de localidade, se houver
+func (l locality) tag(url string) string {
+	switch {
+	case l.cluster == "":
+		return url
+	case l.zone == "":
+		return l.cluster + "=" + url
+	}
+	return l.cluster + "/" + l.zone + "=" + url
+}
+
+// parseEndpoint separa a localidade opcional da URL de um endpoint
+func parseEndpoint(spec string) (string, locality) {
+	tag, url, tagged := strings.Cut(spec, "=")
+	if !tagged || strings.Contains(tag, "://") {
+		return spec, locality{}
+	}
+	cluster, zone, _ := strings.Cut(tag, "/")
+	return url, locality{cluster, zone}
+}
+
+// priority ordena os endpoints pela proximidade de local: 0 na mesma zona, 1
+// no mesmo cluster e 2 em outro cluster. Endpoints sem localidade contam como
+// locais, e sem o cluster local todos são iguais.
+func (l locality) priority(local locality) int {
+	switch {
+	case local.cluster == "" || l.cluster == "":
+		return 0
+	case l.cluster == local.cluster && (l.zone == "" || l.zone == local.zone):
+		return 0
+	case l.cluster == local.cluster:
+		return 1
+	}
+	return 2
+}
+
+// endpoint guarda o estado de balanceamento e de ejeção de um endpoint
+type endpoint struct {
+	url      string
+	inflight atomic.Int64
+
+	// Protegido por Upstream.mu, pois muda se a descoberta remarcar o endpoint
+	locality locality
+
+	// Protegidos por Upstream.mu
+	failures     int
+	ejections    int
+	ejectedUntil time.Time
+}
+
+// outlierPolicy controla a ejeção passiva: após Failures erros seguidos o
+// endpoint sai do balanceamento por EjectionTime, multiplicado pelo número de
+// ejeções anteriores. Nunca mais que MaxEjectionPercent dos endpoints de uma
+// localidade ficam de fora ao mesmo tempo, a menos que outra localidade ainda
+// tenha endpoints saudáveis para assumir o tráfego. Failures igual a zero
+// desliga a ejeção.
+type outlierPolicy struct {
+	Failures           int
+	EjectionTime       time.Duration
+	MaxEjectionPercent int
+}
+
+// Upstream é um serviço de backend com vários endpoints, escolhidos por round
+// robin ou pelo menor número de requisições em andamento. Com local definido,
+// só são usados os endpoints saudáveis mais próximos: os da mesma zona, depois
+// os do mesmo cluster e, se nenhum deles estiver saudável, os de outros
+// clusters.
+type Upstream struct {
+	name     string
+	resolver Resolver
+	balancer string
+	outlier  outlierPolicy
+	local    locality
+	now      func() time.Time
+
+	mu         sync.Mutex
+	endpoints  []*endpoint
+	next       int
+	failedOver bool
+}
+
+var errNoEndpoints = errors.New("no endpoints available")
+
+func newUpstream(name string, resolver Resolver, balancer string, outlier outlierPolicy) *Upstream {
+	u := &Upstream{name: name, resolver: resolver, balancer: balancer, outlier: outlier, now: time.Now}
+	if err := u.refresh(); err != nil {
+		log.Printf("Could not resolve %s endpoints: %v", name, err)
+	}
+	return u
+}
+
+// refresh consulta o resolver e substitui a lista de endpoints, preservando o
+// estado dos que continuam na lista. Em caso de erro a lista atual é mantida.
+func (u *Upstream) refresh() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	urls, err := u.resolver.Resolve(ctx)
+	if err != nil {
+		return err
+	}
+	if len(urls) == 0 {
+		return errNoEndpoints
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	current := make(map[string]*endpoint, len(u.endpoints))
+	for _, ep := range u.endpoints {
+		current[ep.url] = ep
+	}
+
+	endpoints := make([]*endpoint, 0, len(urls))
+	for _, spec := range urls {
+		url, locality := parseEndpoint(spec)
+		url = strings.TrimSuffix(url, "/")
+		ep, exists := current[url]
+		if !exists {
+			ep = &endpoint{url: url}
+		}
+		ep.locality = locality
+		endpoints = append(endpoints, ep)
+	}
+	sort.Slice(endpoints, func(i, j int) bool { return endpoints[i].url < endpoints[j].url })
+
+	if !sameEndpoints(u.endpoints, endpoints) {
+		log.Printf("%s endpoints: %s", u.name, strings.Join(endpointURLs(endpoints), ", "))
+	}
+	u.endpoints = endpoints
+	return nil
+}
+
+// watch atualiza os endpoints a cada interval
+func (u *Upstream) watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := u.refresh(); err != nil {
+			log.Printf("Could not resolve %s endpoints: %v", u.name, err)
+		}
+	}
+}
+
+// pick escolhe o endpoint da próxima requisição entre os não ejetados mais
+// próximos, ignorando os de skip, que já falharam nesta requisição. Se todos
+// estiverem ejetados, todos voltam a ser candidatos.
+func (u *Upstream) pick(skip ...*endpoint) (*endpoint, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := u.now()
+	var available, candidates []*endpoint
+	priority := 3
+	for _, ep := range u.endpoints {
+		if slices.Contains(skip, ep) {
+			continue
+		}
+		available = append(available, ep)
+		if now.Before(ep.ejectedUntil) {
+			continue
+		}
+		switch p := ep.locality.priority(u.local); {
+		case p < priority:
+			priority, candidates = p, []*endpoint{ep}
+		case p == priority:
+			candidates = append(candidates, ep)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = available
+	} else if failedOver := priority == 2; failedOver != u.failedOver {
+		u.failedOver = failedOver
+		if failedOver {
+			log.Printf("No healthy local %s endpoint, failing over to other clusters", u.name)
+		} else {
+			log.Printf("Using local %s endpoints again", u.name)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, errNoEndpoints
+	}
+
+	var chosen *endpoint
+	if u.balancer == "least-requests" {
+		// Em caso de empate, o round robin desempata
+		for i := range candidates {
+			ep := candidates[(u.next+i)%len(candidates)]
+			if chosen == nil || ep.inflight.Load() < chosen.inflight.Load() {
+				chosen = ep
+			}
+		}
+	} else {
+		chosen = candidates[u.next%len(candidates)]
+	}
+	u.next++
+
+	chosen.inflight.Add(1)
+	return chosen, nil
+}
+
+// done registra o fim de uma requisição em ep. Falhas seguidas levam à ejeção
+// do endpoint; um sucesso zera a contagem.
+func (u *Upstream) done(ep *endpoint, ok bool) {
+	ep.inflight.Add(-1)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if ok {
+		ep.failures = 0
+		return
+	}
+	ep.failures++
+	if u.outlier.Failures == 0 || ep.failures < u.outlier.Failures {
+		return
+	}
+
+	// O limite vale para a localidade de ep, e só quando não há para onde
+	// fazer o failover
+	now := u.now()
+	group, ejected := 0, 0
+	failover := false
+	for _, other := range u.endpoints {
+		isEjected := now.Before(other.ejectedUntil)
+		if other.locality != ep.locality {
+			failover = failover || !isEjected
+			continue
+		}
+		group++
+		if isEjected {
+			ejected++
+		}
+	}
+	if !failover && (ejected+1)*100 > u.outlier.MaxEjectionPercent*group {
+		return
+	}
+
+	ep.ejections++
+	ep.failures = 0
+	ep.ejectedUntil = now.Add(u.outlier.EjectionTime * time.Duration(ep.ejections))
+	log.Printf("Ejected %s endpoint %s until %s", u.name, ep.url, ep.ejectedUntil.Format(time.RFC3339))
+}
+
+// endpointState descreve um endpoint para a topologia
+type endpointState struct {
+	url      string
+	ejected  bool
+	locality locality
+}
+
+// states lista os endpoints atuais e se estão ejetados
+func (u *Upstream) states() []endpointState {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := u.now()
+	states := make([]endpointState, len(u.endpoints))
+	for i, ep := range u.endpoints {
+		states[i] = endpointState{url: ep.url, ejected: now.Before(ep.ejectedUntil), locality: ep.locality}
+	}
+	return states
+}
+
+func endpointURLs(endpoints []*endpoint) []string {
+	urls := make([]string, len(endpoints))
+	for i, ep := range endpoints {
+		urls[i] = ep.url
+	}
+	return urls
+}
+
+func sameEndpoints(a, b []*endpoint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].url != b[i].url {
+			return false
+		}
+	}
+	return true
+}
+
+// Serviços de backend chamados por HTTP, indexados pelo nome
+var upstreams map[string]*Upstream
+
+// setupUpstreams cria os upstreams conforme o modo de descoberta configurado
+// e, exceto no modo estático, mantém os endpoints atualizados em background
+func setupUpstreams() map[string]*Upstream {
+	hosts := map[string]struct {
+		hostname  string
+		port      int
+		endpoints []string
+	}{
+		"details": {config.DetailsHostname, config.DetailsPort, config.DetailsEndpoints},
+		"reviews": {config.ReviewsHostname, config.ReviewsPort, config.ReviewsEndpoints},
+		"ratings": {config.RatingsHostname, config.RatingsPort, config.RatingsEndpoints},
+	}
+	outlier := outlierPolicy{
+		Failures:           config.OutlierConsecutiveFailures,
+		EjectionTime:       config.OutlierEjectionTime,
+		MaxEjectionPercent: config.OutlierMaxEjectionPercent,
+	}
+
+	result := map[string]*Upstream{}
+	for name, host := range hosts {
+		var resolver Resolver
+		switch config.Discovery {
+		case "dns-srv":
+			resolver = srvResolver{
+				service: config.DNSSRVPortName,
+				name:    host.hostname + config.ServicesDomain,
+				lookup:  net.DefaultResolver.LookupSRV,
+			}
+		case "file":
+			resolver = &fileResolver{path: config.DiscoveryFile, upstream: name}
+		default:
+			endpoints := host.endpoints
+			if len(endpoints) == 0 {
+				endpoints = []string{config.upstreamURL(host.hostname, host.port)}
+			}
+			resolver = staticResolver(endpoints)
+		}
+
+		upstream := newUpstream(name, resolver, config.LoadBalancer, outlier)
+		upstream.local = locality{config.ClusterName, config.Zone}
+		if config.Discovery != "static" {
+			go upstream.watch(config.DiscoveryRefresh)
+		}
+		result[name] = upstream
+	}
+	return result
+}
+
+// upstreamGet faz um GET em path no serviço informado, escolhendo o endpoint
+// pelo balanceador. Erros de conexão e respostas 5xx contam como falhas para a
+// ejeção de outliers. Se a conexão não puder ser aberta e houver outros
+// endpoints, a requisição é repetida em um ainda não tentado, até
+// upstreamRetries vezes; assim ela chega a outro cluster antes mesmo de o
+// endpoint local ser ejetado.
+func upstreamGet(ctx context.Context, client *http.Client, name, path string, headers map[string]string) (*http.Response, error) {
+	upstream, exists := upstreams[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown upstream %s", name)
+	}
+
+	trace := traceFrom(ctx)
+	var call *TraceCall
+	var tried []*endpoint
+	var lastErr error
+	for attempt := 0; ; attempt++ {
+		ep, err := upstream.pick(tried...)
+		if err != nil && lastErr != nil {
+			// Não sobrou endpoint para repetir a requisição
+			trace.end(call, 0, 0, lastErr)
+			return nil, lastErr
+		}
+		if err != nil {
+			err = fmt.Errorf("%s: %w", name, err)
+			if call == nil {
+				call = trace.begin(name, "http", path)
+			}
+			trace.end(call, 0, 0, err)
+			return nil, err
+		}
+		if call == nil {
+			call = trace.begin(name, "http", ep.url+path)
+		} else {
+			trace.retry(call, ep.url+path)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "GET", ep.url+path, nil)
+		if err != nil {
+			upstream.done(ep, true)
+			trace.end(call, 0, 0, err)
+			return nil, err
+		}
+		for key, value := range headers {
+			req.Header.Add(key, value)
+		}
+
+		resp, err := client.Do(req)
+		upstream.done(ep, err == nil && resp.StatusCode < 500)
+		if err != nil {
+			if attempt < config.UpstreamRetries && isConnectError(err) {
+				tried, lastErr = append(tried, ep), err
+				continue
+			}
+			trace.end(call, 0, 0, err)
+			return nil, err
+		}
+
+		if trace != nil {
+			resp.Body = &tracedBody{ReadCloser: resp.Body, trace: trace, call: call, status: resp.StatusCode}
+		}
+		return resp, nil
+	}
+}
+
+// isConnectError indica se a requisição falhou antes de chegar ao serviço
+func isConnectError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
@@ -0,0 +1,344 @@
+package productpage
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+// picks devolve as URLs dos próximos n endpoints escolhidos, encerrando cada
+// requisição com ok
+func picks(t *testing.T, u *Upstream, n int, ok bool) []string {
+	t.Helper()
+	var urls []string
+	for i := 0; i < n; i++ {
+		ep, err := u.pick()
+		if err != nil {
+			t.Fatal(err)
+		}
+		urls = append(urls, ep.url)
+		u.done(ep, ok)
+	}
+	return urls
+}
+
+func TestRoundRobin(t *testing.T) {
+	u := newUpstream("details", staticResolver{"http://b:9084", "http://a:9084/"}, "round-robin", outlierPolicy{})
+
+	got := picks(t, u, 4, true)
+	want := []string{"http://a:9084", "http://b:9084", "http://a:9084", "http://b:9084"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestLeastRequests(t *testing.T) {
+	u := newUpstream("reviews", staticResolver{"http://a", "http://b", "http://c"}, "least-requests", outlierPolicy{})
+
+	busy, _ := u.pick()
+	busy.inflight.Add(5)
+	defer u.done(busy, true)
+
+	for _, url := range picks(t, u, 4, true) {
+		if url == busy.url {
+			t.Errorf("picked the busiest endpoint %s", url)
+		}
+	}
+}
+
+func TestOutlierEjection(t *testing.T) {
+	now := time.Unix(0, 0)
+	policy := outlierPolicy{Failures: 2, EjectionTime: 10 * time.Second, MaxEjectionPercent: 50}
+	u := newUpstream("ratings", staticResolver{"http://a", "http://b", "http://c", "http://d"}, "round-robin", policy)
+	u.now = func() time.Time { return now }
+
+	fail := func(url string) {
+		for _, ep := range u.endpoints {
+			if ep.url == url {
+				ep.inflight.Add(1)
+				u.done(ep, false)
+			}
+		}
+	}
+	fail("http://a")
+	fail("http://a")
+	fail("http://b")
+	fail("http://b")
+	// c seria o terceiro de quatro, acima do limite de 50%
+	fail("http://c")
+	fail("http://c")
+
+	for _, url := range picks(t, u, 4, true) {
+		if url == "http://a" || url == "http://b" {
+			t.Errorf("picked ejected endpoint %s", url)
+		}
+	}
+
+	now = now.Add(11 * time.Second)
+	seen := map[string]bool{}
+	for _, url := range picks(t, u, 4, true) {
+		seen[url] = true
+	}
+	if !seen["http://a"] || !seen["http://b"] {
+		t.Errorf("ejected endpoints did not come back: %v", seen)
+	}
+}
+
+func TestFileResolverReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "endpoints.yaml")
+	write := func(content string, modTime time.Time) {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("details: [http://details-v1:9084]\n", time.Unix(1000, 0))
+
+	u := newUpstream("details", &fileResolver{path: path, upstream: "details"}, "round-robin", outlierPolicy{})
+	if got := endpointURLs(u.endpoints); !reflect.DeepEqual(got, []string{"http://details-v1:9084"}) {
+		t.Fatalf("got %v", got)
+	}
+
+	write("details: [http://details-v1:9084, http://details-v2:9084]\n", time.Unix(2000, 0))
+	if err := u.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"http://details-v1:9084", "http://details-v2:9084"}
+	if got := endpointURLs(u.endpoints); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSRVResolver(t *testing.T) {
+	r := srvResolver{
+		service: "http",
+		name:    "details.bookinfo.svc",
+		lookup: func(_ context.Context, service, proto, name string) (string, []*net.SRV, error) {
+			if service != "http" || proto != "tcp" || name != "details.bookinfo.svc" {
+				t.Errorf("unexpected lookup _%s._%s.%s", service, proto, name)
+			}
+			return "", []*net.SRV{{Target: "10-0-0-7.details.bookinfo.svc.", Port: 9084}}, nil
+		},
+	}
+	got, err := r.Resolve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"http://10-0-0-7.details.bookinfo.svc:9084"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestParseEndpoint(t *testing.T) {
+	tests := []struct {
+		spec     string
+		url      string
+		locality locality
+	}{
+		{"http://a:9086", "http://a:9086", locality{}},
+		{"east=http://a:9086", "http://a:9086", locality{"east", ""}},
+		{"east/east-1a=http://a:9086", "http://a:9086", locality{"east", "east-1a"}},
+		{"http://a:9086/?x=1", "http://a:9086/?x=1", locality{}},
+	}
+	for _, tt := range tests {
+		url, locality := parseEndpoint(tt.spec)
+		if url != tt.url || locality != tt.locality {
+			t.Errorf("parseEndpoint(%q) = %q, %+v", tt.spec, url, locality)
+		}
+		if tt.locality.tag(tt.url) != tt.spec {
+			t.Errorf("tag gave %q, want %q", tt.locality.tag(tt.url), tt.spec)
+		}
+	}
+}
+
+func TestLocalityFailover(t *testing.T) {
+	now := time.Unix(0, 0)
+	policy := outlierPolicy{Failures: 1, EjectionTime: 10 * time.Second, MaxEjectionPercent: 100}
+	u := newUpstream("reviews", staticResolver{
+		"east/east-1a=http://a1",
+		"east/east-1a=http://a2",
+		"east/east-1b=http://b",
+		"west=http://w",
+	}, "round-robin", policy)
+	u.local = locality{"east", "east-1a"}
+	u.now = func() time.Time { return now }
+
+	only := func(want ...string) {
+		t.Helper()
+		for _, url := range picks(t, u, 4, true) {
+			if !slices.Contains(want, url) {
+				t.Errorf("picked %s, want one of %v", url, want)
+			}
+		}
+	}
+	eject := func(url string) {
+		for _, ep := range u.endpoints {
+			if ep.url == url {
+				ep.inflight.Add(1)
+				u.done(ep, false)
+			}
+		}
+	}
+
+	only("http://a1", "http://a2")
+	eject("http://a1")
+	only("http://a2")
+	eject("http://a2")
+	only("http://b")
+	eject("http://b")
+	only("http://w")
+	if !u.failedOver {
+		t.Error("failover to the west cluster was not noticed")
+	}
+
+	now = now.Add(11 * time.Second)
+	only("http://a1", "http://a2")
+	if u.failedOver {
+		t.Error("still failed over after the local endpoints came back")
+	}
+}
+
+func TestOutlierEjectionInTwoEndpointCluster(t *testing.T) {
+	now := time.Unix(0, 0)
+	policy := outlierPolicy{Failures: 1, EjectionTime: 10 * time.Second, MaxEjectionPercent: 50}
+	u := newUpstream("reviews", staticResolver{"east=http://a1", "east=http://a2", "west=http://w"}, "round-robin", policy)
+	u.local = locality{cluster: "east"}
+	u.now = func() time.Time { return now }
+
+	fail := func(url string) {
+		for _, ep := range u.endpoints {
+			if ep.url == url {
+				ep.inflight.Add(1)
+				u.done(ep, false)
+			}
+		}
+	}
+	ejected := func() []string {
+		var urls []string
+		for _, state := range u.states() {
+			if state.ejected {
+				urls = append(urls, state.url)
+			}
+		}
+		return urls
+	}
+
+	// Metade do cluster local pode ser ejetada
+	fail("http://a1")
+	if got := picks(t, u, 2, true); !reflect.DeepEqual(got, []string{"http://a2", "http://a2"}) {
+		t.Errorf("got %v with a1 failing, want only a2", got)
+	}
+
+	// O cluster inteiro também, já que o west assume o tráfego
+	fail("http://a2")
+	if got := picks(t, u, 2, true); !reflect.DeepEqual(got, []string{"http://w", "http://w"}) {
+		t.Errorf("got %v with the local cluster failing, want the west cluster", got)
+	}
+	if !u.failedOver {
+		t.Error("failover to the west cluster was not noticed")
+	}
+
+	// Sem outro cluster saudável, o limite volta a valer
+	fail("http://w")
+	if got := ejected(); !reflect.DeepEqual(got, []string{"http://a1", "http://a2"}) {
+		t.Errorf("got ejected %v, want the last healthy cluster kept", got)
+	}
+
+	// Sem localidades, um dos dois endpoints continua no balanceamento
+	now = now.Add(time.Minute)
+	u = newUpstream("reviews", staticResolver{"http://a", "http://b"}, "round-robin", policy)
+	u.now = func() time.Time { return now }
+	fail("http://a")
+	fail("http://b")
+	if got := ejected(); !reflect.DeepEqual(got, []string{"http://a"}) {
+		t.Errorf("got ejected %v, want only the first failing endpoint", got)
+	}
+}
+
+func TestLocalityIgnoredWithoutLocalCluster(t *testing.T) {
+	u := newUpstream("reviews", staticResolver{"east=http://a", "west=http://b"}, "round-robin", outlierPolicy{})
+
+	got := picks(t, u, 2, true)
+	if want := []string{"http://a", "http://b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestUpstreamGetRetriesInRemoteCluster(t *testing.T) {
+	useConfig(t, func(c *Config) { c.UpstreamRetries = 1 })
+
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"podname":"reviews-v1-west","clustername":"west"}`)
+	}))
+	defer remote.Close()
+
+	previous := upstreams
+	upstreams = map[string]*Upstream{
+		"reviews": newUpstream("reviews", staticResolver{"east=http://127.0.0.1:1", "west=" + remote.URL}, "round-robin", outlierPolicy{}),
+	}
+	upstreams["reviews"].local = locality{cluster: "east"}
+	defer func() { upstreams = previous }()
+
+	resp, err := upstreamGet(context.Background(), http.DefaultClient, "reviews", "/reviews/0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("got status %d from the remote cluster", resp.StatusCode)
+	}
+
+	// Sem outro endpoint para tentar, o erro de conexão é devolvido
+	upstreams["reviews"] = newUpstream("reviews", staticResolver{"http://127.0.0.1:1"}, "round-robin", outlierPolicy{})
+	if _, err := upstreamGet(context.Background(), http.DefaultClient, "reviews", "/reviews/0", nil); !isConnectError(err) {
+		t.Errorf("got %v, want the connection error", err)
+	}
+}
+
+func TestFileResolverLocality(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "endpoints.yaml")
+	file := `reviews:
+  - east=http://reviews.east:9086
+  - {url: "http://reviews.west:9086", cluster: west, zone: west-1a}
+  - http://reviews.local:9086
+`
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	u := newUpstream("reviews", &fileResolver{path: path, upstream: "reviews"}, "round-robin", outlierPolicy{})
+	got := map[string]locality{}
+	for _, state := range u.states() {
+		got[state.url] = state.locality
+	}
+	want := map[string]locality{
+		"http://reviews.east:9086":  {"east", ""},
+		"http://reviews.west:9086":  {"west", "west-1a"},
+		"http://reviews.local:9086": {},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestValidateEndpointSpecs(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.ReviewsEndpoints = []string{"east=http://reviews.east:9086", "west/west-1a=https://reviews.west"}
+	if err := cfg.validate(); err != nil {
+		t.Errorf("valid endpoints rejected: %v", err)
+	}
+	cfg.ReviewsEndpoints = []string{"east=reviews.east:9086"}
+	if err := cfg.validate(); err == nil {
+		t.Error("endpoint without scheme accepted")
+	}
+}
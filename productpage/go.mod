@@ -2,4 +2,33 @@ module github.com/camilamedeir0s/bookinfo-go/productpage
 
 go 1.22.4
 
-require github.com/gorilla/mux v1.8.1 // indirect
+require (
+	github.com/camilamedeir0s/bookinfo-go/bookinfopb v0.0.0-00010101000000-000000000000
+	github.com/camilamedeir0s/bookinfo-go/ratelimit v0.0.0-00010101000000-000000000000
+	github.com/getkin/kin-openapi v0.127.0
+	github.com/golang-jwt/jwt/v5 v5.2.2
+	github.com/gorilla/mux v1.8.1
+	golang.org/x/crypto v0.23.0
+	golang.org/x/text v0.15.0
+	google.golang.org/grpc v1.65.0
+	google.golang.org/protobuf v1.34.2
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/go-openapi/jsonpointer v0.21.0 // indirect
+	github.com/go-openapi/swag v0.23.0 // indirect
+	github.com/invopop/yaml v0.3.1 // indirect
+	github.com/josharian/intern v1.0.0 // indirect
+	github.com/mailru/easyjson v0.7.7 // indirect
+	github.com/mohae/deepcopy v0.0.0-20170929034955-c48cc78d4826 // indirect
+	github.com/perimeterx/marshmallow v1.1.5 // indirect
+	golang.org/x/net v0.25.0 // indirect
+	golang.org/x/sys v0.20.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240528184218-531527333157 // indirect
+)
+
+replace (
+	github.com/camilamedeir0s/bookinfo-go/bookinfopb => ../bookinfopb
+	github.com/camilamedeir0s/bookinfo-go/ratelimit => ../ratelimit
+)
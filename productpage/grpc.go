@@ -0,0 +1,240 @@
+package productpage
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/camilamedeir0s/bookinfo-go/bookinfopb"
+)
+
+// Conexões gRPC por endpoint, reaproveitadas entre as chamadas
+var (
+	grpcConnsMu sync.Mutex
+	grpcConns   = map[string]*grpc.ClientConn{}
+)
+
+// grpcConn devolve a conexão com target, criando-a no primeiro uso
+func grpcConn(target string) (*grpc.ClientConn, error) {
+	grpcConnsMu.Lock()
+	defer grpcConnsMu.Unlock()
+	if conn, exists := grpcConns[target]; exists {
+		return conn, nil
+	}
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	grpcConns[target] = conn
+	return conn, nil
+}
+
+// closeGRPCConns fecha as conexões gRPC, que voltam a ser criadas no próximo
+// uso
+func closeGRPCConns() {
+	grpcConnsMu.Lock()
+	defer grpcConnsMu.Unlock()
+	for target, conn := range grpcConns {
+		conn.Close()
+		delete(grpcConns, target)
+	}
+}
+
+// grpcTarget monta o alvo gRPC de um endpoint descoberto: cada instância atende
+// gRPC no mesmo host, na porta gRPC do serviço
+func grpcTarget(endpointURL string, port int) (string, error) {
+	u, err := url.Parse(endpointURL)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(u.Hostname(), strconv.Itoa(port)), nil
+}
+
+// grpcContext cria o contexto da chamada com os headers propagados como metadata
+func grpcContext(parent context.Context, headers map[string]string) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(parent, upstreamTimeout)
+	return metadata.NewOutgoingContext(ctx, metadata.New(headers)), cancel
+}
+
+// grpcHTTPStatus traduz o código gRPC para o status HTTP equivalente, para que
+// o restante da productpage trate os dois protocolos da mesma forma
+func grpcHTTPStatus(err error) int {
+	switch status.Code(err) {
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// upstreamGRPC é o equivalente gRPC de upstreamGet: o endpoint vem do mesmo
+// balanceador, respostas 5xx contam como falhas para a ejeção de outliers e uma
+// chamada que falha com Unavailable é repetida em um endpoint ainda não
+// tentado, até upstreamRetries vezes
+func upstreamGRPC[T proto.Message](ctx context.Context, name string, port int, method string, headers map[string]string, invoke func(context.Context, *grpc.ClientConn) (T, error)) (T, error) {
+	var zero T
+	upstream, exists := upstreams[name]
+	if !exists {
+		return zero, fmt.Errorf("unknown upstream %s", name)
+	}
+
+	trace := traceFrom(ctx)
+	var call *TraceCall
+	var tried []*endpoint
+	var lastErr error
+	for attempt := 0; ; attempt++ {
+		ep, err := upstream.pick(tried...)
+		if err != nil && lastErr != nil {
+			// Não sobrou endpoint para repetir a chamada
+			trace.end(call, grpcHTTPStatus(lastErr), 0, lastErr)
+			return zero, lastErr
+		}
+		if err != nil {
+			err = status.Errorf(codes.Unavailable, "%s: %v", name, err)
+			if call == nil {
+				call = trace.begin(name, "grpc", method)
+			}
+			trace.end(call, grpcHTTPStatus(err), 0, err)
+			return zero, err
+		}
+
+		target, err := grpcTarget(ep.url, port)
+		if call == nil {
+			call = trace.begin(name, "grpc", "grpc://"+target+method)
+		} else {
+			trace.retry(call, "grpc://"+target+method)
+		}
+		var conn *grpc.ClientConn
+		if err == nil {
+			conn, err = grpcConn(target)
+		}
+		if err != nil {
+			upstream.done(ep, true)
+			trace.end(call, 0, 0, err)
+			return zero, err
+		}
+
+		callCtx, cancel := grpcContext(ctx, headers)
+		resp, err := invoke(callCtx, conn)
+		cancel()
+		upstream.done(ep, grpcHTTPStatus(err) < 500)
+		if err != nil {
+			if attempt < config.UpstreamRetries && status.Code(err) == codes.Unavailable {
+				tried, lastErr = append(tried, ep), err
+				continue
+			}
+			trace.end(call, grpcHTTPStatus(err), 0, err)
+			return zero, err
+		}
+
+		if served, ok := any(resp).(interface {
+			GetPodname() string
+			GetClustername() string
+		}); ok {
+			trace.servedBy(call, served.GetPodname(), served.GetClustername())
+		}
+		trace.end(call, http.StatusOK, int64(proto.Size(resp)), nil)
+		return resp, nil
+	}
+}
+
+func getProductDetailsGRPC(ctx context.Context, productID int, headers map[string]string) Section[BookDetails] {
+	resp, err := upstreamGRPC(ctx, "details", config.DetailsGRPCPort, bookinfopb.Details_GetDetails_FullMethodName, headers,
+		func(ctx context.Context, conn *grpc.ClientConn) (*bookinfopb.BookDetails, error) {
+			return bookinfopb.NewDetailsClient(conn).GetDetails(ctx, &bookinfopb.GetDetailsRequest{ProductId: int32(productID)})
+		})
+	if err != nil {
+		fmt.Println("Error making gRPC request:", err)
+		return Section[BookDetails]{Status: grpcHTTPStatus(err), Error: status.Convert(err).Message()}
+	}
+
+	return Section[BookDetails]{Status: http.StatusOK, Data: &BookDetails{
+		ID:        int(resp.GetId()),
+		Author:    resp.GetAuthor(),
+		Year:      int(resp.GetYear()),
+		Type:      resp.GetType(),
+		Pages:     int(resp.GetPages()),
+		Publisher: resp.GetPublisher(),
+		Language:  resp.GetLanguage(),
+		ISBN10:    resp.GetIsbn_10(),
+		ISBN13:    resp.GetIsbn_13(),
+	}}
+}
+
+func getProductReviewsGRPC(ctx context.Context, productID int, query url.Values, headers map[string]string) Section[ReviewData] {
+	req := &bookinfopb.GetReviewsRequest{
+		ProductId: int32(productID),
+		Cursor:    query.Get("cursor"),
+		Sort:      query.Get("sort"),
+	}
+	for param, field := range map[string]*int32{"page": &req.Page, "pageSize": &req.PageSize, "minStars": &req.MinStars} {
+		if value := query.Get(param); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return Section[ReviewData]{Status: http.StatusBadRequest, Error: param + " must be a number"}
+			}
+			*field = int32(n)
+		}
+	}
+
+	resp, err := upstreamGRPC(ctx, "reviews", config.ReviewsGRPCPort, bookinfopb.Reviews_GetReviews_FullMethodName, headers,
+		func(ctx context.Context, conn *grpc.ClientConn) (*bookinfopb.GetReviewsResponse, error) {
+			return bookinfopb.NewReviewsClient(conn).GetReviews(ctx, req)
+		})
+	if err != nil {
+		fmt.Println("Error making gRPC request:", err)
+		if grpcHTTPStatus(err) >= 500 {
+			recordReviews(nil)
+		}
+		return Section[ReviewData]{Status: grpcHTTPStatus(err), Error: status.Convert(err).Message()}
+	}
+
+	data := ReviewData{
+		ID:          resp.GetId(),
+		PodName:     resp.GetPodname(),
+		ClusterName: resp.GetClustername(),
+		Version:     resp.GetVersion(),
+		Reviews:     []Review{},
+	}
+	for _, review := range resp.GetReviews() {
+		r := Review{Reviewer: review.GetReviewer(), Text: review.GetText(), Date: review.GetDate()}
+		if rating := review.GetRating(); rating != nil {
+			r.Rating = &Rating{Stars: int(rating.GetStars()), Color: rating.GetColor()}
+		}
+		data.Reviews = append(data.Reviews, r)
+	}
+	if p := resp.GetPagination(); p != nil {
+		data.Pagination = &Pagination{
+			Page:         int(p.GetPage()),
+			PageSize:     int(p.GetPageSize()),
+			TotalReviews: int(p.GetTotalReviews()),
+			TotalPages:   int(p.GetTotalPages()),
+			NextCursor:   p.GetNextCursor(),
+			PrevCursor:   p.GetPrevCursor(),
+		}
+	}
+	recordReviews(&data)
+
+	return Section[ReviewData]{Status: http.StatusOK, Data: &data}
+}
@@ -0,0 +1,137 @@
+package productpage
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/camilamedeir0s/bookinfo-go/bookinfopb"
+)
+
+type fakeReviewsServer struct {
+	bookinfopb.UnimplementedReviewsServer
+	users chan string
+}
+
+func (s *fakeReviewsServer) GetReviews(ctx context.Context, req *bookinfopb.GetReviewsRequest) (*bookinfopb.GetReviewsResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.users <- md.Get("end-user")[0]
+	return &bookinfopb.GetReviewsResponse{Id: "0", Podname: "reviews-v1-west", Clustername: "west", Version: "v1"}, nil
+}
+
+type fakeDetailsServer struct {
+	bookinfopb.UnimplementedDetailsServer
+}
+
+func (fakeDetailsServer) GetDetails(context.Context, *bookinfopb.GetDetailsRequest) (*bookinfopb.BookDetails, error) {
+	return nil, status.Error(codes.NotFound, "product not found")
+}
+
+// serveGRPC sobe um servidor com os serviços falsos em 127.0.0.1 e devolve a
+// porta
+func serveGRPC(t *testing.T, reviews *fakeReviewsServer) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	bookinfopb.RegisterReviewsServer(server, reviews)
+	bookinfopb.RegisterDetailsServer(server, fakeDetailsServer{})
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func ejectedURLs(u *Upstream) []string {
+	var urls []string
+	for _, state := range u.states() {
+		if state.ejected {
+			urls = append(urls, state.url)
+		}
+	}
+	return urls
+}
+
+func TestGRPCFailsOverToRemoteCluster(t *testing.T) {
+	reviews := &fakeReviewsServer{users: make(chan string, 10)}
+	port := serveGRPC(t, reviews)
+	useConfig(t, func(c *Config) {
+		c.ReviewsGRPCPort = port
+		c.UpstreamRetries = 1
+	})
+
+	// Nada escuta em 127.0.0.2, então o endpoint local recusa a conexão. A
+	// porta HTTP dos endpoints é trocada pela porta gRPC do reviews.
+	previous := upstreams
+	upstreams = map[string]*Upstream{
+		"reviews": newUpstream("reviews", staticResolver{"east=http://127.0.0.2:9086", "west=http://127.0.0.1:9086"}, "round-robin",
+			outlierPolicy{Failures: 1, EjectionTime: time.Minute, MaxEjectionPercent: 50}),
+	}
+	upstreams["reviews"].local = locality{cluster: "east"}
+	defer func() { upstreams = previous }()
+
+	trace := newCallTrace()
+	section := getProductReviewsGRPC(withTrace(context.Background(), trace), 0, url.Values{}, map[string]string{"end-user": "jason"})
+	if section.Status != http.StatusOK || section.Data.ClusterName != "west" || section.Data.Version != "v1" {
+		t.Fatalf("got %+v", section)
+	}
+	if user := <-reviews.users; user != "jason" {
+		t.Errorf("got end-user %q in the metadata", user)
+	}
+
+	calls := trace.summary().Calls
+	want := "grpc://127.0.0.1:" + strconv.Itoa(port) + bookinfopb.Reviews_GetReviews_FullMethodName
+	if len(calls) != 1 || calls[0].URL != want || calls[0].Retries != 1 || calls[0].PodName != "reviews-v1-west" {
+		t.Fatalf("got calls %+v, want one retried call to %s", calls, want)
+	}
+
+	// O endpoint local foi ejetado e as próximas chamadas vão direto ao west
+	if got := ejectedURLs(upstreams["reviews"]); len(got) != 1 || got[0] != "http://127.0.0.2:9086" {
+		t.Errorf("got ejected endpoints %v", got)
+	}
+	config.UpstreamRetries = 0
+	trace = newCallTrace()
+	if section := getProductReviewsGRPC(withTrace(context.Background(), trace), 0, url.Values{}, map[string]string{"end-user": "jason"}); section.Status != http.StatusOK {
+		t.Errorf("got status %d after the failover", section.Status)
+	}
+	if calls := trace.summary().Calls; calls[0].Retries != 0 {
+		t.Errorf("got %d retries after the local endpoint was ejected", calls[0].Retries)
+	}
+}
+
+func TestGRPCClientErrorsDoNotEject(t *testing.T) {
+	port := serveGRPC(t, &fakeReviewsServer{users: make(chan string, 10)})
+	useConfig(t, func(c *Config) { c.DetailsGRPCPort = port })
+
+	previous := upstreams
+	upstreams = map[string]*Upstream{
+		"details": newUpstream("details", staticResolver{"http://127.0.0.1:9084"}, "round-robin",
+			outlierPolicy{Failures: 1, EjectionTime: time.Minute, MaxEjectionPercent: 100}),
+	}
+	defer func() { upstreams = previous }()
+
+	for i := 0; i < 2; i++ {
+		section := getProductDetailsGRPC(context.Background(), 99, nil)
+		if section.Status != http.StatusNotFound || section.Error != "product not found" {
+			t.Fatalf("got %+v, want a 404", section)
+		}
+	}
+	if got := ejectedURLs(upstreams["details"]); len(got) != 0 {
+		t.Errorf("got ejected endpoints %v after not found errors", got)
+	}
+
+	upstreams["details"] = newUpstream("details", staticResolver{}, "round-robin", outlierPolicy{})
+	if section := getProductDetailsGRPC(context.Background(), 0, nil); section.Status != http.StatusServiceUnavailable {
+		t.Errorf("got status %d without endpoints, want 503", section.Status)
+	}
+}
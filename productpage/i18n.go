@@ -0,0 +1,156 @@
+package productpage
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+	"golang.org/x/text/message"
+)
+
+// Catálogos de mensagens da interface, um arquivo por idioma com o nome da
+// tag BCP 47 (en.json, pt-BR.json)
+//
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// Idioma usado quando nenhum dos pedidos é suportado e para mensagens que
+// faltam nos outros catálogos
+var defaultLanguage = language.English
+
+// Locale traduz as mensagens da interface para um idioma. Números nos
+// argumentos são formatados conforme o idioma (4,5 em português).
+type Locale struct {
+	Tag      language.Tag
+	messages map[string]string
+	printer  *message.Printer
+}
+
+var (
+	locales       map[language.Tag]*Locale
+	localeTags    []language.Tag
+	localeMatcher language.Matcher
+	defaultLocale *Locale
+)
+
+func init() {
+	if err := loadLocales(); err != nil {
+		log.Fatal("Loading locales: ", err)
+	}
+}
+
+// loadLocales lê os catálogos embutidos. O idioma padrão vem primeiro em
+// localeTags, já que o matcher cai no primeiro quando nada casa.
+func loadLocales() error {
+	files, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		return err
+	}
+
+	locales = map[language.Tag]*Locale{}
+	localeTags = []language.Tag{defaultLanguage}
+	for _, file := range files {
+		tag, err := language.Parse(strings.TrimSuffix(file.Name(), path.Ext(file.Name())))
+		if err != nil {
+			return fmt.Errorf("locale file %s: %w", file.Name(), err)
+		}
+		data, err := localeFiles.ReadFile("locales/" + file.Name())
+		if err != nil {
+			return err
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return fmt.Errorf("locale file %s: %w", file.Name(), err)
+		}
+
+		locales[tag] = &Locale{Tag: tag, messages: messages, printer: message.NewPrinter(tag)}
+		if tag != defaultLanguage {
+			localeTags = append(localeTags, tag)
+		}
+	}
+
+	defaultLocale = locales[defaultLanguage]
+	if defaultLocale == nil {
+		return fmt.Errorf("no catalog for the default language %s", defaultLanguage)
+	}
+	localeMatcher = language.NewMatcher(localeTags)
+	return nil
+}
+
+// T devolve a mensagem key formatada com args. Mensagens que faltam no
+// catálogo vêm do idioma padrão e, por último, a própria chave é exibida.
+func (l *Locale) T(key string, args ...interface{}) string {
+	format, ok := l.messages[key]
+	if !ok {
+		if format, ok = defaultLocale.messages[key]; !ok {
+			return key
+		}
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return l.printer.Sprintf(format, args...)
+}
+
+// MarshalText representa o locale pela tag, como em "pt-BR"
+func (l *Locale) MarshalText() ([]byte, error) {
+	return []byte(l.Tag.String()), nil
+}
+
+// N escolhe entre as formas key.one e key.other conforme n
+func (l *Locale) N(key string, n int, args ...interface{}) string {
+	if n == 1 {
+		return l.T(key+".one", args...)
+	}
+	return l.T(key+".other", args...)
+}
+
+// negotiateLocale escolhe o idioma da página: ?lang= tem prioridade sobre o
+// cabeçalho Accept-Language, e valores que não casam com nenhum catálogo são
+// ignorados
+func negotiateLocale(r *http.Request) *Locale {
+	var desired []language.Tag
+	if lang := r.URL.Query().Get("lang"); lang != "" {
+		if tag, err := language.Parse(lang); err == nil {
+			desired = append(desired, tag)
+		}
+	}
+	if tags, _, err := language.ParseAcceptLanguage(r.Header.Get("Accept-Language")); err == nil {
+		desired = append(desired, tags...)
+	}
+
+	_, index, confidence := localeMatcher.Match(desired...)
+	if confidence == language.No {
+		return defaultLocale
+	}
+	return locales[localeTags[index]]
+}
+
+// LanguageLink é uma opção do seletor de idioma da página
+type LanguageLink struct {
+	Name    string
+	URL     string
+	Current bool
+}
+
+// languageLinks monta o seletor de idioma mantendo os demais parâmetros da
+// URL, como a página de reviews
+func languageLinks(r *http.Request, current *Locale) []LanguageLink {
+	links := make([]LanguageLink, 0, len(localeTags))
+	for _, tag := range localeTags {
+		query := r.URL.Query()
+		query.Set("lang", tag.String())
+		links = append(links, LanguageLink{
+			Name:    display.Self.Name(tag),
+			URL:     "?" + query.Encode(),
+			Current: tag == current.Tag,
+		})
+	}
+	return links
+}
@@ -0,0 +1,87 @@
+package productpage
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLocaleCatalogsAreComplete(t *testing.T) {
+	for tag, locale := range locales {
+		for key := range defaultLocale.messages {
+			if _, ok := locale.messages[key]; !ok {
+				t.Errorf("catalog %s has no message %q", tag, key)
+			}
+		}
+		for key := range locale.messages {
+			if _, ok := defaultLocale.messages[key]; !ok {
+				t.Errorf("catalog %s has message %q, which is not in the default catalog", tag, key)
+			}
+		}
+	}
+}
+
+func TestNegotiateLocale(t *testing.T) {
+	tests := []struct {
+		query          string
+		acceptLanguage string
+		want           string
+	}{
+		{"", "", "en"},
+		{"", "pt-BR,pt;q=0.9,en;q=0.8", "pt-BR"},
+		{"", "pt-PT", "pt-BR"},
+		{"", "es-MX,es;q=0.9", "es"},
+		{"", "fr-FR,fr;q=0.9", "en"},
+		{"", "de;q=0.5,es;q=0.9", "es"},
+		{"?lang=es", "pt-BR", "es"},
+		{"?lang=fr", "pt-BR", "pt-BR"},
+		{"?lang=not_a_tag!", "", "en"},
+		{"", "not a list;;", "en"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/productpage"+tt.query, nil)
+		if tt.acceptLanguage != "" {
+			r.Header.Set("Accept-Language", tt.acceptLanguage)
+		}
+		if got := negotiateLocale(r).Tag.String(); got != tt.want {
+			t.Errorf("%q with Accept-Language %q: got %s, want %s", tt.query, tt.acceptLanguage, got, tt.want)
+		}
+	}
+}
+
+func TestLocaleMessages(t *testing.T) {
+	r := httptest.NewRequest("GET", "/productpage?lang=pt-BR", nil)
+	pt := negotiateLocale(r)
+
+	if got := pt.N("reviews.average", 2, 4.5, 2); got != "Média 4,5 de 2 avaliações" {
+		t.Errorf("got %q", got)
+	}
+	if got := defaultLocale.N("reviews.average", 1, 4.0, 1); got != "4.0 average from 1 rating" {
+		t.Errorf("got %q", got)
+	}
+	if row, _ := starRow(3.5, "red", pt); row.Label != "3,5 de 5 estrelas" {
+		t.Errorf("got label %q", row.Label)
+	}
+	// Chaves desconhecidas aparecem como estão, para o erro ser visível
+	if got := pt.T("no.such.key"); got != "no.such.key" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestLanguageLinks(t *testing.T) {
+	r := httptest.NewRequest("GET", "/productpage?id=1&lang=es", nil)
+	links := languageLinks(r, negotiateLocale(r))
+
+	var current []string
+	for _, link := range links {
+		if link.Current {
+			current = append(current, link.Name)
+		}
+		if !strings.Contains(link.URL, "id=1") {
+			t.Errorf("link %s drops the product: %s", link.Name, link.URL)
+		}
+	}
+	if len(links) != len(localeTags) || strings.Join(current, ",") != "español" {
+		t.Errorf("links = %+v", links)
+	}
+}
@@ -0,0 +1,157 @@
+package productpage
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+// Contrato da productpage, servido em /openapi.json
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// loadOpenAPI lê e valida a especificação embutida e monta o roteador que
+// associa cada requisição à sua operação
+func loadOpenAPI() (*openapi3.T, routers.Router, error) {
+	// Mensagens de validação em uma linha, sem o schema completo
+	openapi3.SchemaErrorDetailsDisabled = true
+	// As páginas HTML, o grafo DOT e os streams de eventos são validados
+	// apenas como texto
+	openapi3filter.RegisterBodyDecoder("text/html", openapi3filter.FileBodyDecoder)
+	openapi3filter.RegisterBodyDecoder("text/vnd.graphviz", openapi3filter.FileBodyDecoder)
+	openapi3filter.RegisterBodyDecoder("text/event-stream", openapi3filter.FileBodyDecoder)
+
+	doc, err := openapi3.NewLoader().LoadFromData(openAPISpec)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, nil, err
+	}
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	return doc, router, nil
+}
+
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
+
+// openAPIValidator confere requisições e respostas com a especificação. O modo
+// vem de OPENAPI_VALIDATION:
+//
+//	off    - sem validação
+//	warn   - violações só são registradas no log (padrão)
+//	strict - requisições inválidas recebem 400 e respostas inválidas, 500
+func openAPIValidator(router routers.Router, mode string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if mode == "off" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			route, pathParams, err := router.FindRoute(r)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			requestInput := &openapi3filter.RequestValidationInput{
+				Request:    r,
+				PathParams: pathParams,
+				Route:      route,
+				Options:    &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc},
+			}
+			if err := openapi3filter.ValidateRequest(r.Context(), requestInput); err != nil {
+				log.Printf("OpenAPI request violation on %s %s: %v", r.Method, r.URL.Path, err)
+				if mode == "strict" {
+					writeAPIError(w, http.StatusBadRequest, "", err.Error())
+					return
+				}
+			}
+			if streamsEvents(route) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			writer := &capturingWriter{ResponseWriter: w, status: http.StatusOK, hold: mode == "strict"}
+			next.ServeHTTP(writer, r)
+
+			err = openapi3filter.ValidateResponse(r.Context(), &openapi3filter.ResponseValidationInput{
+				RequestValidationInput: requestInput,
+				Status:                 writer.status,
+				Header:                 writer.Header(),
+				Body:                   io.NopCloser(bytes.NewReader(writer.body.Bytes())),
+				Options: &openapi3filter.Options{
+					IncludeResponseStatus: true,
+					ExcludeResponseBody:   !strings.HasPrefix(writer.Header().Get("Content-Type"), "application/json"),
+				},
+			})
+			if err != nil {
+				log.Printf("OpenAPI response violation on %s %s: %v", r.Method, r.URL.Path, err)
+			}
+
+			if writer.hold {
+				if err != nil {
+					writeAPIError(w, http.StatusInternalServerError, "", "response does not conform to the API specification")
+					return
+				}
+				w.WriteHeader(writer.status)
+				w.Write(writer.body.Bytes())
+			}
+		})
+	}
+}
+
+// streamsEvents indica se a operação responde com um stream de eventos, que
+// não termina e por isso não pode ser guardado nem validado
+func streamsEvents(route *routers.Route) bool {
+	ok := route.Operation.Responses.Status(http.StatusOK)
+	return ok != nil && ok.Value != nil && ok.Value.Content.Get("text/event-stream") != nil
+}
+
+// capturingWriter guarda a resposta para validação. Com hold, a resposta só é
+// acumulada em memória, podendo ainda ser substituída.
+type capturingWriter struct {
+	http.ResponseWriter
+	body        bytes.Buffer
+	status      int
+	hold        bool
+	wroteHeader bool
+}
+
+func (w *capturingWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = code
+	if !w.hold {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *capturingWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.body.Write(data)
+	if w.hold {
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
@@ -0,0 +1,189 @@
+package productpage
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+)
+
+// fakeUpstreams responde como details, reviews e ratings. O produto 5 simula
+// um ratings indisponível, e o stream de avaliações termina após o primeiro
+// evento.
+func fakeUpstreams() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		io.WriteString(w, `{"status":"healthy","version":"v1"}`)
+	})
+	mux.HandleFunc("/details/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		io.WriteString(w, `{"id":1,"author":"William Shakespeare","year":1595,"type":"paperback","pages":200,"publisher":"PublisherA","language":"English","ISBN-10":"1234567890","ISBN-13":"123-1234567890"}`)
+	})
+	mux.HandleFunc("/reviews/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		io.WriteString(w, `{"id":"1","podname":"reviews-v2","clustername":"null","version":"v2","reviews":[{"reviewer":"Reviewer1","text":"Great","date":"2023-03-14","rating":{"stars":5,"color":"black"}},{"reviewer":"Reviewer2","text":"Fun"}],"pagination":{"page":1,"pageSize":10,"totalReviews":2,"totalPages":1}}`)
+	})
+	mux.HandleFunc("/ratings/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if strings.HasPrefix(r.URL.Path, "/ratings/5") {
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, `{"error":"Service unavailable"}`)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/stream") {
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "event: ratings\ndata: {\"id\":1,\"ratings\":{\"Reviewer1\":5,\"Reviewer2\":4}}\n\n")
+			return
+		}
+		io.WriteString(w, `{"id":1,"ratings":{"Reviewer1":5,"Reviewer2":4}}`)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestHandlersConformToOpenAPI(t *testing.T) {
+	useAuth(t, map[string]string{"jason": "jason-password"})
+	useConfig(t, func(c *Config) { c.OpenAPIValidation = "off" })
+
+	upstream := fakeUpstreams()
+	defer upstream.Close()
+
+	previous := services
+	services = map[string]Service{
+		"details": {Name: upstream.URL, Endpoint: "details"},
+		"reviews": {Name: upstream.URL, Endpoint: "reviews"},
+		"ratings": {Name: upstream.URL, Endpoint: "ratings"},
+	}
+	services["productpage"] = Service{
+		Name:     "http://productpage:9080",
+		Endpoint: "productpage",
+		Children: []Service{services["details"], services["reviews"], services["ratings"]},
+	}
+	defer func() { services = previous }()
+
+	previousUpstreams := upstreams
+	upstreams = map[string]*Upstream{}
+	for _, name := range []string{"details", "reviews", "ratings"} {
+		upstreams[name] = newUpstream(name, staticResolver{upstream.URL}, "round-robin", outlierPolicy{})
+	}
+	defer func() { upstreams = previousUpstreams }()
+	prober.probeAll()
+
+	var err error
+	if catalog, err = loadCatalog(""); err != nil {
+		t.Fatalf("loading catalog: %v", err)
+	}
+	searchIndex = newSearchIndex()
+	searchIndex.Rebuild(catalog.Products())
+
+	doc, specRouter, err := loadOpenAPI()
+	if err != nil {
+		t.Fatalf("loading spec: %v", err)
+	}
+	r, err := newRouter()
+	if err != nil {
+		t.Fatalf("setting up router: %v", err)
+	}
+
+	tests := []struct {
+		path   string
+		status int
+		form   string
+		accept string
+	}{
+		{"/", http.StatusOK, "", ""},
+		{"/health", http.StatusOK, "", ""},
+		{"/productpage", http.StatusOK, "", ""},
+		{"/productpage?id=999", http.StatusNotFound, "", ""},
+		{"/products/1", http.StatusOK, "", ""},
+		{"/products/1?debug=trace", http.StatusOK, "", ""},
+		{"/products/1?lang=pt-BR", http.StatusOK, "", ""},
+		{"/products/1", http.StatusOK, "", "application/json"},
+		{"/productpage?debug=trace", http.StatusOK, "", "application/json;q=0.9, text/html;q=0.5"},
+		{"/products/1/details", http.StatusOK, "", ""},
+		{"/products/1/reviews?sort=stars", http.StatusOK, "", ""},
+		{"/products/999/reviews", http.StatusNotFound, "", ""},
+		{"/productpage?debug=trace&format=json", http.StatusOK, "", ""},
+		{"/search?q=hamlet", http.StatusOK, "", ""},
+		{"/api/v1/products", http.StatusOK, "", ""},
+		{"/api/v1/products/search?q=shakespeare", http.StatusOK, "", ""},
+		{"/api/v1/products/search", http.StatusBadRequest, "", ""},
+		{"/api/v1/products/1", http.StatusOK, "", ""},
+		{"/api/v1/products/abc", http.StatusBadRequest, "", ""},
+		{"/api/v1/products/1/reviews", http.StatusOK, "", ""},
+		{"/api/v1/products/1/ratings", http.StatusOK, "", ""},
+		{"/api/v1/products/5/ratings", http.StatusServiceUnavailable, "", ""},
+		{"/api/v1/products/1/ratings/stream", http.StatusOK, "", ""},
+		{"/api/v1/products/5/ratings/stream", http.StatusServiceUnavailable, "", ""},
+		{"/api/v1/products/1/full", http.StatusOK, "", ""},
+		{"/api/v1/products/999/full", http.StatusNotFound, "", ""},
+		{"/api/v1/topology", http.StatusOK, "", ""},
+		{"/api/v1/topology?format=dot", http.StatusOK, "", ""},
+		{"/api/v1/topology?format=svg", http.StatusBadRequest, "", ""},
+		{"/api/v1/stats/versions", http.StatusOK, "", ""},
+		{"/api/v1/stats/versions?window=1h", http.StatusBadRequest, "", ""},
+		{"/openapi.json", http.StatusOK, "", ""},
+		{"/login", http.StatusSeeOther, "username=jason&passwd=jason-password", ""},
+		{"/login", http.StatusOK, "username=jason&passwd=jason-password", "application/json"},
+		{"/login", http.StatusUnauthorized, "username=jason&passwd=wrong", ""},
+		{"/login", http.StatusBadRequest, "username=&passwd=x", ""},
+		{"/logout", http.StatusSeeOther, "", ""},
+	}
+
+	covered := map[string]bool{}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.path == "/login" {
+			req = httptest.NewRequest("POST", tt.path, strings.NewReader(tt.form))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		if rec.Code != tt.status {
+			t.Errorf("GET %s: got status %d, want %d", tt.path, rec.Code, tt.status)
+		}
+		covered[assertConforms(t, specRouter, req, rec)] = true
+	}
+
+	for _, path := range doc.Paths.InMatchingOrder() {
+		for _, op := range doc.Paths.Value(path).Operations() {
+			if !covered[op.OperationID] {
+				t.Errorf("operation %s is not covered by the contract test", op.OperationID)
+			}
+		}
+	}
+}
+
+// assertConforms valida a resposta gravada contra a especificação e devolve o
+// id da operação correspondente
+func assertConforms(t *testing.T, specRouter routers.Router, req *http.Request, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+
+	route, pathParams, err := specRouter.FindRoute(req)
+	if err != nil {
+		t.Errorf("%s %s: no operation in spec: %v", req.Method, req.URL.Path, err)
+		return ""
+	}
+
+	err = openapi3filter.ValidateResponse(req.Context(), &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: &openapi3filter.RequestValidationInput{Request: req, PathParams: pathParams, Route: route},
+		Status:                 rec.Code,
+		Header:                 rec.Header(),
+		Body:                   io.NopCloser(bytes.NewReader(rec.Body.Bytes())),
+		Options:                &openapi3filter.Options{IncludeResponseStatus: true},
+	})
+	if err != nil {
+		t.Errorf("%s %s: response does not conform: %v", req.Method, req.URL.Path, err)
+	}
+	return route.Operation.OperationID
+}
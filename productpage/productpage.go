@@ -1,22 +1,30 @@
-package main
+// Package productpage é a productpage do bookinfo, que monta a página de cada
+// produto com os detalhes e os reviews. O comando fica em cmd/productpage.
+package productpage
 
 import (
 	"bytes"
+	"context"
+	"embed"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"html/template"
-	"io"
-	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
 var (
-	templates *template.Template
-	services  map[string]Service
+	templates   *template.Template
+	services    map[string]Service
+	catalog     *Catalog
+	searchIndex *SearchIndex
 )
 
 type Service struct {
@@ -26,9 +34,9 @@ type Service struct {
 }
 
 type Product struct {
-	ID              int    `json:"id"`
-	Title           string `json:"title"`
-	DescriptionHtml string `json:"descriptionHtml"`
+	ID              int    `json:"id" yaml:"id"`
+	Title           string `json:"title" yaml:"title"`
+	DescriptionHtml string `json:"descriptionHtml" yaml:"descriptionHtml"`
 }
 
 type Rating struct {
@@ -37,173 +45,291 @@ type Rating struct {
 }
 
 type Review struct {
-	Reviewer string `json:"reviewer"`
-	Text     string `json:"text"`
-	Rating   Rating `json:"rating"`
+	Reviewer string  `json:"reviewer"`
+	Text     string  `json:"text"`
+	Date     string  `json:"date,omitempty"`
+	Rating   *Rating `json:"rating,omitempty"`
 }
 
 type ReviewData struct {
-	ID          string   `json:"id"`
-	PodName     string   `json:"podname"`
-	ClusterName string   `json:"clustername"`
-	Reviews     []Review `json:"reviews"`
+	ID          string      `json:"id"`
+	PodName     string      `json:"podname"`
+	ClusterName string      `json:"clustername"`
+	Version     string      `json:"version"`
+	Reviews     []Review    `json:"reviews"`
+	Pagination  *Pagination `json:"pagination,omitempty"`
 }
 
+type Pagination struct {
+	Page         int    `json:"page"`
+	PageSize     int    `json:"pageSize"`
+	TotalReviews int    `json:"totalReviews"`
+	TotalPages   int    `json:"totalPages"`
+	NextCursor   string `json:"nextCursor,omitempty"`
+	PrevCursor   string `json:"prevCursor,omitempty"`
+}
+
+type BookDetails struct {
+	ID        int    `json:"id"`
+	Author    string `json:"author"`
+	Year      int    `json:"year"`
+	Type      string `json:"type"`
+	Pages     int    `json:"pages"`
+	Publisher string `json:"publisher"`
+	Language  string `json:"language"`
+	ISBN10    string `json:"ISBN-10"`
+	ISBN13    string `json:"ISBN-13"`
+}
+
+type ProductRatings struct {
+	ID      int            `json:"id"`
+	Ratings map[string]int `json:"ratings"`
+}
+
+// Os templates vão embutidos no binário, para que a productpage não dependa do
+// diretório de trabalho
+//
+//go:embed templates/*.html
+var templateFiles embed.FS
+
 func init() {
 	// Carregar os templates
-	templates = template.Must(template.ParseGlob("templates/*.html"))
+	templates = template.Must(template.New("").Funcs(templateFuncs).ParseFS(templateFiles, "templates/*.html"))
+}
+
+// Main executa a productpage com os argumentos de linha de comando args até
+// receber SIGINT ou SIGTERM
+func Main(args []string) {
+	var err error
+	config, err = loadConfig(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+	if config.PrintConfig {
+		printConfig(os.Stdout, config)
+		return
+	}
+
+	server, err := setup()
+	if err != nil {
+		log.Fatal("Could not set up the service: ", err)
+	}
+
+	serve(fmt.Sprintf(":%d", config.Port), server.Handler, server.Close)
+}
+
+// New carrega a configuração de args como a Main e monta a productpage sem
+// abrir a porta, para quem chama atendê-la
+func New(args []string) (*Server, error) {
+	var err error
+	if config, err = loadConfig(args); err != nil {
+		return nil, err
+	}
+	return setup()
+}
+
+// setup monta a productpage para a configuração carregada. Nada fica de uma
+// productpage anterior: as estatísticas de versões e os usuários começam do
+// zero
+func setup() (*Server, error) {
+	var err error
+	versionStats = &versionRecorder{}
+	credentials = nil
 
 	// Configurar os serviços
 	services = setupServices()
+	upstreams = setupUpstreams()
+	if config.TopologyProbeInterval > 0 {
+		go prober.run(config.TopologyProbeInterval)
+	}
+
+	// Configurar a emissão de tokens de login
+	tokenIssuer, err = loadTokenIssuer()
+	if err != nil {
+		return nil, fmt.Errorf("loading the JWT signing key: %w", err)
+	}
+	if tokenIssuer == nil {
+		log.Println("JWT_HMAC_SECRET and JWT_PRIVATE_KEY_FILE not set, authentication is disabled and every request is anonymous")
+	}
+	if config.UsersFile != "" {
+		if credentials, err = loadCredentials(config.UsersFile); err != nil {
+			return nil, fmt.Errorf("loading users: %w", err)
+		}
+	} else {
+		log.Println("USERS_FILE not set, logins are disabled")
+	}
+
+	// Carregar o catálogo de produtos
+	catalog, err = loadCatalog(config.ProductsFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading the product catalog: %w", err)
+	}
+
+	// Mantém o índice de busca sincronizado com o catálogo
+	searchIndex = newSearchIndex()
+	go catalog.OnChange(searchIndex.Rebuild)
+	if config.ProductsFile != "" {
+		go catalog.watch(config.ProductsFile, 10*time.Second)
+	}
+
+	r, err := newRouter()
+	if err != nil {
+		return nil, fmt.Errorf("setting up the router: %w", err)
+	}
+	return &Server{Handler: r, index: searchIndex}, nil
 }
 
-func main() {
-	port := "8083"
-	if len(os.Args) > 1 {
-		port = os.Args[1]
+// newRouter registra as rotas da productpage atrás dos middlewares de limite de
+// taxa e de validação OpenAPI
+func newRouter() (*mux.Router, error) {
+	_, spec, err := loadOpenAPI()
+	if err != nil {
+		return nil, err
 	}
 
 	r := mux.NewRouter()
+	if limiter := rateLimitMiddleware(); limiter != nil {
+		r.Use(limiter)
+	}
+	r.Use(openAPIValidator(spec, config.OpenAPIValidation))
 
+	r.HandleFunc("/openapi.json", openAPIHandler).Methods("GET")
 	r.HandleFunc("/", indexHandler).Methods("GET")
 	r.HandleFunc("/health", healthHandler).Methods("GET")
+	r.HandleFunc("/login", loginHandler).Methods("POST")
+	r.HandleFunc("/logout", logoutHandler).Methods("GET")
 	r.HandleFunc("/productpage", productPageHandler).Methods("GET")
+	r.HandleFunc("/products/{id}", productPageHandler).Methods("GET")
+	r.HandleFunc("/products/{id}/details", productFragmentHandler("details")).Methods("GET")
+	r.HandleFunc("/products/{id}/reviews", productFragmentHandler("reviews")).Methods("GET")
+	r.HandleFunc("/search", searchPageHandler).Methods("GET")
 	r.HandleFunc("/api/v1/products", productsHandler).Methods("GET")
+	r.HandleFunc("/api/v1/products/search", productSearchHandler).Methods("GET")
 	r.HandleFunc("/api/v1/products/{id}", productHandler).Methods("GET")
 	r.HandleFunc("/api/v1/products/{id}/reviews", productReviewsHandler).Methods("GET")
 	r.HandleFunc("/api/v1/products/{id}/ratings", productRatingsHandler).Methods("GET")
+	r.HandleFunc("/api/v1/products/{id}/ratings/stream", productRatingsStreamHandler).Methods("GET")
+	r.HandleFunc("/api/v1/products/{id}/full", productFullHandler).Methods("GET")
+	r.HandleFunc("/api/v1/topology", topologyHandler).Methods("GET")
+	r.HandleFunc("/api/v1/stats/versions", versionStatsHandler).Methods("GET")
 
 	r.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static")))).Methods("GET")
 
-	http.Handle("/", r)
-
-	log.Printf("Server started at :%s\n", port)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", port), nil))
-}
-
-func jsonToHTMLTable(data Service) string {
-	html := "<table class='table table-condensed table-bordered table-hover'>"
-	html += "<thead><tr><th>Name</th><th>Endpoint</th><th>Children</th></tr></thead>"
-	html += "<tbody>"
-	html += buildHTMLTableRow(data)
-	html += "</tbody></table>"
-	return html
-}
-
-func buildHTMLTableRow(service Service) string {
-	row := "<tr>"
-	row += fmt.Sprintf("<td>%s</td>", service.Name)
-	row += fmt.Sprintf("<td>%s</td>", service.Endpoint)
-
-	// Verifica se o serviço tem filhos
-	if len(service.Children) > 0 {
-		row += "<td><table>"
-		for _, child := range service.Children {
-			row += buildHTMLTableRow(child)
-		}
-		row += "</table></td>"
-	} else {
-		row += "<td>None</td>"
-	}
-	row += "</tr>"
-	return row
+	return r, nil
 }
 
 func indexHandler(w http.ResponseWriter, r *http.Request) {
-	productPage := services["productpage"]
-
-	// Convertendo o JSON para uma tabela HTML
-	table := jsonToHTMLTable(productPage)
-
 	// Definindo o tipo de conteúdo como HTML
 	w.Header().Set("Content-Type", "text/html")
 
 	if err := templates.ExecuteTemplate(w, "index.html", map[string]interface{}{
-		"serviceTable": template.HTML(table),
+		"topology": currentTopology(),
+		"versions": versionStats.snapshot(config.VersionStatsWindow, time.Now()),
 	}); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
 
 func healthHandler(w http.ResponseWriter, r *http.Request) {
+	if draining.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, "Product page is shutting down")
+		return
+	}
 	fmt.Fprintln(w, "Product page is healthy")
 }
 
-// makeSeq gera uma sequência de números de 0 até n-1
-func makeSeq(n int) []int {
-	seq := make([]int, n)
-	for i := 0; i < n; i++ {
-		seq[i] = i
+// productPageHandler serve a página do produto em HTML ou, com
+// Accept: application/json, o mesmo modelo da página em JSON
+func productPageHandler(w http.ResponseWriter, r *http.Request) {
+	product, ok := requestedProduct(w, r)
+	if !ok {
+		return
 	}
-	return seq
-}
 
-func productPageHandler(w http.ResponseWriter, r *http.Request) {
-	productID := 0 // valor padrão
+	// O details recebe o idioma escolhido para nomear a língua do livro
+	locale := negotiateLocale(r)
+	headers := upstreamHeaders(r, locale)
+	user, _ := sessionUser(r)
 
-	headers := forwardHeaders(r)
-	products := getProducts()
-	product := products[0]
+	// Com ?debug=trace as chamadas aos serviços são registradas para a cascata
+	ctx := r.Context()
+	var trace *CallTrace
+	if r.URL.Query().Get("debug") == "trace" {
+		trace = newCallTrace()
+		ctx = withTrace(ctx, trace)
+	}
 
-	detailsStatus, details := getProductDetails(productID, headers)
+	details := getProductDetails(ctx, product.ID, headers)
 
-	reviewsStatus, reviews := getProductReviews(productID, headers)
+	reviews := getProductReviews(ctx, product.ID, reviewsQuery(r), headers)
 
-	// Exemplo de valor de rating
-	stars := 4 // Substitua isso com o valor real de estrelas das avaliações
+	if trace != nil && r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(trace.summary())
+		return
+	}
 
 	// Preparando os dados para passar ao template
-	data := map[string]interface{}{
-		"detailsStatus": detailsStatus,
-		"reviewsStatus": reviewsStatus,
-		"product":       product,
-		"details":       details,
-		"reviews":       reviews,
-		"user":          "", // Usuário não implementado
-		"rating": map[string]interface{}{
-			"stars": makeSeq(stars), // Gera a sequência de estrelas
-			"color": "yellow",
-		},
+	view := ProductPageView{
+		Locale:          locale,
+		Languages:       languageLinks(r, locale),
+		Product:         product,
+		User:            user,
+		Details:         details,
+		Reviews:         reviews,
+		Pager:           reviewsPager(r, product.ID, reviews.Data),
+		ReviewsFragment: reviewsFragmentURL(product.ID, reviewsQuery(r), locale),
+		RatingsStream:   fmt.Sprintf("/api/v1/products/%d/ratings/stream", product.ID),
+	}
+	if trace != nil {
+		query := r.URL.Query()
+		query.Set("format", "json")
+		summary := trace.summary()
+		view.Trace = &summary
+		view.TraceJSONURL = template.URL("?" + query.Encode())
+	}
+
+	w.Header().Add("Vary", "Accept")
+	if preferredMediaType(r, "text/html", "application/json") == "application/json" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Language", locale.Tag.String())
+		w.Header().Add("Vary", "Accept-Language")
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		enc.Encode(view)
+		return
 	}
 
-	w.Header().Set("Content-Type", "text/html")
-
-	if err := templates.ExecuteTemplate(w, "productpage.html", data); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-	}
+	renderHTML(w, "productpage.html", locale, view)
 }
 
 // Funções auxiliares
 func setupServices() map[string]Service {
-	servicesDomain := getEnv("SERVICES_DOMAIN", "")
-	detailsHostname := getEnv("DETAILS_HOSTNAME", "details-go")
-	detailsPort := getEnv("DETAILS_SERVICE_PORT", "9084")
-	ratingsHostname := getEnv("RATINGS_HOSTNAME", "ratings-go")
-	ratingsPort := getEnv("RATINGS_SERVICE_PORT", "8085")
-	reviewsHostname := getEnv("REVIEWS_HOSTNAME", "reviews-go")
-	reviewsPort := getEnv("REVIEWS_SERVICE_PORT", "9086")
-
 	details := Service{
-		Name:     fmt.Sprintf("http://%s%s:%s", detailsHostname, servicesDomain, detailsPort),
+		Name:     config.upstreamURL(config.DetailsHostname, config.DetailsPort),
 		Endpoint: "details",
 		Children: []Service{},
 	}
 
 	ratings := Service{
-		Name:     fmt.Sprintf("http://%s%s:%s", ratingsHostname, servicesDomain, ratingsPort),
+		Name:     config.upstreamURL(config.RatingsHostname, config.RatingsPort),
 		Endpoint: "ratings",
 	}
 
 	reviews := Service{
-		Name:     fmt.Sprintf("http://%s%s:%s", reviewsHostname, servicesDomain, reviewsPort),
+		Name:     config.upstreamURL(config.ReviewsHostname, config.ReviewsPort),
 		Endpoint: "reviews",
 		Children: []Service{ratings},
 	}
 
 	productPage := Service{
-		Name:     fmt.Sprintf("http://%s%s:%s", detailsHostname, servicesDomain, detailsPort),
-		Endpoint: "details",
-		Children: []Service{details, reviews},
+		Name:     selfURL(),
+		Endpoint: "productpage",
+		Children: []Service{details, reviews, ratings},
 	}
 
 	return map[string]Service{
@@ -214,15 +340,48 @@ func setupServices() map[string]Service {
 	}
 }
 
-func toHTMLTable(service Service) string {
-	// Converte o serviço em tabela HTML
-	data, _ := json.Marshal(service)
-	return string(data)
+// Cabeçalhos de rastreamento e identidade repassados aos serviços de backend
+var headersToPropagate = []string{
+	"x-request-id",
+	"x-ot-span-context",
+	"x-datadog-trace-id",
+	"x-datadog-parent-id",
+	"x-datadog-sampling-priority",
+	"traceparent",
+	"tracestate",
+	"x-cloud-trace-context",
+	"grpc-trace-bin",
+	"x-b3-traceid",
+	"x-b3-spanid",
+	"x-b3-parentspanid",
+	"x-b3-sampled",
+	"x-b3-flags",
+	"sw8",
+	"accept-language",
+	"end-user",
+	"user-agent",
+	"cookie",
+	"authorization",
+	"jwt",
 }
 
+// forwardHeaders copia os cabeçalhos propagados da requisição e, se houver
+// sessão, identifica o usuário com end-user e o token em Authorization
 func forwardHeaders(r *http.Request) map[string]string {
 	headers := map[string]string{}
-	// Aqui ficariam as lógicas de propagação de cabeçalhos
+	for _, header := range headersToPropagate {
+		if value := r.Header.Get(header); value != "" {
+			headers[header] = value
+		}
+	}
+
+	user, token := sessionUser(r)
+	if user != "" {
+		headers["end-user"] = user
+	}
+	if token != "" {
+		headers["authorization"] = "Bearer " + token
+	}
 	return headers
 }
 
@@ -246,227 +405,68 @@ func productsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func productHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	productID := vars["id"]
-
-	detailsService := services["details"]                               // Pega o serviço "details" do mapa de serviços
-	url := fmt.Sprintf("%s/details/%s", detailsService.Name, productID) // Constrói a URL com o ID do produto
-
-	resp, err := http.Get(url)
-	if err != nil {
-		http.Error(w, "Failed to fetch product details", http.StatusInternalServerError)
-		return
-	}
-	defer resp.Body.Close()
-
-	// Lê a resposta do serviço "details"
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		http.Error(w, "Failed to read response from details service", http.StatusInternalServerError)
-		return
-	}
-
-	// Escreve a resposta JSON do serviço "details" para o cliente
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(body)
+	proxyUpstream(w, r, "details")
 }
 
 func productReviewsHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	productID := vars["id"]
-
-	reviewsService := services["reviews"]                               // Pega o serviço "reviews" do mapa de serviços
-	url := fmt.Sprintf("%s/reviews/%s", reviewsService.Name, productID) // Constrói a URL com o ID do produto
-
-	resp, err := http.Get(url)
-	if err != nil {
-		http.Error(w, "Failed to fetch product reviews", http.StatusInternalServerError)
-		return
-	}
-	defer resp.Body.Close()
-
-	// Lê a resposta do serviço "reviews"
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		http.Error(w, "Failed to read response from reviews service", http.StatusInternalServerError)
-		return
-	}
-
-	// Escreve a resposta JSON do serviço "reviews" para o cliente
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(body)
+	proxyUpstream(w, r, "reviews")
 }
 
 func productRatingsHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	productID := vars["id"]
-
-	ratingsService := services["ratings"]                               // Pega o serviço "ratings" do mapa de serviços
-	url := fmt.Sprintf("%s/ratings/%s", ratingsService.Name, productID) // Constrói a URL com o ID do produto
-
-	resp, err := http.Get(url)
-	if err != nil {
-		http.Error(w, "Failed to fetch product ratings", http.StatusInternalServerError)
-		return
-	}
-	defer resp.Body.Close()
-
-	// Lê a resposta do serviço "ratings"
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		http.Error(w, "Failed to read response from ratings service", http.StatusInternalServerError)
-		return
-	}
-
-	// Escreve a resposta JSON do serviço "ratings" para o cliente
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(body)
+	proxyUpstream(w, r, "ratings")
 }
 
 func getProducts() []Product {
-	return []Product{
-		{
-			ID:              0,
-			Title:           "The Comedy of Errors",
-			DescriptionHtml: "<a href=\"https://en.wikipedia.org/wiki/The_Comedy_of_Errors\">Wikipedia Summary</a>: The Comedy of Errors is one of <b>William Shakespeare's</b> early plays. It is his shortest and one of his most farcical comedies, with a major part of the humour coming from slapstick and mistaken identity, in addition to puns and word play.",
-		},
-	}
+	return catalog.Products()
 }
 
-func getProductDetails(productID int, headers map[string]string) (int, map[string]interface{}) {
-	// Constroi a URL para o serviço details
-	detailsService := services["details"]                               // Pega o serviço "ratings" do mapa de serviços
-	url := fmt.Sprintf("%s/details/%d", detailsService.Name, productID) // Constrói a URL com o ID do produto
-	// url := fmt.Sprintf("http://localhost:9084/details/%d", productID)
-
-	// Cria uma nova requisição HTTP GET
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		fmt.Println("Error creating request:", err)
-		return 500, nil
-	}
-
-	// Adiciona os headers na requisição, se houver
-	for key, value := range headers {
-		req.Header.Add(key, value)
-	}
-
-	// Executa a requisição
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		fmt.Println("Error making request:", err)
-		return 500, nil
+// getProductDetails busca os detalhes do produto no details. Falhas ficam em
+// Status/Error da seção, que o template mostra no lugar da tabela.
+func getProductDetails(ctx context.Context, productID int, headers map[string]string) Section[BookDetails] {
+	if config.ClientProtocol == "grpc" {
+		return getProductDetailsGRPC(ctx, productID, headers)
 	}
-	defer resp.Body.Close()
 
-	// Lê o corpo da resposta
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Println("Error reading response body:", err)
-		return 500, nil
+	// Executa a requisição em um dos endpoints do details
+	details := fetchSection[BookDetails](ctx, "details", fmt.Sprintf("/details/%d", productID), headers)
+	if details.Data == nil {
+		fmt.Printf("Error fetching details (status %d): %s\n", details.Status, details.Error)
 	}
-
-	// Verifica se a requisição foi bem-sucedida
-	if resp.StatusCode != http.StatusOK {
-		fmt.Printf("Received non-200 response: %d\n", resp.StatusCode)
-		return resp.StatusCode, nil
-	}
-
-	// Decodifica a resposta JSON para um mapa
-	var details map[string]interface{}
-	err = json.Unmarshal(body, &details)
-	if err != nil {
-		fmt.Println("Error unmarshalling response:", err)
-		return 500, nil
-	}
-
-	// Retorna o status e os detalhes do produto
-	return resp.StatusCode, details
+	return details
 }
 
-func getProductReviews(productID int, headers map[string]string) (int, map[string]interface{}) {
-	// Constroi a URL para o serviço reviews
-	reviewsService := services["reviews"]                               // Pega o serviço "ratings" do mapa de serviços
-	url := fmt.Sprintf("%s/reviews/%d", reviewsService.Name, productID) // Constrói a URL com o ID do produto
-	// url := fmt.Sprintf("http://localhost:9084/reviews/%d", productID)
-
-	// Cria uma nova requisição HTTP GET
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		fmt.Println("Error creating request:", err)
-		return 500, nil
-	}
-
-	// Adiciona os headers na requisição, se houver
-	for key, value := range headers {
-		req.Header.Add(key, value)
-	}
-
-	// Executa a requisição
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		fmt.Println("Error making request:", err)
-		return 500, nil
-	}
-	defer resp.Body.Close()
-
-	// Lê o corpo da resposta
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Println("Error reading response body:", err)
-		return 500, nil
+// getProductReviews busca uma página de reviews do produto e registra qual
+// instância do reviews respondeu
+func getProductReviews(ctx context.Context, productID int, query url.Values, headers map[string]string) Section[ReviewData] {
+	if config.ClientProtocol == "grpc" {
+		return getProductReviewsGRPC(ctx, productID, query, headers)
 	}
 
-	// Verifica se a requisição foi bem-sucedida
-	if resp.StatusCode != http.StatusOK {
-		fmt.Printf("Received non-200 response: %d\n", resp.StatusCode)
-		return resp.StatusCode, nil
+	// Constrói o caminho com o ID do produto e os parâmetros de paginação
+	path := fmt.Sprintf("/reviews/%d", productID)
+	if len(query) > 0 {
+		path += "?" + query.Encode()
 	}
 
-	// Decodifica a resposta JSON para um mapa
-	var reviews map[string]interface{}
-	err = json.Unmarshal(body, &reviews)
-	if err != nil {
-		fmt.Println("Error unmarshalling response:", err)
-		return 500, nil
+	// Executa a requisição em um dos endpoints do reviews
+	reviews := fetchSection[ReviewData](ctx, "reviews", path, headers)
+	if reviews.Data == nil {
+		fmt.Printf("Error fetching reviews (status %d): %s\n", reviews.Status, reviews.Error)
 	}
-
-	// Acessando os dados e criando um slice para stars
-	for _, review := range reviews["reviews"].([]interface{}) {
-		reviewMap := review.(map[string]interface{})
-		ratingMap := reviewMap["rating"].(map[string]interface{})
-
-		// Convertendo stars para int
-		starsFloat, ok := ratingMap["stars"].(float64) // JSON trata números como float64
-		if !ok {
-			fmt.Println("Error converting stars to float64")
-			continue
-		}
-		starsInt := int(starsFloat)
-
-		// Criando um slice de inteiros do tamanho de stars
-		ratingMap["starsSlice"] = make([]int, starsInt)
-
-		// Criando um slice de inteiros do tamanho de 5 - stars
-		emptyStarsCount := 5 - starsInt
-		if emptyStarsCount < 0 {
-			emptyStarsCount = 0 // Garantindo que não seja negativo
-		}
-		ratingMap["emptyStarsSlice"] = make([]int, emptyStarsCount)
+	if reviews.Data != nil || reviews.Unavailable() {
+		recordReviews(reviews.Data)
 	}
-
-	// Retorna o status e os detalhes do produto
-	return resp.StatusCode, reviews
+	return reviews
 }
 
-func getEnv(key, defaultValue string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
+// reviewsQuery extrai da requisição os parâmetros de paginação, ordenação e
+// filtro que são repassados ao serviço reviews
+func reviewsQuery(r *http.Request) url.Values {
+	query := url.Values{}
+	for _, param := range []string{"page", "pageSize", "cursor", "sort", "minStars"} {
+		if value := r.URL.Query().Get(param); value != "" {
+			query.Set(param, value)
+		}
 	}
-	return defaultValue
+	return query
 }
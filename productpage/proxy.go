@@ -0,0 +1,163 @@
+package productpage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Cabeçalhos da resposta do serviço repassados ao cliente. Em caso de erro,
+// apenas Retry-After é mantido, pois o corpo é substituído por um APIError.
+var proxiedResponseHeaders = []string{"Content-Type", "Retry-After"}
+
+// APIError é o formato normalizado de erro das rotas /api/v1
+type APIError struct {
+	Status   int    `json:"status"`
+	Message  string `json:"message"`
+	Upstream string `json:"upstream,omitempty"`
+}
+
+func writeAPIError(w http.ResponseWriter, status int, upstream, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]APIError{
+		"error": {Status: status, Message: message, Upstream: upstream},
+	})
+}
+
+// proxyUpstream repassa GET /api/v1/products/{id}/... para o serviço informado
+// (details, reviews ou ratings), preservando o status e os cabeçalhos
+// relevantes. Erros do serviço são convertidos para o formato APIError.
+func proxyUpstream(w http.ResponseWriter, r *http.Request, upstream string) {
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || productID < 0 {
+		writeAPIError(w, http.StatusBadRequest, "", "please provide a non-negative numeric product id")
+		return
+	}
+
+	resp, err := upstreamGet(r.Context(), upstreamClient, upstream, fmt.Sprintf("/%s/%d", upstream, productID), forwardHeaders(r))
+	if err != nil {
+		if upstream == "reviews" {
+			recordReviews(nil)
+		}
+		writeAPIError(w, gatewayStatus(err), upstream, fmt.Sprintf("failed to fetch from %s service", upstream))
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		writeAPIError(w, http.StatusBadGateway, upstream, fmt.Sprintf("failed to read response from %s service", upstream))
+		return
+	}
+
+	if upstream == "reviews" {
+		switch {
+		case resp.StatusCode == http.StatusOK:
+			recordReviewsBody(body)
+		case resp.StatusCode >= 500:
+			recordReviews(nil)
+		}
+	}
+
+	if resp.StatusCode >= 400 {
+		if value := resp.Header.Get("Retry-After"); value != "" {
+			w.Header().Set("Retry-After", value)
+		}
+		writeAPIError(w, resp.StatusCode, upstream, upstreamError(resp.StatusCode, body).Error())
+		return
+	}
+
+	for _, header := range proxiedResponseHeaders {
+		if value := resp.Header.Get(header); value != "" {
+			w.Header().Set(header, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	w.Write(body)
+}
+
+// gatewayStatus é o status devolvido quando o serviço não respondeu: 504 se
+// o tempo esgotou, 502 nos demais casos
+func gatewayStatus(err error) int {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
+
+// Cliente dos streams de eventos. Não tem o Timeout de upstreamClient, que
+// cortaria o stream no meio.
+var streamClient = &http.Client{}
+
+// productRatingsStreamHandler repassa o stream de eventos de avaliação do
+// ratings, enviando cada trecho ao cliente assim que chega. O stream termina
+// quando o cliente ou o ratings fecha a conexão, ou quando o servidor é
+// desligado.
+func productRatingsStreamHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || productID < 0 {
+		writeAPIError(w, http.StatusBadRequest, "", "please provide a non-negative numeric product id")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-shuttingDown:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	resp, err := upstreamGet(ctx, streamClient, "ratings", fmt.Sprintf("/ratings/%d/stream", productID), forwardHeaders(r))
+	if err != nil {
+		writeAPIError(w, gatewayStatus(err), "ratings", "failed to fetch from ratings service")
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if value := resp.Header.Get("Retry-After"); value != "" {
+			w.Header().Set("Retry-After", value)
+		}
+		writeAPIError(w, resp.StatusCode, "ratings", upstreamError(resp.StatusCode, body).Error())
+		return
+	}
+
+	// O stream passa do WriteTimeout do servidor. Writers que não permitem
+	// mudar o prazo, como os de teste, não têm prazo.
+	controller := http.NewResponseController(w)
+	controller.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(resp.StatusCode)
+	controller.Flush()
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return
+			}
+			controller.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package productpage
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// O relay precisa entregar cada evento assim que ele chega, sem esperar o fim
+// do stream, que nunca vem
+func TestProductRatingsStreamRelaysEvents(t *testing.T) {
+	useConfig(t, func(c *Config) { c.OpenAPIValidation = "strict" })
+
+	next := make(chan string)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ratings/1/stream" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case data := <-next:
+				w.Write([]byte("event: ratings\ndata: " + data + "\n\n"))
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}))
+	defer upstream.Close()
+
+	previousUpstreams := upstreams
+	upstreams = map[string]*Upstream{
+		"ratings": newUpstream("ratings", staticResolver{upstream.URL}, "round-robin", outlierPolicy{}),
+	}
+	defer func() { upstreams = previousUpstreams }()
+
+	r, err := newRouter()
+	if err != nil {
+		t.Fatalf("setting up router: %v", err)
+	}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	// Um relay que guardasse a resposta faria o teste esperar até o timeout
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(server.URL + "/api/v1/products/1/ratings/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("got status %d and Content-Type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	lines := bufio.NewScanner(resp.Body)
+	for _, data := range []string{`{"id":1,"ratings":{"Reviewer1":5}}`, `{"id":1,"ratings":{"Reviewer1":2}}`} {
+		select {
+		case next <- data:
+		case <-time.After(5 * time.Second):
+			t.Fatal("upstream stream was not opened")
+		}
+		var got string
+		for lines.Scan() {
+			if event, found := strings.CutPrefix(lines.Text(), "data: "); found {
+				got = event
+				break
+			}
+		}
+		if got != data {
+			t.Errorf("got event %q, want %q", got, data)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package productpage
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/camilamedeir0s/bookinfo-go/ratelimit"
+	"github.com/gorilla/mux"
+)
+
+// clientKey identifica o cliente para uma regra. Sem o header end-user, o
+// usuário da sessão também serve para as regras por end-user.
+func clientKey(r *http.Request, kind string) string {
+	if kind == "end-user" && r.Header.Get("end-user") == "" {
+		if user, _ := sessionUser(r); user != "" {
+			return "user:" + user
+		}
+	}
+	return ratelimit.ClientKey(r.Header, kind, clientIP(r))
+}
+
+// clientIP é o endereço da conexão. Só quando ela vem de um dos
+// trustedProxies valem X-Forwarded-For e depois X-Real-IP, com o mesmo
+// critério do gin nos outros serviços: o cliente é o endereço mais à direita
+// que não é de um proxy confiável.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	trusted := trustedProxies(config.TrustedProxies)
+	if !isTrustedProxy(trusted, host) {
+		return host
+	}
+	for _, header := range []string{"X-Forwarded-For", "X-Real-IP"} {
+		if ip, ok := forwardedClient(r.Header.Get(header), trusted); ok {
+			return ip
+		}
+	}
+	return host
+}
+
+// forwardedClient percorre os endereços do header da direita para a
+// esquerda, pulando os proxies confiáveis. Um endereço inválido invalida o
+// header inteiro.
+func forwardedClient(header string, trusted []*net.IPNet) (string, bool) {
+	if header == "" {
+		return "", false
+	}
+	items := strings.Split(header, ",")
+	for i := len(items) - 1; i >= 0; i-- {
+		ip := strings.TrimSpace(items[i])
+		if net.ParseIP(ip) == nil {
+			return "", false
+		}
+		if i == 0 || !isTrustedProxy(trusted, ip) {
+			return ip, true
+		}
+	}
+	return "", false
+}
+
+// trustedProxies converte trustedProxies, já validado ao carregar a
+// configuração, em redes; um IP sozinho vira uma rede de um endereço
+func trustedProxies(proxies []string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, proxy := range proxies {
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			nets = append(nets, network)
+		} else if ip := net.ParseIP(proxy); ip != nil {
+			bits := 8 * len(ip)
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+		}
+	}
+	return nets
+}
+
+func isTrustedProxy(trusted []*net.IPNet, ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range trusted {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// rateLimitMiddleware monta o limitador a partir de rateLimits, já validado ao
+// carregar a configuração. As rotas são identificadas pelo método e pelo
+// modelo da rota no mux, e o cliente que esgota os tokens recebe 429 com
+// Retry-After. Devolve nil quando não há limitação configurada.
+func rateLimitMiddleware() mux.MiddlewareFunc {
+	if config.RateLimits == "" {
+		return nil
+	}
+	rules, _ := ratelimit.ParseRules(config.RateLimits)
+	log.Printf("Rate limiting enabled: %s", config.RateLimits)
+	limiter := ratelimit.New(rules)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := r.Method + " "
+			if current := mux.CurrentRoute(r); current != nil {
+				template, _ := current.GetPathTemplate()
+				route += template
+			}
+
+			allowed, wait := limiter.Allow(route, func(kind string) string { return clientKey(r, kind) })
+			if !allowed {
+				w.Header().Set("Retry-After", ratelimit.RetryAfter(wait))
+				writeAPIError(w, http.StatusTooManyRequests, "", "rate limit exceeded")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
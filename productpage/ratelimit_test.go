@@ -0,0 +1,37 @@
+package productpage
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		trusted []string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{"no trusted proxies", nil, "192.0.2.1:1234", map[string]string{"X-Forwarded-For": "203.0.113.9"}, "192.0.2.1"},
+		{"untrusted peer", []string{"10.0.0.0/8"}, "192.0.2.1:1234", map[string]string{"X-Forwarded-For": "203.0.113.9", "X-Real-IP": "203.0.113.8"}, "192.0.2.1"},
+		{"trusted peer", []string{"10.0.0.0/8"}, "10.0.0.5:1234", map[string]string{"X-Forwarded-For": "203.0.113.9"}, "203.0.113.9"},
+		{"spoofed hops before the proxies", []string{"10.0.0.5", "10.1.0.0/16"}, "10.0.0.5:1234", map[string]string{"X-Forwarded-For": "198.51.100.7, 203.0.113.9, 10.1.2.3"}, "203.0.113.9"},
+		{"only proxies", []string{"10.0.0.0/8"}, "10.0.0.5:1234", map[string]string{"X-Forwarded-For": "10.0.0.7, 10.0.0.6"}, "10.0.0.7"},
+		{"invalid forwarded address", []string{"10.0.0.0/8"}, "10.0.0.5:1234", map[string]string{"X-Forwarded-For": "unknown", "X-Real-IP": "203.0.113.8"}, "203.0.113.8"},
+		{"trusted peer without headers", []string{"10.0.0.0/8"}, "10.0.0.5:1234", nil, "10.0.0.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useConfig(t, func(c *Config) { c.TrustedProxies = tt.trusted })
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			if got := clientIP(r); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
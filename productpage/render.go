@@ -0,0 +1,134 @@
+package productpage
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// requestedProduct lê o produto de /products/{id} ou de /productpage?id=N,
+// que sem id mostra o produto 0. Responde com o erro quando o id é inválido
+// ou não está no catálogo.
+func requestedProduct(w http.ResponseWriter, r *http.Request) (Product, bool) {
+	productID := 0 // valor padrão
+
+	idParam, ok := mux.Vars(r)["id"]
+	if !ok {
+		idParam = r.URL.Query().Get("id")
+	}
+	if idParam != "" {
+		id, err := strconv.Atoi(idParam)
+		if err != nil {
+			http.Error(w, "Please provide numeric product id", http.StatusBadRequest)
+			return Product{}, false
+		}
+		productID = id
+	}
+
+	product, ok := catalog.Product(productID)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Product %d not found", productID), http.StatusNotFound)
+		return Product{}, false
+	}
+	return product, true
+}
+
+// upstreamHeaders são os cabeçalhos repassados aos serviços, com o idioma
+// escolhido no lugar do Accept-Language original
+func upstreamHeaders(r *http.Request, locale *Locale) map[string]string {
+	headers := forwardHeaders(r)
+	headers["accept-language"] = locale.Tag.String()
+	return headers
+}
+
+// renderHTML executa o template name com o cabeçalho de idioma da resposta
+func renderHTML(w http.ResponseWriter, name string, locale *Locale, data interface{}) {
+	w.Header().Set("Content-Type", "text/html")
+	w.Header().Set("Content-Language", locale.Tag.String())
+	w.Header().Add("Vary", "Accept-Language")
+
+	if err := templates.ExecuteTemplate(w, name, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// productFragmentHandler serve só a tabela de detalhes ou a lista de reviews,
+// para atualizações parciais no estilo htmx. O fragmento é devolvido com 200
+// mesmo quando o serviço falha, já com a mensagem de erro, para que a troca
+// no navegador aconteça.
+func productFragmentHandler(fragment string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		product, ok := requestedProduct(w, r)
+		if !ok {
+			return
+		}
+
+		locale := negotiateLocale(r)
+		headers := upstreamHeaders(r, locale)
+		view := ProductPageView{Locale: locale, Product: product}
+		switch fragment {
+		case "details":
+			view.Details = getProductDetails(r.Context(), product.ID, headers)
+		case "reviews":
+			view.Reviews = getProductReviews(r.Context(), product.ID, reviewsQuery(r), headers)
+			view.Pager = reviewsPager(r, product.ID, view.Reviews.Data)
+			view.ReviewsFragment = reviewsFragmentURL(product.ID, reviewsQuery(r), locale)
+		}
+
+		renderHTML(w, fragment, locale, view)
+	}
+}
+
+// preferredMediaType escolhe entre offers o tipo mais aceito pelo cabeçalho
+// Accept, considerando q e curingas como text/* e */*. Empates e requisições
+// sem Accept ficam com o primeiro de offers, que também é devolvido quando
+// nenhum é aceito, em vez de um 406.
+func preferredMediaType(r *http.Request, offers ...string) string {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return offers[0]
+	}
+
+	best, bestQ := offers[0], 0.0
+	for _, offer := range offers {
+		// q do intervalo mais específico que casa com offer
+		q, specificity := 0.0, -1
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+			rangeQ := 1.0
+			if value, ok := params["q"]; ok {
+				if rangeQ, err = strconv.ParseFloat(value, 64); err != nil {
+					continue
+				}
+			}
+			if s := mediaRangeSpecificity(mediaType, offer); s > specificity {
+				q, specificity = rangeQ, s
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// mediaRangeSpecificity diz quão específico é o intervalo que casa com
+// mediaType: 2 para o tipo exato, 1 para tipo/*, 0 para */* e -1 se não casa
+func mediaRangeSpecificity(mediaRange, mediaType string) int {
+	switch {
+	case mediaRange == mediaType:
+		return 2
+	case mediaRange == "*/*":
+		return 0
+	case strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*")):
+		return 1
+	}
+	return -1
+}
@@ -0,0 +1,71 @@
+package productpage
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPreferredMediaType(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", "text/html"},
+		{"application/json", "application/json"},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "text/html"},
+		{"application/json, text/html;q=0.5", "application/json"},
+		{"text/html;q=0.5, application/json;q=0.5", "text/html"},
+		{"application/*", "application/json"},
+		{"*/*", "text/html"},
+		{"text/*;q=0.1, */*;q=0.2", "application/json"},
+		{"application/json;q=0, */*", "text/html"},
+		{"image/png", "text/html"},
+		{"application/json;q=abc, text/html;q=0.1", "text/html"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/productpage", nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		if got := preferredMediaType(r, "text/html", "application/json"); got != tt.want {
+			t.Errorf("Accept %q: got %s, want %s", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestReviewsPagerLinks(t *testing.T) {
+	r := httptest.NewRequest("GET", "/productpage?id=3&page=2&sort=stars", nil)
+	pager := reviewsPager(r, 3, &ReviewData{Pagination: &Pagination{Page: 2, TotalPages: 3, PrevCursor: "p", NextCursor: "n"}})
+
+	// Os links são absolutos para funcionar tanto na página quanto no fragmento
+	if pager.Prev != "/products/3?cursor=p&sort=stars" || pager.NextFragment != "/products/3/reviews?cursor=n&sort=stars" {
+		t.Errorf("pager = %+v", pager)
+	}
+	if reviewsPager(r, 3, &ReviewData{}) != nil {
+		t.Error("pager without pagination")
+	}
+}
+
+func TestReviewsFragment(t *testing.T) {
+	view := ProductPageView{
+		Locale:          defaultLocale,
+		Product:         Product{ID: 3},
+		Reviews:         Section[ReviewData]{Status: 200, Data: &ReviewData{Reviews: []Review{{Reviewer: "Reviewer1", Text: "Great"}}, Pagination: &Pagination{Page: 1, TotalPages: 2, NextCursor: "n"}}},
+		ReviewsFragment: "/products/3/reviews?lang=en",
+	}
+	view.Pager = reviewsPager(httptest.NewRequest("GET", "/products/3/reviews", nil), 3, view.Reviews.Data)
+
+	var fragment strings.Builder
+	if err := templates.ExecuteTemplate(&fragment, "reviews", view); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`id="reviews"`, "Reviewer1", `hx-get="/products/3/reviews?lang=en"`, `href="/products/3?cursor=n"`, `hx-get="/products/3/reviews?cursor=n"`} {
+		if !strings.Contains(fragment.String(), want) {
+			t.Errorf("fragment does not contain %q:\n%s", want, fragment.String())
+		}
+	}
+	if strings.Contains(fragment.String(), "<title>") {
+		t.Error("fragment contains the whole page")
+	}
+}
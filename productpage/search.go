@@ -0,0 +1,248 @@
+package productpage
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Peso de cada campo no cálculo de relevância da busca
+const (
+	titleWeight       = 3
+	authorWeight      = 2
+	publisherWeight   = 1
+	descriptionWeight = 1
+)
+
+// Intervalo até uma nova tentativa quando o details não respondeu durante a
+// construção do índice
+var searchIndexRetry = 30 * time.Second
+
+var htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// SearchResult é um produto encontrado pela busca
+type SearchResult struct {
+	ID        int    `json:"id"`
+	Title     string `json:"title"`
+	Author    string `json:"author,omitempty"`
+	Publisher string `json:"publisher,omitempty"`
+	Score     int    `json:"score"`
+}
+
+type searchDocument struct {
+	product   Product
+	author    string
+	publisher string
+}
+
+// SearchIndex é um índice invertido em memória de termo -> produto -> peso,
+// reconstruído a partir do catálogo e dos dados do serviço details
+type SearchIndex struct {
+	mu        sync.RWMutex
+	postings  map[string]map[int]int
+	terms     []string // termos de postings em ordem, para a busca por prefixo
+	documents map[int]searchDocument
+	retry     *time.Timer
+	stopped   bool
+
+	// products é a lista da reconstrução mais recente, usada pelas novas
+	// tentativas para não voltar a um catálogo já substituído
+	products []Product
+
+	// generation descarta reconstruções que terminaram depois de uma mais nova
+	generation int
+}
+
+func newSearchIndex() *SearchIndex {
+	return &SearchIndex{
+		postings:  map[string]map[int]int{},
+		documents: map[int]searchDocument{},
+	}
+}
+
+// Rebuild reconstrói o índice para os produtos informados. Autor e editora são
+// buscados no serviço details; se ele falhar, o produto é indexado só com os
+// dados do catálogo e uma nova reconstrução é agendada.
+func (idx *SearchIndex) Rebuild(products []Product) {
+	idx.mu.Lock()
+	idx.products = products
+	idx.generation++
+	generation := idx.generation
+	idx.mu.Unlock()
+
+	postings := map[string]map[int]int{}
+	documents := make(map[int]searchDocument, len(products))
+	detailsMissing := false
+
+	add := func(text string, productID, weight int) {
+		for _, term := range tokenize(text) {
+			if postings[term] == nil {
+				postings[term] = map[int]int{}
+			}
+			postings[term][productID] += weight
+		}
+	}
+
+	for _, product := range products {
+		doc := searchDocument{product: product}
+
+		if details := getProductDetails(context.Background(), product.ID, map[string]string{}); details.Data != nil {
+			doc.author = details.Data.Author
+			doc.publisher = details.Data.Publisher
+		} else {
+			detailsMissing = true
+		}
+
+		add(product.Title, product.ID, titleWeight)
+		add(htmlTagPattern.ReplaceAllString(product.DescriptionHtml, " "), product.ID, descriptionWeight)
+		add(doc.author, product.ID, authorWeight)
+		add(doc.publisher, product.ID, publisherWeight)
+		documents[product.ID] = doc
+	}
+
+	terms := make([]string, 0, len(postings))
+	for term := range postings {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if generation != idx.generation {
+		return
+	}
+	idx.postings = postings
+	idx.terms = terms
+	idx.documents = documents
+
+	if idx.retry != nil {
+		idx.retry.Stop()
+		idx.retry = nil
+	}
+	if detailsMissing && !idx.stopped {
+		log.Printf("Search index built without details for some products, retrying in %s", searchIndexRetry)
+		idx.retry = time.AfterFunc(searchIndexRetry, idx.retryRebuild)
+	}
+}
+
+// stop cancela a nova tentativa agendada, e as que viriam depois, quando a
+// productpage é encerrada
+func (idx *SearchIndex) stop() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.stopped = true
+	if idx.retry != nil {
+		idx.retry.Stop()
+		idx.retry = nil
+	}
+}
+
+// retryRebuild reconstrói o índice com os produtos mais recentes, que podem
+// ter mudado desde a reconstrução que agendou a nova tentativa
+func (idx *SearchIndex) retryRebuild() {
+	idx.mu.RLock()
+	products := idx.products
+	idx.mu.RUnlock()
+	idx.Rebuild(products)
+}
+
+// Search devolve os produtos que contêm todos os termos da consulta, ordenados
+// por relevância. Um termo também casa com palavras que comecem por ele.
+func (idx *SearchIndex) Search(query string) []SearchResult {
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return []SearchResult{}
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var scores map[int]int
+	for _, term := range terms {
+		// Os termos que começam por term são contíguos na lista ordenada
+		termScores := map[int]int{}
+		for i := sort.SearchStrings(idx.terms, term); i < len(idx.terms) && strings.HasPrefix(idx.terms[i], term); i++ {
+			for productID, weight := range idx.postings[idx.terms[i]] {
+				termScores[productID] += weight
+			}
+		}
+
+		if scores == nil {
+			scores = termScores
+			continue
+		}
+		for productID := range scores {
+			if weight, ok := termScores[productID]; ok {
+				scores[productID] += weight
+			} else {
+				delete(scores, productID)
+			}
+		}
+	}
+
+	results := make([]SearchResult, 0, len(scores))
+	for productID, score := range scores {
+		doc := idx.documents[productID]
+		results = append(results, SearchResult{
+			ID:        productID,
+			Title:     doc.product.Title,
+			Author:    doc.author,
+			Publisher: doc.publisher,
+			Score:     score,
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].ID < results[j].ID
+	})
+	return results
+}
+
+// tokenize separa o texto em termos minúsculos, ignorando pontuação
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+func productSearchHandler(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		writeAPIError(w, http.StatusBadRequest, "", "please provide a search query in the q parameter")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"query":   query,
+		"results": searchIndex.Search(query),
+	})
+}
+
+func searchPageHandler(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	var results []SearchResult
+	if query != "" {
+		results = searchIndex.Search(query)
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+
+	if err := templates.ExecuteTemplate(w, "search.html", map[string]interface{}{
+		"Locale":  negotiateLocale(r),
+		"query":   query,
+		"results": results,
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,204 @@
+package productpage
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// useDetails faz o upstream details responder com handler durante o teste
+func useDetails(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	upstream := httptest.NewServer(handler)
+	t.Cleanup(upstream.Close)
+
+	previous := upstreams
+	upstreams = map[string]*Upstream{
+		"details": newUpstream("details", staticResolver{upstream.URL}, "round-robin", outlierPolicy{}),
+	}
+	t.Cleanup(func() { upstreams = previous })
+}
+
+// detailsByID responde como o details, com o autor e a editora de cada produto
+func detailsByID(books map[int][2]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var id int
+		fmt.Sscanf(r.URL.Path, "/details/%d", &id)
+		book, ok := books[id]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": id, "author": book[0], "publisher": book[1]})
+	}
+}
+
+func resultIDs(results []SearchResult) []int {
+	ids := []int{}
+	for _, result := range results {
+		ids = append(ids, result.ID)
+	}
+	return ids
+}
+
+func TestSearch(t *testing.T) {
+	useDetails(t, detailsByID(map[int][2]string{
+		1: {"William Shakespeare", "Penguin"},
+		2: {"Jane Austen", "Shakespeare & Co"},
+		3: {"Herman Melville", "Harper"},
+	}))
+
+	idx := newSearchIndex()
+	idx.Rebuild([]Product{
+		{ID: 1, Title: "The Comedy of Errors", DescriptionHtml: "<b>Twins</b> and mistaken identity"},
+		{ID: 2, Title: "Pride and Prejudice", DescriptionHtml: "A comedy of manners"},
+		{ID: 3, Title: "Moby-Dick", DescriptionHtml: `<a href="https://en.wikipedia.org/wiki/Comedy">Whaling</a>`},
+	})
+
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		// O título pesa mais que a descrição
+		{"comedy", []int{1, 2}},
+		// Autor pesa mais que editora
+		{"shakespeare", []int{1, 2}},
+		{"austen", []int{2}},
+		// Prefixos, maiúsculas e pontuação
+		{"COM", []int{1, 2}},
+		{"moby dick", []int{3}},
+		{"moby-dick!", []int{3}},
+		{"whal", []int{3}},
+		// Todos os termos precisam casar
+		{"comedy twins", []int{1}},
+		{"comedy whaling", []int{}},
+		// Só o texto das tags HTML é indexado
+		{"href", []int{}},
+		{"wikipedia", []int{}},
+		{"zzz", []int{}},
+		{"a", []int{2, 1}},
+		{"  ", []int{}},
+	}
+	for _, tt := range tests {
+		if got := resultIDs(idx.Search(tt.query)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	results := idx.Search("comedy")
+	if want := (SearchResult{ID: 1, Title: "The Comedy of Errors", Author: "William Shakespeare", Publisher: "Penguin", Score: titleWeight}); results[0] != want {
+		t.Errorf("got first result %+v, want %+v", results[0], want)
+	}
+	if results[1].Score != descriptionWeight {
+		t.Errorf("got score %d for a description match, want %d", results[1].Score, descriptionWeight)
+	}
+
+	// Uma reconstrução substitui o índice inteiro
+	idx.Rebuild([]Product{{ID: 3, Title: "Moby-Dick"}})
+	if got := resultIDs(idx.Search("comedy")); len(got) != 0 {
+		t.Errorf("got %v for products no longer in the catalog", got)
+	}
+}
+
+func TestSearchRetryUsesLatestCatalog(t *testing.T) {
+	previousRetry := searchIndexRetry
+	searchIndexRetry = 20 * time.Millisecond
+	defer func() { searchIndexRetry = previousRetry }()
+
+	// O details começa fora do ar e depois fica lento, de modo que a nova
+	// tentativa agendada pela primeira reconstrução roda durante a segunda
+	var available atomic.Bool
+	var blocked atomic.Int32
+	release := make(chan struct{})
+	books := detailsByID(map[int][2]string{1: {"Old Author", "P"}, 2: {"New Author", "P"}})
+	useDetails(t, func(w http.ResponseWriter, r *http.Request) {
+		if !available.Load() {
+			http.Error(w, `{"error":"unavailable"}`, http.StatusServiceUnavailable)
+			return
+		}
+		blocked.Add(1)
+		<-release
+		books(w, r)
+	})
+
+	idx := newSearchIndex()
+	idx.Rebuild([]Product{{ID: 1, Title: "Old"}})
+	if got := resultIDs(idx.Search("old")); !reflect.DeepEqual(got, []int{1}) {
+		t.Fatalf("got %v without details, want the catalog data indexed", got)
+	}
+
+	available.Store(true)
+	done := make(chan struct{})
+	go func() {
+		idx.Rebuild([]Product{{ID: 2, Title: "New"}})
+		close(done)
+	}()
+	for deadline := time.Now().Add(5 * time.Second); blocked.Load() < 2; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the retry did not run during the second rebuild")
+		}
+	}
+	close(release)
+	<-done
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		idx.mu.RLock()
+		pending := idx.retry != nil
+		idx.mu.RUnlock()
+		if got := resultIDs(idx.Search("author")); reflect.DeepEqual(got, []int{2}) && !pending {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %v for author, want only the newer catalog", resultIDs(idx.Search("author")))
+		}
+	}
+	if got := resultIDs(idx.Search("old")); len(got) != 0 {
+		t.Errorf("the retry brought back the replaced catalog: %v", got)
+	}
+}
+
+func TestProductSearchHandler(t *testing.T) {
+	useDetails(t, detailsByID(map[int][2]string{}))
+	previous := searchIndex
+	searchIndex = newSearchIndex()
+	searchIndex.Rebuild([]Product{{ID: 4, Title: "Hamlet"}})
+	defer func() { searchIndex = previous }()
+
+	rec := httptest.NewRecorder()
+	productSearchHandler(rec, httptest.NewRequest("GET", "/api/v1/products/search?q=+", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("got status %d for an empty query, want 400", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	productSearchHandler(rec, httptest.NewRequest("GET", "/api/v1/products/search?q=ham", nil))
+	var body struct {
+		Query   string         `json:"query"`
+		Results []SearchResult `json:"results"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Query != "ham" || !reflect.DeepEqual(resultIDs(body.Results), []int{4}) {
+		t.Errorf("got %+v", body)
+	}
+
+	rec = httptest.NewRecorder()
+	searchPageHandler(rec, httptest.NewRequest("GET", "/search?q=ham", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Hamlet") {
+		t.Errorf("got status %d and page without the result", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	searchPageHandler(rec, httptest.NewRequest("GET", "/search?q=xyz&lang=pt-BR", nil))
+	if page := rec.Body.String(); !strings.Contains(page, "Buscar livros") || !strings.Contains(page, "Nenhum livro encontrado para &#34;xyz&#34;") {
+		t.Errorf("got a page without the pt-BR strings:\n%s", page)
+	}
+}
@@ -0,0 +1,83 @@
+package productpage
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Server é a productpage montada por New: a Main a atende na porta
+// configurada, e os testes de integração num listener próprio
+type Server struct {
+	// Handler atende as páginas e a API
+	Handler http.Handler
+	index   *SearchIndex
+}
+
+// Close cancela as novas tentativas de construir o índice de busca e fecha as
+// conexões gRPC abertas com os upstreams
+func (s *Server) Close(context.Context) {
+	s.index.stop()
+	closeGRPCConns()
+}
+
+// draining é ligado quando chega o sinal de desligamento. A partir daí o
+// /health falha, para o pod sair do balanceamento antes de as conexões serem
+// encerradas.
+var draining atomic.Bool
+
+// shuttingDown é fechado quando o servidor começa a encerrar as conexões, para
+// que os streams de eventos terminem em vez de segurar o desligamento
+var shuttingDown = make(chan struct{})
+
+// serve atende handler em addr até receber SIGINT ou SIGTERM. Com o sinal, o
+// serviço passa a falhar a readiness por drainPeriod e então para de aceitar
+// conexões, esperando até shutdownTimeout pelas requisições em andamento. As
+// funções de cleanup rodam por último.
+func serve(addr string, handler http.Handler, cleanup ...func(context.Context)) {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		ReadTimeout:       config.ReadTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	errs := make(chan error, 1)
+	go func() {
+		log.Printf("Server started at %s\n", addr)
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+	stop()
+
+	drain := config.DrainPeriod
+	log.Printf("Shutting down, failing readiness for %s before draining", drain)
+	draining.Store(true)
+	time.Sleep(drain)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+	close(shuttingDown)
+	if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("Server did not drain cleanly: %v", err)
+	}
+	for _, fn := range cleanup {
+		fn(shutdownCtx)
+	}
+	log.Println("Shutdown complete")
+}
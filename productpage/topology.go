@@ -0,0 +1,324 @@
+package productpage
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Quantidade de sondagens guardadas por endpoint para latência e taxa de erro
+const probeWindow = 20
+
+// TopologyNode é um endpoint de um serviço, com o resultado das sondagens
+type TopologyNode struct {
+	Service   string     `json:"service"`
+	URL       string     `json:"url"`
+	Version   string     `json:"version,omitempty"`
+	Cluster   string     `json:"cluster,omitempty"`
+	Zone      string     `json:"zone,omitempty"`
+	Health    string     `json:"health"`
+	LatencyMs float64    `json:"latencyMs"`
+	ErrorRate float64    `json:"errorRate"`
+	Ejected   bool       `json:"ejected,omitempty"`
+	LastProbe *time.Time `json:"lastProbe,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// ErrorPercent é a taxa de erro em porcentagem, para os templates
+func (n TopologyNode) ErrorPercent() float64 {
+	return n.ErrorRate * 100
+}
+
+// TopologyEdge indica que o serviço From chama o serviço To
+type TopologyEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type Topology struct {
+	Nodes []TopologyNode `json:"nodes"`
+	Edges []TopologyEdge `json:"edges"`
+}
+
+type probeResult struct {
+	at      time.Time
+	latency time.Duration
+	ok      bool
+}
+
+// probeStats guarda as últimas sondagens de um endpoint
+type probeStats struct {
+	version string
+	health  string
+	err     string
+	results []probeResult
+}
+
+func (s *probeStats) add(result probeResult) {
+	s.results = append(s.results, result)
+	if len(s.results) > probeWindow {
+		s.results = s.results[len(s.results)-probeWindow:]
+	}
+}
+
+// topologyProber sonda o /health de cada endpoint dos upstreams em background
+type topologyProber struct {
+	client *http.Client
+
+	mu    sync.Mutex
+	stats map[string]*probeStats
+}
+
+var prober = &topologyProber{
+	client: &http.Client{Timeout: 2 * time.Second},
+	stats:  map[string]*probeStats{},
+}
+
+// run sonda todos os endpoints a cada interval
+func (p *topologyProber) run(interval time.Duration) {
+	p.probeAll()
+	for range time.Tick(interval) {
+		p.probeAll()
+	}
+}
+
+// probeAll sonda os endpoints atuais em paralelo e descarta o histórico dos que
+// saíram da descoberta
+func (p *topologyProber) probeAll() {
+	current := map[string]bool{}
+	var wg sync.WaitGroup
+	for _, upstream := range upstreams {
+		for _, state := range upstream.states() {
+			current[state.url] = true
+			wg.Add(1)
+			go func(url string) {
+				defer wg.Done()
+				p.probe(url)
+			}(state.url)
+		}
+	}
+	wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for url := range p.stats {
+		if !current[url] {
+			delete(p.stats, url)
+		}
+	}
+}
+
+// probe faz um GET em url/health e registra o resultado. Os serviços respondem
+// {"status": ..., "version": ...}; 503 indica que o serviço está drenando.
+func (p *topologyProber) probe(url string) {
+	start := time.Now()
+	resp, err := p.client.Get(url + "/health")
+	latency := time.Since(start)
+
+	health, version, message := "unreachable", "", ""
+	if err != nil {
+		message = err.Error()
+	} else {
+		var body struct {
+			Status  string `json:"status"`
+			Version string `json:"version"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+
+		version = body.Version
+		switch {
+		case resp.StatusCode == http.StatusOK:
+			health = "healthy"
+		case resp.StatusCode == http.StatusServiceUnavailable:
+			health, message = "draining", body.Status
+		default:
+			health, message = "unhealthy", fmt.Sprintf("status %d %s", resp.StatusCode, body.Status)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats, exists := p.stats[url]
+	if !exists {
+		stats = &probeStats{}
+		p.stats[url] = stats
+	}
+	if version != "" {
+		stats.version = version
+	}
+	stats.health, stats.err = health, message
+	stats.add(probeResult{at: start, latency: latency, ok: health == "healthy"})
+}
+
+// node monta o nó de um endpoint a partir das sondagens registradas
+func (p *topologyProber) node(service string, state endpointState) TopologyNode {
+	node := TopologyNode{
+		Service: service,
+		URL:     state.url,
+		Cluster: state.locality.cluster,
+		Zone:    state.locality.zone,
+		Health:  "unknown",
+		Ejected: state.ejected,
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats, exists := p.stats[state.url]
+	if !exists || len(stats.results) == 0 {
+		return node
+	}
+
+	var total time.Duration
+	failures := 0
+	for _, result := range stats.results {
+		total += result.latency
+		if !result.ok {
+			failures++
+		}
+	}
+	last := stats.results[len(stats.results)-1].at
+
+	node.Version = stats.version
+	node.Health = stats.health
+	node.Error = stats.err
+	node.LatencyMs = float64(total.Microseconds()) / 1000 / float64(len(stats.results))
+	node.ErrorRate = float64(failures) / float64(len(stats.results))
+	node.LastProbe = &last
+	return node
+}
+
+// currentTopology monta o grafo a partir da árvore de serviços: a própria
+// productpage e, para cada serviço chamado, um nó por endpoint descoberto
+func currentTopology() Topology {
+	root := services["productpage"]
+
+	health := "healthy"
+	if draining.Load() {
+		health = "draining"
+	}
+	topology := Topology{
+		Nodes: []TopologyNode{{
+			Service: root.Endpoint,
+			URL:     root.Name,
+			Version: config.ServiceVersion,
+			Cluster: config.ClusterName,
+			Zone:    config.Zone,
+			Health:  health,
+		}},
+		Edges: []TopologyEdge{},
+	}
+
+	seen := map[string]bool{root.Endpoint: true}
+	var walk func(parent Service)
+	walk = func(parent Service) {
+		for _, child := range parent.Children {
+			topology.Edges = append(topology.Edges, TopologyEdge{From: parent.Endpoint, To: child.Endpoint})
+			if seen[child.Endpoint] {
+				continue
+			}
+			seen[child.Endpoint] = true
+
+			states := []endpointState{{url: child.Name}}
+			if upstream, exists := upstreams[child.Endpoint]; exists {
+				states = upstream.states()
+			}
+			for _, state := range states {
+				topology.Nodes = append(topology.Nodes, prober.node(child.Endpoint, state))
+			}
+			walk(child)
+		}
+	}
+	walk(root)
+	return topology
+}
+
+// dot escreve a topologia no formato DOT do Graphviz, com um nó por endpoint e
+// arestas entre todos os endpoints de serviços que se chamam
+func (t Topology) dot() string {
+	colors := map[string]string{"healthy": "darkgreen", "draining": "orange", "unhealthy": "red", "unreachable": "red"}
+	quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace
+
+	var b strings.Builder
+	b.WriteString("digraph bookinfo {\n\trankdir=LR;\n\tnode [shape=box, fontname=\"sans-serif\"];\n")
+
+	byService := map[string][]string{}
+	for _, node := range t.Nodes {
+		id := node.Service + "@" + node.URL
+		byService[node.Service] = append(byService[node.Service], id)
+
+		lines := []string{node.Service, node.URL}
+		if node.Cluster != "" {
+			lines = append(lines, strings.TrimSuffix(node.Cluster+"/"+node.Zone, "/"))
+		}
+		status := node.Health
+		if node.Version != "" {
+			status = node.Version + " " + status
+		}
+		if node.Ejected {
+			status += " (ejected)"
+		}
+		lines = append(lines, status)
+		if node.LastProbe != nil {
+			lines = append(lines, fmt.Sprintf("%.1f ms, %.0f%% errors", node.LatencyMs, node.ErrorPercent()))
+		}
+		for i := range lines {
+			lines[i] = quote(lines[i])
+		}
+
+		color := colors[node.Health]
+		if color == "" {
+			color = "gray"
+		}
+		fmt.Fprintf(&b, "\t\"%s\" [label=\"%s\", color=%s];\n", quote(id), strings.Join(lines, `\n`), color)
+	}
+
+	for _, edge := range t.Edges {
+		for _, from := range byService[edge.From] {
+			for _, to := range byService[edge.To] {
+				fmt.Fprintf(&b, "\t\"%s\" -> \"%s\";\n", quote(from), quote(to))
+			}
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// topologyHandler devolve a topologia em JSON ou, com ?format=dot ou
+// Accept: text/vnd.graphviz, em DOT
+func topologyHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+		if strings.Contains(r.Header.Get("Accept"), "text/vnd.graphviz") {
+			format = "dot"
+		}
+	}
+
+	topology := currentTopology()
+	switch format {
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(topology)
+	case "dot":
+		w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+		fmt.Fprint(w, topology.dot())
+	default:
+		writeAPIError(w, http.StatusBadRequest, "", "format must be json or dot")
+	}
+}
+
+// selfURL é o endereço da própria productpage mostrado na topologia
+func selfURL() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Printf("Could not get hostname: %v", err)
+		hostname = "localhost"
+	}
+	return fmt.Sprintf("http://%s:%d", hostname, config.Port)
+}
@@ -0,0 +1,74 @@
+package productpage
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSetupServicesTopology(t *testing.T) {
+	useConfig(t, func(c *Config) {})
+
+	root := setupServices()["productpage"]
+	if root.Endpoint != "productpage" || root.Name == config.upstreamURL(config.DetailsHostname, config.DetailsPort) {
+		t.Errorf("productpage entry points at %s (%s)", root.Name, root.Endpoint)
+	}
+	var children []string
+	for _, child := range root.Children {
+		children = append(children, child.Endpoint)
+	}
+	if got := strings.Join(children, ","); got != "details,reviews,ratings" {
+		t.Errorf("got productpage children %s", got)
+	}
+}
+
+func TestProbeRecordsHealthAndVersion(t *testing.T) {
+	draining := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if draining {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, `{"status":"Reviews is shutting down","version":"v2"}`)
+			return
+		}
+		io.WriteString(w, `{"status":"Reviews is healthy","version":"v2"}`)
+	}))
+	defer server.Close()
+
+	p := &topologyProber{client: server.Client(), stats: map[string]*probeStats{}}
+	p.probe(server.URL)
+	draining = true
+	p.probe(server.URL)
+
+	node := p.node("reviews", endpointState{url: server.URL})
+	if node.Version != "v2" || node.Health != "draining" {
+		t.Errorf("got version %q and health %q", node.Version, node.Health)
+	}
+	if node.ErrorRate != 0.5 || node.LastProbe == nil {
+		t.Errorf("got error rate %v after one failed probe of two", node.ErrorRate)
+	}
+
+	p.probe("http://127.0.0.1:1")
+	if node := p.node("reviews", endpointState{url: "http://127.0.0.1:1"}); node.Health != "unreachable" || node.Error == "" {
+		t.Errorf("got health %q for a closed port", node.Health)
+	}
+}
+
+func TestTopologyDOTEscapesLabels(t *testing.T) {
+	topology := Topology{
+		Nodes: []TopologyNode{
+			{Service: "productpage", URL: "http://productpage:9080", Health: "healthy"},
+			{Service: "details", URL: `http://evil"host:9084`, Health: "unreachable"},
+		},
+		Edges: []TopologyEdge{{From: "productpage", To: "details"}},
+	}
+
+	dot := topology.dot()
+	if !strings.Contains(dot, `"details@http://evil\"host:9084"`) {
+		t.Errorf("quote not escaped:\n%s", dot)
+	}
+	if !strings.Contains(dot, `"productpage@http://productpage:9080" -> "details@http://evil\"host:9084";`) {
+		t.Errorf("missing edge:\n%s", dot)
+	}
+}
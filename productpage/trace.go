@@ -0,0 +1,180 @@
+package productpage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// TraceCall é uma chamada feita a um serviço de backend durante a requisição.
+// PodName e ClusterName indicam quem respondeu, quando o serviço informa.
+type TraceCall struct {
+	Upstream    string  `json:"upstream"`
+	Protocol    string  `json:"protocol"`
+	URL         string  `json:"url"`
+	Status      int     `json:"status"`
+	StartMs     float64 `json:"startMs"`
+	DurationMs  float64 `json:"durationMs"`
+	Retries     int     `json:"retries"`
+	Bytes       int64   `json:"bytes"`
+	PodName     string  `json:"podname,omitempty"`
+	ClusterName string  `json:"clustername,omitempty"`
+	Error       string  `json:"error,omitempty"`
+
+	start time.Time
+}
+
+// OffsetPercent e WidthPercent posicionam a barra da chamada na cascata
+func (c TraceCall) OffsetPercent(total float64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return c.StartMs / total * 100
+}
+
+func (c TraceCall) WidthPercent(total float64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return max(c.DurationMs/total*100, 0.5)
+}
+
+// CallTrace registra as chamadas de uma requisição com ?debug=trace. Todos os
+// métodos aceitam um *CallTrace nil, que não registra nada.
+type CallTrace struct {
+	start time.Time
+
+	mu    sync.Mutex
+	calls []*TraceCall
+}
+
+func newCallTrace() *CallTrace {
+	return &CallTrace{start: time.Now()}
+}
+
+type traceKey struct{}
+
+func withTrace(ctx context.Context, trace *CallTrace) context.Context {
+	return context.WithValue(ctx, traceKey{}, trace)
+}
+
+// traceFrom devolve o trace da requisição, ou nil se ela não está sendo
+// rastreada
+func traceFrom(ctx context.Context) *CallTrace {
+	trace, _ := ctx.Value(traceKey{}).(*CallTrace)
+	return trace
+}
+
+// begin registra o início de uma chamada
+func (t *CallTrace) begin(upstream, protocol, url string) *TraceCall {
+	if t == nil {
+		return nil
+	}
+	now := time.Now()
+	call := &TraceCall{
+		Upstream: upstream,
+		Protocol: protocol,
+		URL:      url,
+		StartMs:  milliseconds(now.Sub(t.start)),
+		start:    now,
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.calls = append(t.calls, call)
+	return call
+}
+
+// retry registra uma nova tentativa da chamada, em outra URL
+func (t *CallTrace) retry(call *TraceCall, url string) {
+	if t == nil || call == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	call.URL = url
+	call.Retries++
+}
+
+// end completa a chamada com o resultado
+func (t *CallTrace) end(call *TraceCall, status int, bytes int64, err error) {
+	if t == nil || call == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	call.Status = status
+	call.Bytes = bytes
+	call.DurationMs = milliseconds(time.Since(call.start))
+	if err != nil {
+		call.Error = err.Error()
+	}
+}
+
+// servedBy registra o pod e o cluster que atenderam a chamada
+func (t *CallTrace) servedBy(call *TraceCall, podName, clusterName string) {
+	if t == nil || call == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	call.PodName, call.ClusterName = podName, clusterName
+}
+
+// TraceSummary é a visão do trace entregue ao template e em JSON
+type TraceSummary struct {
+	TotalMs float64     `json:"totalMs"`
+	Calls   []TraceCall `json:"calls"`
+}
+
+// summary copia as chamadas registradas até agora
+func (t *CallTrace) summary() TraceSummary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	summary := TraceSummary{TotalMs: milliseconds(time.Since(t.start)), Calls: make([]TraceCall, len(t.calls))}
+	for i, call := range t.calls {
+		summary.Calls[i] = *call
+	}
+	return summary
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// tracedBody conta os bytes lidos da resposta e completa a chamada no Close.
+// O corpo também é guardado para extrair podname e clustername, que os
+// serviços incluem nas respostas JSON.
+type tracedBody struct {
+	io.ReadCloser
+	trace  *CallTrace
+	call   *TraceCall
+	status int
+	body   bytes.Buffer
+	once   sync.Once
+}
+
+func (b *tracedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.body.Write(p[:n])
+	return n, err
+}
+
+func (b *tracedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		var servedBy struct {
+			PodName     string `json:"podname"`
+			ClusterName string `json:"clustername"`
+		}
+		if json.Unmarshal(b.body.Bytes(), &servedBy) == nil {
+			b.trace.servedBy(b.call, servedBy.PodName, servedBy.ClusterName)
+		}
+		b.trace.end(b.call, b.status, int64(b.body.Len()), nil)
+	})
+	return err
+}
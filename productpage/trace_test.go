@@ -0,0 +1,54 @@
+package productpage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUpstreamGetRecordsTrace(t *testing.T) {
+	useConfig(t, func(c *Config) {})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"id":"1","podname":"reviews-v2-abc","clustername":"east","version":"v2","reviews":[]}`)
+	}))
+	defer server.Close()
+
+	previous := upstreams
+	upstreams = map[string]*Upstream{
+		// O endpoint fechado vem primeiro na ordem do round robin
+		"reviews": newUpstream("reviews", staticResolver{"http://127.0.0.1:1", server.URL}, "round-robin", outlierPolicy{}),
+	}
+	defer func() { upstreams = previous }()
+
+	trace := newCallTrace()
+	resp, err := upstreamGet(withTrace(context.Background(), trace), server.Client(), "reviews", "/reviews/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	calls := trace.summary().Calls
+	if len(calls) != 1 {
+		t.Fatalf("got %d calls, want 1", len(calls))
+	}
+	call := calls[0]
+	if call.URL != server.URL+"/reviews/1" || call.Status != http.StatusOK || call.Retries != 1 {
+		t.Errorf("got %s with status %d after %d retries", call.URL, call.Status, call.Retries)
+	}
+	if call.PodName != "reviews-v2-abc" || call.ClusterName != "east" || call.Bytes == 0 {
+		t.Errorf("got pod %q, cluster %q and %d bytes", call.PodName, call.ClusterName, call.Bytes)
+	}
+}
+
+func TestUntracedRequestsRecordNothing(t *testing.T) {
+	var trace *CallTrace
+	call := trace.begin("details", "http", "http://details:9084/details/0")
+	trace.end(call, http.StatusOK, 10, nil)
+	if traceFrom(context.Background()) != nil {
+		t.Error("got a trace without debug=trace")
+	}
+}
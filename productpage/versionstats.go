@@ -0,0 +1,170 @@
+package productpage
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Limite de respostas guardadas, para a memória não crescer sem controle sob
+// carga alta com uma janela longa
+const maxVersionObservations = 100000
+
+// servedBy identifica a instância do reviews que atendeu uma requisição.
+// Version é "unavailable" quando o reviews não respondeu.
+type servedBy struct {
+	Version string
+	Pod     string
+	Cluster string
+}
+
+// reviewsServedBy usa a versão informada pelo próprio reviews; respostas sem
+// ela, de instâncias antigas, contam como "unknown"
+func reviewsServedBy(data ReviewData) servedBy {
+	served := servedBy{Version: data.Version, Pod: data.PodName, Cluster: data.ClusterName}
+	if served.Version == "" {
+		served.Version = "unknown"
+	}
+	return served
+}
+
+type versionObservation struct {
+	at time.Time
+	servedBy
+}
+
+// versionRecorder guarda quem atendeu cada chamada ao reviews dentro da
+// janela configurada, em ordem de chegada
+type versionRecorder struct {
+	mu           sync.Mutex
+	observations []versionObservation
+}
+
+var versionStats = &versionRecorder{}
+
+// recordReviews registra uma resposta do reviews; nil indica que o reviews
+// não pôde ser consultado
+func recordReviews(data *ReviewData) {
+	if data == nil {
+		versionStats.record(servedBy{Version: "unavailable"}, time.Now())
+		return
+	}
+	versionStats.record(reviewsServedBy(*data), time.Now())
+}
+
+// recordReviewsBody registra uma resposta do reviews ainda em JSON
+func recordReviewsBody(body []byte) {
+	var data ReviewData
+	if json.Unmarshal(body, &data) != nil {
+		recordReviews(nil)
+		return
+	}
+	recordReviews(&data)
+}
+
+func (r *versionRecorder) record(served servedBy, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.observations = append(r.observations, versionObservation{at: at, servedBy: served})
+	r.prune(at)
+}
+
+// prune descarta o que saiu da janela ou excede o limite. Chamado com mu
+// travado.
+func (r *versionRecorder) prune(now time.Time) {
+	cutoff := now.Add(-config.VersionStatsWindow)
+	drop := sort.Search(len(r.observations), func(i int) bool {
+		return r.observations[i].at.After(cutoff)
+	})
+	drop = max(drop, len(r.observations)-maxVersionObservations)
+	if drop > 0 {
+		r.observations = append(r.observations[:0], r.observations[drop:]...)
+	}
+}
+
+// VersionShare é a fatia das respostas atendidas por uma versão, um pod ou um
+// cluster
+type VersionShare struct {
+	Version  string  `json:"version,omitempty"`
+	Pod      string  `json:"pod,omitempty"`
+	Cluster  string  `json:"cluster,omitempty"`
+	Requests int     `json:"requests"`
+	Percent  float64 `json:"percent"`
+}
+
+// VersionStats é a distribuição das respostas do reviews na janela
+type VersionStats struct {
+	WindowSeconds float64        `json:"windowSeconds"`
+	Total         int            `json:"total"`
+	Versions      []VersionShare `json:"versions"`
+	Pods          []VersionShare `json:"pods"`
+	Clusters      []VersionShare `json:"clusters"`
+}
+
+// snapshot calcula a distribuição das respostas dos últimos window
+func (r *versionRecorder) snapshot(window time.Duration, now time.Time) VersionStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.prune(now)
+
+	stats := VersionStats{WindowSeconds: window.Seconds(), Versions: []VersionShare{}, Pods: []VersionShare{}, Clusters: []VersionShare{}}
+	versions := map[string]int{}
+	pods := map[servedBy]int{}
+	clusters := map[string]int{}
+	cutoff := now.Add(-window)
+	for _, observation := range r.observations {
+		if !observation.at.After(cutoff) {
+			continue
+		}
+		stats.Total++
+		versions[observation.Version]++
+		if observation.Pod != "" {
+			pods[observation.servedBy]++
+		}
+		if observation.Version != "unavailable" {
+			clusters[observation.Cluster]++
+		}
+	}
+
+	for version, n := range versions {
+		stats.Versions = append(stats.Versions, VersionShare{Version: version, Requests: n})
+	}
+	for pod, n := range pods {
+		stats.Pods = append(stats.Pods, VersionShare{Version: pod.Version, Pod: pod.Pod, Cluster: pod.Cluster, Requests: n})
+	}
+	for cluster, n := range clusters {
+		stats.Clusters = append(stats.Clusters, VersionShare{Cluster: cluster, Requests: n})
+	}
+	for _, shares := range [][]VersionShare{stats.Versions, stats.Pods, stats.Clusters} {
+		for i := range shares {
+			shares[i].Percent = float64(shares[i].Requests) / float64(stats.Total) * 100
+		}
+		sort.Slice(shares, func(i, j int) bool {
+			if shares[i].Requests != shares[j].Requests {
+				return shares[i].Requests > shares[j].Requests
+			}
+			return shares[i].Version+shares[i].Pod+shares[i].Cluster < shares[j].Version+shares[j].Pod+shares[j].Cluster
+		})
+	}
+	return stats
+}
+
+// versionStatsHandler devolve a distribuição na janela configurada ou, com
+// ?window=, em uma janela menor
+func versionStatsHandler(w http.ResponseWriter, r *http.Request) {
+	window := config.VersionStatsWindow
+	if value := r.URL.Query().Get("window"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 || parsed > config.VersionStatsWindow {
+			writeAPIError(w, http.StatusBadRequest, "", fmt.Sprintf("window must be a duration between 0 and %s", config.VersionStatsWindow))
+			return
+		}
+		window = parsed
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versionStats.snapshot(window, time.Now()))
+}
@@ -0,0 +1,92 @@
+package productpage
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReviewsServedBy(t *testing.T) {
+	tests := []struct {
+		data ReviewData
+		want servedBy
+	}{
+		{ReviewData{PodName: "reviews-v3-5b64f47978-x7vzk", ClusterName: "east", Version: "v3"}, servedBy{"v3", "reviews-v3-5b64f47978-x7vzk", "east"}},
+		// O nome do pod e a cor das estrelas não dizem nada sobre a versão
+		{ReviewData{PodName: "reviews-v2", Version: "canary"}, servedBy{"canary", "reviews-v2", ""}},
+		{ReviewData{PodName: "laptop", Version: "v1", Reviews: []Review{{Rating: &Rating{Stars: 4, Color: "red"}}}}, servedBy{"v1", "laptop", ""}},
+		{ReviewData{PodName: "reviews-v2"}, servedBy{"unknown", "reviews-v2", ""}},
+	}
+	for _, tt := range tests {
+		if got := reviewsServedBy(tt.data); got != tt.want {
+			t.Errorf("reviewsServedBy(%+v) = %+v, want %+v", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestVersionStatsWindow(t *testing.T) {
+	useConfig(t, func(c *Config) { c.VersionStatsWindow = time.Minute })
+
+	r := &versionRecorder{}
+	now := time.Now()
+	r.record(servedBy{"v1", "reviews-v1-a", "west"}, now.Add(-2*time.Minute))
+	r.record(servedBy{"v2", "reviews-v2-a", "east"}, now.Add(-30*time.Second))
+	r.record(servedBy{"v2", "reviews-v2-b", "east"}, now.Add(-20*time.Second))
+	r.record(servedBy{"v3", "reviews-v3-a", "west"}, now.Add(-5*time.Second))
+	r.record(servedBy{Version: "unavailable"}, now)
+
+	stats := r.snapshot(time.Minute, now)
+	if stats.Total != 4 {
+		t.Fatalf("got %d requests in the window, want 4 (the oldest is out)", stats.Total)
+	}
+	if len(r.observations) != 4 {
+		t.Errorf("kept %d observations, want 4", len(r.observations))
+	}
+	if v := stats.Versions[0]; v.Version != "v2" || v.Requests != 2 || v.Percent != 50 {
+		t.Errorf("got top version %+v", v)
+	}
+	if len(stats.Pods) != 3 {
+		t.Errorf("got pods %+v", stats.Pods)
+	}
+	clusters := map[string]int{}
+	for _, c := range stats.Clusters {
+		clusters[c.Cluster] = c.Requests
+	}
+	if clusters["east"] != 2 || clusters["west"] != 1 || len(clusters) != 2 {
+		t.Errorf("got clusters %+v", stats.Clusters)
+	}
+
+	if recent := r.snapshot(10*time.Second, now); recent.Total != 2 {
+		t.Errorf("got %d requests in the last 10s, want 2", recent.Total)
+	}
+}
+
+func TestVersionStatsHandler(t *testing.T) {
+	useConfig(t, func(c *Config) {})
+	previous := versionStats
+	versionStats = &versionRecorder{}
+	t.Cleanup(func() { versionStats = previous })
+
+	recordReviewsBody([]byte(`{"id":"1","podname":"reviews-v2-x","clustername":"east","version":"v2","reviews":[]}`))
+	recordReviews(nil)
+
+	w := httptest.NewRecorder()
+	versionStatsHandler(w, httptest.NewRequest(http.MethodGet, "/api/v1/stats/versions?window=1m", nil))
+	var stats VersionStats
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.WindowSeconds != 60 || stats.Total != 2 || len(stats.Pods) != 1 || stats.Pods[0].Cluster != "east" {
+		t.Errorf("got %+v", stats)
+	}
+
+	for _, window := range []string{"abc", "0s", "6m"} {
+		w := httptest.NewRecorder()
+		versionStatsHandler(w, httptest.NewRequest(http.MethodGet, "/api/v1/stats/versions?window="+window, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("window=%s: got status %d", window, w.Code)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package productpage
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"net/url"
+)
+
+// Número de estrelas de uma avaliação completa
+const maxStars = 5
+
+// ProductPageView é o modelo entregue ao template productpage.html e, com
+// Accept: application/json, devolvido como JSON
+type ProductPageView struct {
+	Locale          *Locale              `json:"locale"`
+	Languages       []LanguageLink       `json:"-"`
+	Product         Product              `json:"product"`
+	User            string               `json:"user,omitempty"`
+	Details         Section[BookDetails] `json:"details"`
+	Reviews         Section[ReviewData]  `json:"reviews"`
+	Pager           *ReviewsPager        `json:"pager,omitempty"`
+	ReviewsFragment string               `json:"-"`
+	RatingsStream   string               `json:"-"`
+	Trace           *TraceSummary        `json:"trace,omitempty"`
+	TraceJSONURL    template.URL         `json:"-"`
+}
+
+// Unavailable indica que o serviço não respondeu ou falhou (5xx), em oposição
+// a uma recusa da requisição (4xx), cujo motivo vem em Error
+func (s Section[T]) Unavailable() bool {
+	return s.Data == nil && (s.Status == 0 || s.Status >= 500)
+}
+
+// Unavailable indica que o reviews não conseguiu consultar o ratings. Nesse
+// caso ele devolve stars -1 e o motivo em color.
+func (r Rating) Unavailable() bool {
+	return r.Stars < 0
+}
+
+// RatingSummary é a média das avaliações de um produto
+type RatingSummary struct {
+	Average float64
+	Count   int
+	Color   string
+}
+
+// RatingSummary calcula a média das avaliações disponíveis na página de
+// reviews; nil se nenhuma avaliação pôde ser lida
+func (d ReviewData) RatingSummary() *RatingSummary {
+	var summary RatingSummary
+	total := 0
+	for _, review := range d.Reviews {
+		if review.Rating == nil || review.Rating.Unavailable() {
+			continue
+		}
+		if summary.Count == 0 {
+			summary.Color = review.Rating.Color
+		}
+		summary.Count++
+		total += review.Rating.Stars
+	}
+	if summary.Count == 0 {
+		return nil
+	}
+	summary.Average = float64(total) / float64(summary.Count)
+	return &summary
+}
+
+// RatingsUnavailable indica que alguma avaliação não pôde ser lida do ratings
+func (d ReviewData) RatingsUnavailable() bool {
+	for _, review := range d.Reviews {
+		if review.Rating != nil && review.Rating.Unavailable() {
+			return true
+		}
+	}
+	return false
+}
+
+// Star é uma das posições de uma fileira de estrelas: "full", "half" ou
+// "empty"
+type Star string
+
+const (
+	fullStar  Star = "full"
+	halfStar  Star = "half"
+	emptyStar Star = "empty"
+)
+
+// StarRow é uma fileira de estrelas pronta para o template "stars"
+type StarRow struct {
+	Stars []Star
+	Color string
+	Label string
+}
+
+// starRow arredonda value para a meia estrela mais próxima e monta a fileira.
+// Aceita o int das avaliações e o float64 das médias; valores fora de 0 a 5,
+// como o -1 de ratings indisponível, são limitados ao intervalo. O rótulo
+// usa o locale, se informado, ou o idioma padrão.
+func starRow(value interface{}, color string, locale ...*Locale) (StarRow, error) {
+	var stars float64
+	switch v := value.(type) {
+	case int:
+		stars = float64(v)
+	case float64:
+		stars = v
+	default:
+		return StarRow{}, fmt.Errorf("stars: unexpected value %v of type %T", value, value)
+	}
+	halves := int(math.Round(math.Max(0, math.Min(stars, maxStars)) * 2))
+
+	l := defaultLocale
+	if len(locale) > 0 && locale[0] != nil {
+		l = locale[0]
+	}
+	row := StarRow{
+		Stars: make([]Star, maxStars),
+		Color: color,
+		Label: l.T("stars.label", float64(halves)/2, maxStars),
+	}
+	for i := range row.Stars {
+		switch {
+		case halves >= 2*(i+1):
+			row.Stars[i] = fullStar
+		case halves == 2*i+1:
+			row.Stars[i] = halfStar
+		default:
+			row.Stars[i] = emptyStar
+		}
+	}
+	return row, nil
+}
+
+// templateFuncs são as funções disponíveis nos templates
+var templateFuncs = template.FuncMap{
+	"stars": starRow,
+}
+
+// ReviewsPager são os links de página anterior/próxima da lista de reviews,
+// para a página inteira e para o fragmento /products/{id}/reviews
+type ReviewsPager struct {
+	Page         int    `json:"page"`
+	TotalPages   int    `json:"totalPages"`
+	Prev         string `json:"prev,omitempty"`
+	Next         string `json:"next,omitempty"`
+	PrevFragment string `json:"-"`
+	NextFragment string `json:"-"`
+}
+
+// reviewsPager monta os links de página anterior/próxima a partir dos cursores
+// devolvidos pelo serviço reviews, preservando os demais parâmetros da URL
+func reviewsPager(r *http.Request, productID int, reviews *ReviewData) *ReviewsPager {
+	if reviews == nil || reviews.Pagination == nil {
+		return nil
+	}
+
+	link := func(path, cursor string) string {
+		if cursor == "" {
+			return ""
+		}
+		query := r.URL.Query()
+		query.Del("id")
+		query.Del("page")
+		query.Set("cursor", cursor)
+		return fmt.Sprintf(path, productID) + "?" + query.Encode()
+	}
+
+	pagination := reviews.Pagination
+	return &ReviewsPager{
+		Page:         pagination.Page,
+		TotalPages:   pagination.TotalPages,
+		Prev:         link("/products/%d", pagination.PrevCursor),
+		Next:         link("/products/%d", pagination.NextCursor),
+		PrevFragment: link("/products/%d/reviews", pagination.PrevCursor),
+		NextFragment: link("/products/%d/reviews", pagination.NextCursor),
+	}
+}
+
+// reviewsFragmentURL aponta para o fragmento de reviews com a mesma página,
+// ordenação e idioma que estão sendo exibidos
+func reviewsFragmentURL(productID int, query url.Values, locale *Locale) string {
+	query.Set("lang", locale.Tag.String())
+	return fmt.Sprintf("/products/%d/reviews?%s", productID, query.Encode())
+}
@@ -0,0 +1,131 @@
+package productpage
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStarRow(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		stars string
+		label string
+	}{
+		{4, "ffffe", "4 out of 5 stars"},
+		{0, "eeeee", "0 out of 5 stars"},
+		{3.5, "fffhe", "3.5 out of 5 stars"},
+		{3.7, "fffhe", "3.5 out of 5 stars"},
+		{3.8, "ffffe", "4 out of 5 stars"},
+		{0.3, "heeee", "0.5 out of 5 stars"},
+		// Ratings indisponível devolve -1
+		{-1, "eeeee", "0 out of 5 stars"},
+		{7, "fffff", "5 out of 5 stars"},
+	}
+	for _, tt := range tests {
+		row, err := starRow(tt.value, "red")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var stars strings.Builder
+		for _, star := range row.Stars {
+			stars.WriteByte(star[0])
+		}
+		if stars.String() != tt.stars || row.Label != tt.label || row.Color != "red" {
+			t.Errorf("starRow(%v) = %s %q, want %s %q", tt.value, stars.String(), row.Label, tt.stars, tt.label)
+		}
+	}
+
+	if _, err := starRow("4", "red"); err == nil {
+		t.Error("starRow accepted a string")
+	}
+}
+
+func TestRatingSummary(t *testing.T) {
+	data := ReviewData{Reviews: []Review{
+		{Reviewer: "a", Rating: &Rating{Stars: 5, Color: "black"}},
+		{Reviewer: "b"},
+		{Reviewer: "c", Rating: &Rating{Stars: 4, Color: "black"}},
+	}}
+	if got, want := data.RatingSummary(), (&RatingSummary{Average: 4.5, Count: 2, Color: "black"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if data.RatingsUnavailable() {
+		t.Error("ratings reported unavailable")
+	}
+
+	unavailable := ReviewData{Reviews: []Review{{Reviewer: "a", Rating: &Rating{Stars: -1, Color: "Ratings service is unavailable"}}}}
+	if unavailable.RatingSummary() != nil || !unavailable.RatingsUnavailable() {
+		t.Error("unavailable ratings were averaged")
+	}
+}
+
+func TestProductPageTemplate(t *testing.T) {
+	product := Product{ID: 0, Title: "The Comedy of Errors"}
+	tests := []struct {
+		name    string
+		view    ProductPageView
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "available",
+			view: ProductPageView{
+				Locale:  defaultLocale,
+				Product: product,
+				Details: Section[BookDetails]{Status: 200, Data: &BookDetails{ISBN10: "1234567890", Publisher: "PublisherA"}},
+				Reviews: Section[ReviewData]{Status: 200, Data: &ReviewData{PodName: "reviews-v3", Version: "v3", Reviews: []Review{
+					{Reviewer: "Reviewer1", Text: "Great", Rating: &Rating{Stars: 5, Color: "red"}},
+					{Reviewer: "Reviewer2", Text: "Fun", Rating: &Rating{Stars: 4, Color: "red"}},
+				}}},
+			},
+			want:    []string{"1234567890", "PublisherA", "Reviewer1", "text-red-500 small-stars", `aria-label="4.5 out of 5 stars"`, "half-star", "4.5 average from 2 ratings", `data-reviews-status="ok"`, `data-reviews-version="v3"`},
+			notWant: []string{"Error fetching", "currently unavailable"},
+		},
+		{
+			name: "ratings unavailable",
+			view: ProductPageView{
+				Locale:  defaultLocale,
+				Product: product,
+				Details: Section[BookDetails]{Status: 200, Data: &BookDetails{}},
+				Reviews: Section[ReviewData]{Status: 200, Data: &ReviewData{Reviews: []Review{
+					{Reviewer: "Reviewer1", Text: "Great", Rating: &Rating{Stars: -1, Color: "Ratings service is unavailable"}},
+				}}},
+			},
+			want:    []string{"Reviewer1", "Ratings are currently unavailable"},
+			notWant: []string{`role="img"`, "average from", "data-reviews-version"},
+		},
+		{
+			name: "reviews unavailable",
+			view: ProductPageView{
+				Locale:  defaultLocale,
+				Product: product,
+				Details: Section[BookDetails]{Status: 404, Error: "product not found"},
+				Reviews: Section[ReviewData]{Status: 503, Error: "Service Unavailable"},
+			},
+			want:    []string{"Error fetching product details", "product not found", "Error fetching product reviews", "Book reviews are currently unavailable", `data-reviews-status="unavailable"`},
+			notWant: []string{"Book Reviews", "Book details are currently unavailable"},
+		},
+		{
+			name: "services unreachable",
+			view: ProductPageView{Locale: defaultLocale, Product: product},
+			want: []string{"Book details are currently unavailable", "Book reviews are currently unavailable"},
+		},
+	}
+	for _, tt := range tests {
+		var page strings.Builder
+		if err := templates.ExecuteTemplate(&page, "productpage.html", tt.view); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(page.String(), want) {
+				t.Errorf("%s: page does not contain %q", tt.name, want)
+			}
+		}
+		for _, notWant := range tt.notWant {
+			if strings.Contains(page.String(), notWant) {
+				t.Errorf("%s: page contains %q", tt.name, notWant)
+			}
+		}
+	}
+}
@@ -0,0 +1,14 @@
+#!/bin/sh
+# Regenerates the bookinfopb module, shared by the services, from bookinfo.proto.
+# Requires protoc, protoc-gen-go v1.34.2 and protoc-gen-go-grpc v1.4.0 on PATH.
+set -e
+
+cd "$(dirname "$0")"
+
+pkg="github.com/camilamedeir0s/bookinfo-go/bookinfopb"
+protoc -I . \
+	--go_out=../bookinfopb --go_opt=paths=source_relative \
+	--go_opt="Mbookinfo.proto=$pkg;bookinfopb" \
+	--go-grpc_out=../bookinfopb --go-grpc_opt=paths=source_relative \
+	--go-grpc_opt="Mbookinfo.proto=$pkg;bookinfopb" \
+	bookinfo.proto
@@ -0,0 +1,3 @@
+module github.com/camilamedeir0s/bookinfo-go/ratelimit
+
+go 1.22.4
@@ -0,0 +1,197 @@
+// Package ratelimit is the token-bucket rate limiter shared by the bookinfo
+// services. Each service wraps a Limiter in a middleware for its router.
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rule is a token bucket: Rate tokens per second, holding at most Burst.
+// Key selects how clients are told apart: "ip", "end-user" or "api-key".
+type Rule struct {
+	Rate  float64
+	Burst float64
+	Key   string
+}
+
+// ParseRules reads a rateLimits setting, a semicolon separated list of rules:
+//
+//	<route>=<count>/<s|m|h>[,burst=<n>][,key=<ip|end-user|api-key>]
+//
+// where route is "*" (any route without its own rule) or a method and the
+// route pattern of the service's router, e.g.
+// "GET /details/:id=20/s,burst=40;*=100/s".
+func ParseRules(spec string) (map[string]Rule, error) {
+	rules := map[string]Rule{}
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		route, value, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("rate limit %q: missing '='", entry)
+		}
+		rule, err := ParseRule(value)
+		if err != nil {
+			return nil, fmt.Errorf("rate limit %q: %w", entry, err)
+		}
+		rules[strings.Join(strings.Fields(route), " ")] = rule
+	}
+	return rules, nil
+}
+
+// ParseRule reads "<count>/<s|m|h>[,burst=<n>][,key=<kind>]".
+func ParseRule(value string) (Rule, error) {
+	parts := strings.Split(value, ",")
+
+	count, unit, found := strings.Cut(strings.TrimSpace(parts[0]), "/")
+	n, err := strconv.ParseFloat(count, 64)
+	if !found || err != nil || n <= 0 {
+		return Rule{}, errors.New("rate must look like 10/s, 100/m or 1000/h")
+	}
+	periods := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}
+	period, ok := periods[unit]
+	if !ok {
+		return Rule{}, errors.New("rate unit must be s, m or h")
+	}
+
+	rule := Rule{Rate: n / period.Seconds(), Burst: math.Max(1, math.Ceil(n)), Key: "ip"}
+	for _, option := range parts[1:] {
+		name, value, _ := strings.Cut(strings.TrimSpace(option), "=")
+		switch name {
+		case "burst":
+			burst, err := strconv.Atoi(value)
+			if err != nil || burst < 1 {
+				return Rule{}, errors.New("burst must be a positive number")
+			}
+			rule.Burst = float64(burst)
+		case "key":
+			if value != "ip" && value != "end-user" && value != "api-key" {
+				return Rule{}, errors.New("key must be one of: ip, end-user, api-key")
+			}
+			rule.Key = value
+		default:
+			return Rule{}, fmt.Errorf("unknown option %q", name)
+		}
+	}
+	return rule, nil
+}
+
+// Bucket holds the tokens of one client. A new bucket starts full.
+type Bucket struct {
+	Tokens float64
+	Last   time.Time
+}
+
+// Refill adds the tokens earned since the last call, up to the burst.
+func (b *Bucket) Refill(rule Rule, now time.Time) {
+	b.Tokens = math.Min(rule.Burst, b.Tokens+now.Sub(b.Last).Seconds()*rule.Rate)
+	b.Last = now
+}
+
+// Wait is how long until the bucket holds a whole token again.
+func (b *Bucket) Wait(rule Rule) time.Duration {
+	if b.Tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.Tokens) / rule.Rate * float64(time.Second))
+}
+
+// Limiter keeps one bucket per route and client.
+type Limiter struct {
+	rules     map[string]Rule
+	mu        sync.Mutex
+	buckets   map[string]*Bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func New(rules map[string]Rule) *Limiter {
+	return &Limiter{rules: rules, buckets: map[string]*Bucket{}, now: time.Now}
+}
+
+// Allow takes a token for a request to route, a method and route pattern,
+// or reports how long the client has to wait for one. key names the client
+// for the kind of the rule. Routes without a rule of their own share the "*"
+// rule; when there is neither, requests are not limited.
+func (l *Limiter) Allow(route string, key func(kind string) string) (bool, time.Duration) {
+	rule, exists := l.rules[route]
+	if !exists {
+		if rule, exists = l.rules["*"]; !exists {
+			return true, 0
+		}
+		route = "*"
+	}
+	return l.take(route+"|"+key(rule.Key), rule)
+}
+
+// take takes a token from the bucket for key.
+func (l *Limiter) take(key string, rule Rule) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	bucket, exists := l.buckets[key]
+	if !exists {
+		bucket = &Bucket{Tokens: rule.Burst, Last: now}
+		l.buckets[key] = bucket
+	}
+	bucket.Refill(rule, now)
+
+	if bucket.Tokens < 1 {
+		return false, bucket.Wait(rule)
+	}
+	bucket.Tokens--
+	return true, 0
+}
+
+// sweep drops, once a minute, the buckets of clients that have been idle for
+// long enough to be full again, so the map doesn't grow with every client
+// ever seen.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+
+	for key, bucket := range l.buckets {
+		route, _, _ := strings.Cut(key, "|")
+		rule := l.rules[route]
+		if bucket.Tokens+now.Sub(bucket.Last).Seconds()*rule.Rate >= rule.Burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// ClientKey identifies the client of a request for a rule of kind. Requests
+// without an end-user or API key fall back to ip, the client address as the
+// service resolves it.
+func ClientKey(header http.Header, kind, ip string) string {
+	switch kind {
+	case "end-user":
+		if user := header.Get("end-user"); user != "" {
+			return "user:" + user
+		}
+	case "api-key":
+		if key := header.Get("X-API-Key"); key != "" {
+			return "key:" + key
+		}
+	}
+	return "ip:" + ip
+}
+
+// RetryAfter formats a wait as the value of a Retry-After header, in whole
+// seconds rounded up.
+func RetryAfter(wait time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(wait.Seconds())))
+}
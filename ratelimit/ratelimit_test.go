@@ -0,0 +1,158 @@
+package ratelimit
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules(" GET  /details/:id=2/m,key=end-user ; *=100/s;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 || rules["GET /details/:id"].Key != "end-user" || rules["*"].Rate != 100 {
+		t.Errorf("got %+v", rules)
+	}
+
+	for _, invalid := range []string{"*", "*=10", "GET /x=1/d"} {
+		if _, err := ParseRules(invalid); err == nil {
+			t.Errorf("%q: expected an error", invalid)
+		}
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	rule, err := ParseRule("30/m,burst=5,key=api-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.Rate != 0.5 || rule.Burst != 5 || rule.Key != "api-key" {
+		t.Errorf("got %+v", rule)
+	}
+
+	for _, invalid := range []string{"", "10", "10/d", "0/s", "10/s,burst=0", "10/s,key=cookie", "10/s,foo=1"} {
+		if _, err := ParseRule(invalid); err == nil {
+			t.Errorf("%q: expected an error", invalid)
+		}
+	}
+}
+
+func TestLimiterPerRouteAndClient(t *testing.T) {
+	rules, _ := ParseRules("GET /details/:id=2/m,key=end-user;*=100/s")
+	limiter := New(rules)
+	now := time.Unix(1000, 0)
+	limiter.now = func() time.Time { return now }
+
+	allow := func(route, user string) (bool, time.Duration) {
+		header := http.Header{}
+		header.Set("end-user", user)
+		return limiter.Allow(route, func(kind string) string { return ClientKey(header, kind, "192.0.2.1") })
+	}
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := allow("GET /details/:id", "jason"); !ok {
+			t.Fatalf("request %d was limited", i+1)
+		}
+	}
+	ok, wait := allow("GET /details/:id", "jason")
+	if ok || RetryAfter(wait) != "30" {
+		t.Fatalf("third request: got allowed %v and Retry-After %s, want 30", ok, RetryAfter(wait))
+	}
+
+	if ok, _ := allow("GET /details/:id", "admin"); !ok {
+		t.Error("other user was limited")
+	}
+	if ok, _ := allow("GET /health", "jason"); !ok {
+		t.Error("other route was limited")
+	}
+
+	if ok, _ := New(map[string]Rule{}).Allow("GET /health", nil); !ok {
+		t.Error("limited without rules")
+	}
+}
+
+func TestLimiterRefillsTokens(t *testing.T) {
+	rule, err := ParseRule("2/s,burst=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter := New(map[string]Rule{"GET /x": rule})
+	now := time.Unix(1000, 0)
+	limiter.now = func() time.Time { return now }
+
+	take := func() (bool, time.Duration) { return limiter.take("GET /x|ip:a", rule) }
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := take(); !ok {
+			t.Fatalf("request %d within the burst was limited", i+1)
+		}
+	}
+	if ok, wait := take(); ok || wait != 500*time.Millisecond {
+		t.Fatalf("got allowed %v and wait %s with the bucket empty, want a 500ms wait", ok, wait)
+	}
+
+	now = now.Add(250 * time.Millisecond)
+	if ok, wait := take(); ok || wait != 250*time.Millisecond {
+		t.Errorf("got allowed %v and wait %s half way, want a 250ms wait", ok, wait)
+	}
+	now = now.Add(250 * time.Millisecond)
+	if ok, _ := take(); !ok {
+		t.Error("limited after a token was earned")
+	}
+
+	// An idle client gets its burst back, but no more
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if ok, _ := take(); !ok {
+			t.Fatalf("request %d after idling was limited", i+1)
+		}
+	}
+	if ok, _ := take(); ok {
+		t.Error("idling earned more than the burst")
+	}
+}
+
+func TestLimiterSweepsIdleClients(t *testing.T) {
+	rule, _ := ParseRule("2/s")
+	limiter := New(map[string]Rule{"GET /x": rule})
+	now := time.Unix(1000, 0)
+	limiter.now = func() time.Time { return now }
+
+	limiter.take("GET /x|ip:a", rule)
+	limiter.take("GET /x|ip:b", rule)
+	now = now.Add(30 * time.Second)
+	limiter.take("GET /x|ip:c", rule)
+	if len(limiter.buckets) != 3 {
+		t.Fatalf("got %d buckets before the sweep, want 3", len(limiter.buckets))
+	}
+
+	now = now.Add(31 * time.Second)
+	limiter.take("GET /x|ip:d", rule)
+	if _, kept := limiter.buckets["GET /x|ip:d"]; len(limiter.buckets) != 1 || !kept {
+		t.Errorf("got buckets %v after the sweep, want only the new client", limiter.buckets)
+	}
+}
+
+func TestClientKey(t *testing.T) {
+	tests := []struct {
+		kind    string
+		headers map[string]string
+		want    string
+	}{
+		{"ip", map[string]string{"end-user": "jason", "X-API-Key": "k1"}, "ip:192.0.2.1"},
+		{"end-user", map[string]string{"end-user": "jason"}, "user:jason"},
+		{"end-user", nil, "ip:192.0.2.1"},
+		{"api-key", map[string]string{"X-API-Key": "k1", "end-user": "jason"}, "key:k1"},
+		{"api-key", nil, "ip:192.0.2.1"},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		for name, value := range tt.headers {
+			header.Set(name, value)
+		}
+		if got := ClientKey(header, tt.kind, "192.0.2.1"); got != tt.want {
+			t.Errorf("%s with headers %v: got %q, want %q", tt.kind, tt.headers, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package ratings
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestPostRatingsAuthorization(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	secret := []byte("test-secret-test-secret-test-sec")
+	jwks := `{"keys":[{"kty":"oct","kid":"test","k":"` + base64.RawURLEncoding.EncodeToString(secret) + `"}]}`
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, []byte(jwks), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	useConfig(t, func(c *Config) {
+		c.OpenAPIValidation = "off"
+		c.JWTJWKSFile = path
+	})
+	defer func() { authVerifier = nil }()
+
+	r, err := setupRouter()
+	if err != nil {
+		t.Fatalf("setting up router: %v", err)
+	}
+
+	sign := func(subject string, roles ...string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+			Roles: roles,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject:   subject,
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			},
+		})
+		token.Header["kid"] = "test"
+		signed, err := token.SignedString(secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		body   string
+		status int
+	}{
+		{"anonymous", "", `{"alice": 3}`, http.StatusUnauthorized},
+		{"invalid token", "not-a-token", `{"alice": 3}`, http.StatusUnauthorized},
+		{"own rating", sign("alice", "user"), `{"alice": 3}`, http.StatusOK},
+		{"someone else's rating", sign("alice", "user"), `{"Reviewer1": 1}`, http.StatusForbidden},
+		{"admin", sign("root", "user", "admin"), `{"Reviewer1": 1}`, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/ratings/11", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("got status %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+		})
+	}
+
+	// alice's rating was merged into the defaults, then replaced by the admin
+	if got := getLocalReviews(11); len(got) != 1 || got["Reviewer1"] != 1 {
+		t.Errorf("unexpected ratings after admin write: %v", got)
+	}
+}
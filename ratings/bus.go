@@ -0,0 +1,94 @@
+package ratings
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+)
+
+// Publisher hands messages to a message bus. Subjects are dot-separated as in
+// NATS; rating changes go to ratings.<productId>.
+type Publisher interface {
+	Publish(ctx context.Context, subject string, data []byte) error
+	Close() error
+}
+
+// ratingsSubject is the subject of the changes to the ratings of a product.
+// Subscribers of every product use the NATS wildcard ratings.*.
+func ratingsSubject(productId int) string {
+	return fmt.Sprintf("ratings.%d", productId)
+}
+
+// localBus delivers rating changes to the event streams of this instance.
+var localBus = newMemoryBus()
+
+// newPublisher returns the broker named by eventBusURL, or nil when rating
+// changes only go to localBus.
+func newPublisher(eventBusURL string) (Publisher, error) {
+	if eventBusURL == "" || eventBusURL == "memory" {
+		return nil, nil
+	}
+	u, err := url.Parse(eventBusURL)
+	if err != nil || u.Scheme != "nats" || u.Host == "" {
+		return nil, fmt.Errorf("eventBusUrl must be memory or nats://host:port, got %q", eventBusURL)
+	}
+	return &natsPublisher{url: eventBusURL, name: "ratings"}, nil
+}
+
+// memoryBus is an in-process bus. Subscribers get the messages published to
+// the exact subject they subscribed to.
+type memoryBus struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan []byte]struct{}
+}
+
+func newMemoryBus() *memoryBus {
+	return &memoryBus{subscribers: map[string]map[chan []byte]struct{}{}}
+}
+
+// Subscribe returns a channel with the messages published to subject and a
+// function that cancels the subscription.
+func (b *memoryBus) Subscribe(subject string) (<-chan []byte, func()) {
+	messages := make(chan []byte, 1)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subscribers[subject] == nil {
+		b.subscribers[subject] = map[chan []byte]struct{}{}
+	}
+	b.subscribers[subject][messages] = struct{}{}
+
+	return messages, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscribers[subject], messages)
+		if len(b.subscribers[subject]) == 0 {
+			delete(b.subscribers, subject)
+		}
+	}
+}
+
+// Publish never blocks on a slow subscriber: a message still waiting to be
+// read is replaced by the newer one. Rating changes carry the full ratings of
+// the product, so the latest message supersedes the ones before it.
+func (b *memoryBus) Publish(ctx context.Context, subject string, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for messages := range b.subscribers[subject] {
+		select {
+		case messages <- data:
+		default:
+			select {
+			case <-messages:
+			default:
+			}
+			messages <- data
+		}
+	}
+	return nil
+}
+
+func (b *memoryBus) Close() error {
+	return nil
+}
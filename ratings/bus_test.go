@@ -0,0 +1,55 @@
+package ratings
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMemoryBusKeepsLatestMessage(t *testing.T) {
+	bus := newMemoryBus()
+	messages, unsubscribe := bus.Subscribe("ratings.1")
+	other, unsubscribeOther := bus.Subscribe("ratings.2")
+	defer unsubscribeOther()
+
+	ctx := context.Background()
+	bus.Publish(ctx, "ratings.1", []byte("first"))
+	bus.Publish(ctx, "ratings.1", []byte("second"))
+
+	if got := string(<-messages); got != "second" {
+		t.Errorf("got %q, want the latest message", got)
+	}
+	select {
+	case message := <-other:
+		t.Errorf("subscriber of ratings.2 got %q", message)
+	default:
+	}
+
+	unsubscribe()
+	bus.Publish(ctx, "ratings.1", []byte("third"))
+	select {
+	case message := <-messages:
+		t.Errorf("got %q after unsubscribing", message)
+	default:
+	}
+	if len(bus.subscribers["ratings.1"]) != 0 {
+		t.Errorf("subscription to ratings.1 was not removed")
+	}
+}
+
+func TestNewPublisher(t *testing.T) {
+	for _, url := range []string{"", "memory"} {
+		if publisher, err := newPublisher(url); publisher != nil || err != nil {
+			t.Errorf("%q: got %v, %v; want only the local bus", url, publisher, err)
+		}
+	}
+	if publisher, err := newPublisher("nats://nats:4222"); err != nil {
+		t.Errorf("nats URL: %v", err)
+	} else if p, ok := publisher.(*natsPublisher); !ok || p.url != "nats://nats:4222" {
+		t.Errorf("nats URL: got %#v", publisher)
+	}
+	for _, url := range []string{"kafka://kafka:9092", "nats://", "nats"} {
+		if _, err := newPublisher(url); err == nil {
+			t.Errorf("%q: expected an error", url)
+		}
+	}
+}
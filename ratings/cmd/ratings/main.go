@@ -0,0 +1,12 @@
+// Command ratings serves the ratings service; see the ratings package.
+package main
+
+import (
+	"os"
+
+	"github.com/camilamedeir0s/bookinfo-go/ratings"
+)
+
+func main() {
+	ratings.Main(os.Args[1:])
+}
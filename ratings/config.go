@@ -0,0 +1,325 @@
+package ratings
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/camilamedeir0s/bookinfo-go/ratelimit"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the configuration of ratings. Each field names its YAML key, its
+// environment variable and its flag; see loadConfig for the precedence.
+type Config struct {
+	ServerConfig `yaml:",inline"`
+
+	ServiceVersion string `yaml:"serviceVersion" env:"SERVICE_VERSION" flag:"service-version" help:"v1 (in memory), v2 (database), v-unavailable or v-unhealthy"`
+	DBType         string `yaml:"dbType" env:"DB_TYPE" flag:"db-type" help:"database used by v2: mysql or mongodb"`
+	MySQLHost      string `yaml:"mysqlHost" env:"MYSQL_DB_HOST" flag:"mysql-host" help:"MySQL host"`
+	MySQLPort      int    `yaml:"mysqlPort" env:"MYSQL_DB_PORT" flag:"mysql-port" help:"MySQL port"`
+	MySQLUser      string `yaml:"mysqlUser" env:"MYSQL_DB_USER" flag:"mysql-user" help:"MySQL user"`
+	MySQLPassword  string `yaml:"mysqlPassword" env:"MYSQL_DB_PASSWORD" flag:"mysql-password" help:"MySQL password" secret:"true"`
+	MongoURL       string `yaml:"mongoUrl" env:"MONGO_DB_URL" flag:"mongo-url" help:"MongoDB connection string" secret:"true"`
+	JWTJWKSFile    string `yaml:"jwtJwksFile" env:"JWT_JWKS_FILE" flag:"jwt-jwks-file" help:"JSON Web Key Set used to verify tokens"`
+	JWTIssuer      string `yaml:"jwtIssuer" env:"JWT_ISSUER" flag:"jwt-issuer" help:"required token issuer"`
+
+	StreamHeartbeat time.Duration `yaml:"streamHeartbeat" env:"STREAM_HEARTBEAT" flag:"stream-heartbeat" help:"interval of keep-alive comments on rating streams"`
+	EventBusURL     string        `yaml:"eventBusUrl" env:"EVENT_BUS_URL" flag:"event-bus-url" help:"where rating changes are published: memory (this instance only) or nats://host:port"`
+	OutboxLimit     int           `yaml:"outboxLimit" env:"OUTBOX_LIMIT" flag:"outbox-limit" help:"rating changes kept in memory while the event bus is unreachable"`
+	StateFile       string        `yaml:"stateFile" env:"STATE_FILE" flag:"state-file" help:"file the in-memory ratings and their unpublished changes are saved to; empty keeps them in memory only"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		ServerConfig:   defaultServerConfig(8085, 8095),
+		ServiceVersion: "v1",
+		DBType:         "mongodb",
+		MySQLPort:      3306,
+
+		StreamHeartbeat: 15 * time.Second,
+		EventBusURL:     "memory",
+		OutboxLimit:     10000,
+	}
+}
+
+func (c Config) validate() error {
+	if err := c.ServerConfig.validate(); err != nil {
+		return err
+	}
+	if c.StreamHeartbeat <= 0 {
+		return errors.New("streamHeartbeat must be positive")
+	}
+	if _, err := newPublisher(c.EventBusURL); err != nil {
+		return err
+	}
+	if c.OutboxLimit <= 0 {
+		return errors.New("outboxLimit must be positive")
+	}
+	if c.ServiceVersion != "v2" {
+		return nil
+	}
+	if c.StateFile != "" {
+		return errors.New("stateFile is only used by the in-memory ratings, not by v2")
+	}
+	switch c.DBType {
+	case "mysql":
+		if c.MySQLHost == "" {
+			return errors.New("mysqlHost is required when dbType is mysql")
+		}
+	case "mongodb":
+		if c.MongoURL == "" {
+			return errors.New("mongoUrl is required when dbType is mongodb")
+		}
+	default:
+		return errors.New("dbType must be mysql or mongodb")
+	}
+	return nil
+}
+
+// config is loaded once in main.
+var config = defaultConfig()
+
+// ServerConfig holds the settings shared by every bookinfo service.
+type ServerConfig struct {
+	ConfigFile  string `yaml:"-" env:"CONFIG_FILE" flag:"config" help:"YAML configuration file"`
+	PrintConfig bool   `yaml:"-" flag:"print-config" help:"print the effective configuration and exit"`
+
+	Port              int           `yaml:"port" env:"PORT" flag:"port" help:"HTTP port"`
+	GRPCPort          int           `yaml:"grpcPort" env:"GRPC_PORT" flag:"grpc-port" help:"gRPC port"`
+	OpenAPIValidation string        `yaml:"openapiValidation" env:"OPENAPI_VALIDATION" flag:"openapi-validation" help:"off, warn or strict"`
+	RateLimits        string        `yaml:"rateLimits" env:"RATE_LIMITS" flag:"rate-limits" help:"per-route rate limits, e.g. *=100/s"`
+	TrustedProxies    []string      `yaml:"trustedProxies" env:"TRUSTED_PROXIES" flag:"trusted-proxies" help:"IPs or CIDRs of the proxies whose X-Forwarded-For gives the client IP; by default the client IP is the peer address"`
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout" env:"HTTP_READ_HEADER_TIMEOUT" flag:"read-header-timeout" help:"time allowed to read request headers"`
+	ReadTimeout       time.Duration `yaml:"readTimeout" env:"HTTP_READ_TIMEOUT" flag:"read-timeout" help:"time allowed to read a request"`
+	WriteTimeout      time.Duration `yaml:"writeTimeout" env:"HTTP_WRITE_TIMEOUT" flag:"write-timeout" help:"time allowed to write a response"`
+	IdleTimeout       time.Duration `yaml:"idleTimeout" env:"HTTP_IDLE_TIMEOUT" flag:"idle-timeout" help:"keep-alive connection idle timeout"`
+	DrainPeriod       time.Duration `yaml:"drainPeriod" env:"DRAIN_PERIOD" flag:"drain-period" help:"time /health fails before connections are drained"`
+	ShutdownTimeout   time.Duration `yaml:"shutdownTimeout" env:"SHUTDOWN_TIMEOUT" flag:"shutdown-timeout" help:"time allowed for in-flight requests on shutdown"`
+}
+
+func defaultServerConfig(port, grpcPort int) ServerConfig {
+	return ServerConfig{
+		Port:              port,
+		GRPCPort:          grpcPort,
+		OpenAPIValidation: "warn",
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		DrainPeriod:       5 * time.Second,
+		ShutdownTimeout:   15 * time.Second,
+	}
+}
+
+func (c ServerConfig) validate() error {
+	for name, port := range map[string]int{"port": c.Port, "grpcPort": c.GRPCPort} {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("%s must be between 1 and 65535, got %d", name, port)
+		}
+	}
+	if c.Port == c.GRPCPort {
+		return fmt.Errorf("port and grpcPort must differ, both are %d", c.Port)
+	}
+	switch c.OpenAPIValidation {
+	case "off", "warn", "strict":
+	default:
+		return fmt.Errorf("openapiValidation must be one of: off, warn, strict")
+	}
+	if _, err := ratelimit.ParseRules(c.RateLimits); err != nil {
+		return fmt.Errorf("rateLimits: %w", err)
+	}
+	for _, proxy := range c.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return fmt.Errorf("trustedProxies: %q is not an IP address or CIDR", proxy)
+		}
+	}
+	if c.DrainPeriod < 0 || c.ShutdownTimeout <= 0 {
+		return errors.New("drainPeriod must not be negative and shutdownTimeout must be positive")
+	}
+	return nil
+}
+
+// loadConfig builds the configuration from, in increasing precedence: the
+// defaults, the YAML file given by --config or CONFIG_FILE, environment
+// variables and command-line flags. A bare positional argument is taken as
+// the HTTP port, as earlier versions of the services expected.
+func loadConfig(args []string) (Config, error) {
+	cfg := defaultConfig()
+	fields := configFields(reflect.ValueOf(&cfg).Elem())
+
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	flagged := map[string]string{}
+	for _, field := range fields {
+		name := field.tag.Get("flag")
+		isBool := field.value.Kind() == reflect.Bool
+		fs.Var(&flagValue{name: name, values: flagged, def: defaultString(field.value), isBool: isBool},
+			name, field.tag.Get("help")+envHint(field.tag.Get("env"), isBool))
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+	if fs.NArg() > 1 {
+		return cfg, fmt.Errorf("unexpected arguments: %v", fs.Args()[1:])
+	}
+
+	path := flagged["config"]
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, err
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return cfg, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	for _, field := range fields {
+		if name := field.tag.Get("env"); name != "" {
+			if value, exists := os.LookupEnv(name); exists {
+				if err := setField(field.value, value); err != nil {
+					return cfg, fmt.Errorf("%s: %w", name, err)
+				}
+			}
+		}
+	}
+
+	for _, field := range fields {
+		name := field.tag.Get("flag")
+		if value, exists := flagged[name]; exists {
+			if err := setField(field.value, value); err != nil {
+				return cfg, fmt.Errorf("--%s: %w", name, err)
+			}
+		}
+	}
+	if fs.NArg() == 1 {
+		if err := setField(reflect.ValueOf(&cfg.Port).Elem(), fs.Arg(0)); err != nil {
+			return cfg, fmt.Errorf("port argument: %w", err)
+		}
+	}
+
+	cfg.ConfigFile = path
+	return cfg, cfg.validate()
+}
+
+// printConfig writes the configuration as YAML, in a form loadConfig accepts
+// back as a file. Fields tagged secret are masked.
+func printConfig(w io.Writer, cfg Config) error {
+	for _, field := range configFields(reflect.ValueOf(&cfg).Elem()) {
+		if field.tag.Get("secret") == "true" && !field.value.IsZero() {
+			field.value.SetString("********")
+		}
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	return encoder.Encode(cfg)
+}
+
+type configField struct {
+	value reflect.Value
+	tag   reflect.StructTag
+}
+
+// configFields lists the settable fields of cfg, descending into embedded
+// structs.
+func configFields(cfg reflect.Value) []configField {
+	var fields []configField
+	for i := 0; i < cfg.NumField(); i++ {
+		field := cfg.Type().Field(i)
+		if field.Anonymous {
+			fields = append(fields, configFields(cfg.Field(i))...)
+			continue
+		}
+		fields = append(fields, configField{value: cfg.Field(i), tag: field.Tag})
+	}
+	return fields
+}
+
+func setField(field reflect.Value, value string) error {
+	switch {
+	case field.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	case field.Kind() == reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		field.SetInt(int64(n))
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		field.SetBool(b)
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", field.Type())
+	}
+	return nil
+}
+
+func defaultString(field reflect.Value) string {
+	if field.IsZero() {
+		return ""
+	}
+	if field.Kind() == reflect.Slice {
+		return strings.Join(field.Interface().([]string), ",")
+	}
+	return fmt.Sprint(field.Interface())
+}
+
+// envHint names the environment variable in the flag usage. The name is
+// back-quoted so the flag package also shows it as the argument placeholder.
+func envHint(name string, isBool bool) string {
+	switch {
+	case name == "":
+		return ""
+	case isBool:
+		return " (env " + name + ")"
+	}
+	return " (env `" + name + "`)"
+}
+
+// flagValue records the raw value of a flag, so flags can be applied after
+// the file and the environment.
+type flagValue struct {
+	name   string
+	values map[string]string
+	def    string
+	isBool bool
+}
+
+func (f *flagValue) String() string { return f.def }
+
+func (f *flagValue) Set(value string) error {
+	f.values[f.name] = value
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool { return f.isBool }
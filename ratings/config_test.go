@@ -0,0 +1,45 @@
+package ratings
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// useConfig replaces the service configuration for the duration of a test.
+func useConfig(t *testing.T, change func(*Config)) {
+	t.Helper()
+	previous := config
+	config = defaultConfig()
+	change(&config)
+	t.Cleanup(func() { config = previous })
+}
+
+func TestLoadConfigDatabase(t *testing.T) {
+	t.Setenv("SERVICE_VERSION", "v2")
+
+	if _, err := loadConfig([]string{"--db-type=mysql"}); err == nil {
+		t.Error("expected an error without mysqlHost")
+	}
+	if _, err := loadConfig([]string{"--db-type=postgres"}); err == nil {
+		t.Error("expected an error for an unknown dbType")
+	}
+	if _, err := loadConfig([]string{"--db-type=mysql", "--mysql-host=mysqldb", "--state-file=ratings.json"}); err == nil {
+		t.Error("expected an error for a state file with a database")
+	}
+
+	t.Setenv("MYSQL_DB_PASSWORD", "hunter2")
+	cfg, err := loadConfig([]string{"--db-type=mysql", "--mysql-host=mysqldb"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	printConfig(&out, cfg)
+	if strings.Contains(out.String(), "hunter2") {
+		t.Errorf("--print-config shows the MySQL password:\n%s", out.String())
+	}
+	if cfg.MySQLPassword != "hunter2" {
+		t.Error("printing the config must not change it")
+	}
+}
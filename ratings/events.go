@@ -0,0 +1,119 @@
+package ratings
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RatingEvent is published whenever the ratings of a product change. It
+// carries the full set of ratings after the change, so a subscriber that
+// missed earlier events is still up to date. Seq numbers the changes since the
+// service started, for subscribers to spot duplicates. The current ratings
+// that open an event stream carry the seq of the last change they include;
+// changes up to that seq are already part of them.
+type RatingEvent struct {
+	Seq       uint64         `json:"seq,omitempty"`
+	ProductID int            `json:"id"`
+	Ratings   map[string]int `json:"ratings"`
+}
+
+// streamRatings sends the ratings of a product as server-sent events: the
+// current ratings first, then every change, with comments in between to keep
+// idle connections open.
+func streamRatings(c *gin.Context) {
+	if isUnavailable() {
+		c.Header("Retry-After", "60")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Service unavailable"})
+		return
+	}
+
+	productId, err := strconv.Atoi(c.Param("productId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "please provide numeric product ID"})
+		return
+	}
+
+	// Subscribe before the lookup so no change falls between the two. The
+	// changes published meanwhile are skipped by their seq.
+	events, unsubscribe := localBus.Subscribe(ratingsSubject(productId))
+	defer unsubscribe()
+
+	ratings, snapshotSeq, ratingsErr := ratingsSnapshot(productId)
+	if ratingsErr != nil {
+		// The MySQL backend reports an unreachable database with a 200, which
+		// a stream cannot carry.
+		status := ratingsErr.status
+		if status == http.StatusOK {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{"error": ratingsErr.message})
+		return
+	}
+
+	// The stream outlives the server write timeout. Writers that cannot
+	// change the deadline, such as test recorders, do not have one.
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	current, _ := json.Marshal(RatingEvent{Seq: snapshotSeq, ProductID: productId, Ratings: ratings})
+	if err := writeRatingEvent(c.Writer, current); err != nil {
+		return
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(config.StreamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-shuttingDown:
+			return
+		case event := <-events:
+			var change RatingEvent
+			if json.Unmarshal(event, &change) == nil && change.Seq <= snapshotSeq {
+				continue
+			}
+			err = writeRatingEvent(c.Writer, event)
+		case <-heartbeat.C:
+			_, err = io.WriteString(c.Writer, ": heartbeat\n\n")
+		}
+		if err != nil {
+			return
+		}
+		c.Writer.Flush()
+	}
+}
+
+// ratingsSnapshot returns the ratings of a product with the seq of the last
+// change they include. The in-memory ratings are read under the lock that
+// queues their changes in the outbox, so the two match.
+func ratingsSnapshot(productId int) (map[string]int, uint64, *ratingsError) {
+	if isUnavailable() || config.ServiceVersion == "v2" {
+		// The database backends take no writes, so their ratings have no
+		// changes in the outbox.
+		ratings, ratingsErr := lookupRatings(productId)
+		return ratings, ratingsOutbox.seq(), ratingsErr
+	}
+
+	ratingsMu.Lock()
+	defer ratingsMu.Unlock()
+	return localReviews(productId), ratingsOutbox.seq(), nil
+}
+
+// writeRatingEvent writes a RatingEvent in JSON as an SSE message of type
+// "ratings".
+func writeRatingEvent(w io.Writer, data []byte) error {
+	_, err := fmt.Fprintf(w, "event: ratings\ndata: %s\n\n", data)
+	return err
+}
@@ -0,0 +1,124 @@
+package ratings
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestStreamRatings(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	useConfig(t, func(c *Config) { c.StreamHeartbeat = 20 * time.Millisecond })
+	useOutbox(t, nil)
+	t.Cleanup(func() {
+		ratingsMu.Lock()
+		defer ratingsMu.Unlock()
+		delete(userAddedRatings, 21)
+	})
+
+	r, err := setupRouter()
+	if err != nil {
+		t.Fatalf("setting up router: %v", err)
+	}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/ratings/21/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("got Content-Type %q", got)
+	}
+
+	lines := bufio.NewScanner(resp.Body)
+	next := func() string {
+		t.Helper()
+		for lines.Scan() {
+			if strings.HasPrefix(lines.Text(), "data: ") {
+				return strings.TrimPrefix(lines.Text(), "data: ")
+			}
+		}
+		t.Fatalf("stream ended: %v", lines.Err())
+		return ""
+	}
+
+	if got, want := next(), `{"id":21,"ratings":{"Reviewer1":5,"Reviewer2":4}}`; got != want {
+		t.Errorf("first event: got %s, want %s", got, want)
+	}
+
+	// Without a JWKS the posted ratings replace the product's ratings
+	post, err := http.Post(server.URL+"/ratings/21", "application/json", strings.NewReader(`{"Reviewer2": 1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	post.Body.Close()
+
+	if got, want := next(), `{"seq":1,"id":21,"ratings":{"Reviewer2":1}}`; got != want {
+		t.Errorf("event after POST: got %s, want %s", got, want)
+	}
+}
+
+func TestStreamRatingsSkipsChangesInTheSnapshot(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	useConfig(t, func(c *Config) { c.StreamHeartbeat = 20 * time.Millisecond })
+	useOutbox(t, nil)
+	t.Cleanup(func() {
+		ratingsMu.Lock()
+		defer ratingsMu.Unlock()
+		delete(userAddedRatings, 22)
+	})
+
+	if _, err := storeRatings(22, map[string]int{"Reviewer1": 3}, true); err != nil {
+		t.Fatal(err)
+	}
+	// Wait for the relay, so the change is not delivered to the stream
+	// below by the outbox itself
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	ratingsOutbox.flush(ctx)
+
+	r, err := setupRouter()
+	if err != nil {
+		t.Fatalf("setting up router: %v", err)
+	}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/ratings/22/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	lines := bufio.NewScanner(resp.Body)
+	next := func() string {
+		t.Helper()
+		for lines.Scan() {
+			if strings.HasPrefix(lines.Text(), "data: ") {
+				return strings.TrimPrefix(lines.Text(), "data: ")
+			}
+		}
+		t.Fatalf("stream ended: %v", lines.Err())
+		return ""
+	}
+
+	if got, want := next(), `{"seq":1,"id":22,"ratings":{"Reviewer1":3}}`; got != want {
+		t.Errorf("first event: got %s, want %s", got, want)
+	}
+
+	// A change published late, after the snapshot that includes it
+	localBus.Publish(context.Background(), "ratings.22", []byte(`{"seq":1,"id":22,"ratings":{"Reviewer1":3}}`))
+	if _, err := storeRatings(22, map[string]int{"Reviewer1": 1}, true); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := next(), `{"seq":2,"id":22,"ratings":{"Reviewer1":1}}`; got != want {
+		t.Errorf("event after the change: got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,137 @@
+package ratings
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/camilamedeir0s/bookinfo-go/bookinfopb"
+)
+
+type ratingsServer struct {
+	bookinfopb.UnimplementedRatingsServer
+}
+
+func (ratingsServer) GetRatings(ctx context.Context, req *bookinfopb.GetRatingsRequest) (*bookinfopb.ProductRatings, error) {
+	ratings, ratingsErr := lookupRatings(int(req.GetProductId()))
+	if ratingsErr != nil {
+		return nil, ratingsErr.grpcStatus()
+	}
+	return toProductRatings(req.GetProductId(), ratings), nil
+}
+
+func (ratingsServer) PostRatings(ctx context.Context, req *bookinfopb.PostRatingsRequest) (*bookinfopb.ProductRatings, error) {
+	ratings := make(map[string]int, len(req.GetRatings()))
+	for reviewer, stars := range req.GetRatings() {
+		ratings[reviewer] = int(stars)
+	}
+
+	claims, _ := ctx.Value(claimsKey{}).(*Claims)
+	replace, ratingsErr := authorizeRatings(claims, ratings)
+	if ratingsErr != nil {
+		return nil, ratingsErr.grpcStatus()
+	}
+
+	stored, ratingsErr := storeRatings(int(req.GetProductId()), ratings, replace)
+	if ratingsErr != nil {
+		return nil, ratingsErr.grpcStatus()
+	}
+	return toProductRatings(req.GetProductId(), stored), nil
+}
+
+func toProductRatings(productId int32, ratings map[string]int) *bookinfopb.ProductRatings {
+	result := &bookinfopb.ProductRatings{Id: productId, Ratings: make(map[string]int32, len(ratings))}
+	for reviewer, stars := range ratings {
+		result.Ratings[reviewer] = int32(stars)
+	}
+	return result
+}
+
+// grpcStatus maps the HTTP status of a failed lookup to the closest gRPC code.
+func (e *ratingsError) grpcStatus() error {
+	code := codes.Internal
+	switch e.status {
+	case http.StatusServiceUnavailable, http.StatusOK:
+		// the HTTP API reports database connection failures with 200
+		code = codes.Unavailable
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusNotImplemented:
+		code = codes.Unimplemented
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	}
+	return status.Error(code, e.message)
+}
+
+type claimsKey struct{}
+
+// authInterceptor is the gRPC counterpart of authMiddleware, reading the
+// bearer token from the "authorization" metadata.
+func authInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if authVerifier == nil {
+		return handler(ctx, req)
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 || bearerToken(values[0]) == "" {
+		return handler(ctx, req)
+	}
+
+	claims, err := authVerifier.Verify(bearerToken(values[0]))
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid token: "+err.Error())
+	}
+	return handler(context.WithValue(ctx, claimsKey{}, claims), req)
+}
+
+// newGRPCServer registers the gRPC API, which is served next to the HTTP one.
+func newGRPCServer() *grpc.Server {
+	server := grpc.NewServer(grpc.UnaryInterceptor(authInterceptor))
+	bookinfopb.RegisterRatingsServer(server, ratingsServer{})
+	return server
+}
+
+// serveGRPC starts serving the gRPC API of server on port.
+func serveGRPC(port int, server *Server) {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		log.Fatalf("Could not listen on gRPC port %d: %v", port, err)
+	}
+
+	go func() {
+		log.Printf("gRPC server started at :%d", port)
+		if err := server.ServeGRPC(lis); err != nil {
+			log.Fatal(err)
+		}
+	}()
+}
+
+// stopGRPC lets in-flight RPCs finish, closing the server outright if ctx
+// expires first.
+func stopGRPC(server *grpc.Server) func(context.Context) {
+	return func(ctx context.Context) {
+		done := make(chan struct{})
+		go func() {
+			server.GracefulStop()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			server.Stop()
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package ratings
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Time allowed for the broker to confirm a published message.
+const natsTimeout = 5 * time.Second
+
+// natsPublisher publishes to a NATS server. It connects on the first Publish
+// and the client reconnects by itself after the connection is lost. Messages
+// are not buffered while it is down: Publish fails and the outbox retries.
+type natsPublisher struct {
+	url  string
+	name string
+
+	mu   sync.Mutex
+	conn *nats.Conn
+}
+
+func (p *natsPublisher) connect() (*nats.Conn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil || p.conn.IsClosed() {
+		conn, err := nats.Connect(p.url,
+			nats.Name(p.name),
+			nats.Timeout(natsTimeout),
+			nats.MaxReconnects(-1),
+			nats.CustomReconnectDelay(func(attempts int) time.Duration {
+				return min(publishRetryDelay<<min(attempts, 10), maxPublishRetryDelay)
+			}),
+			nats.ReconnectBufSize(-1),
+		)
+		if err != nil {
+			return nil, err
+		}
+		p.conn = conn
+	}
+	return p.conn, nil
+}
+
+// Publish returns once the server has the message.
+func (p *natsPublisher) Publish(ctx context.Context, subject string, data []byte) error {
+	conn, err := p.connect()
+	if err != nil {
+		return err
+	}
+	if err := conn.Publish(subject, data); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, natsTimeout)
+	defer cancel()
+	return conn.FlushWithContext(ctx)
+}
+
+func (p *natsPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn = nil
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package ratings
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeNATS accepts connections speaking the NATS protocol and records the
+// published messages.
+type fakeNATS struct {
+	listener net.Listener
+
+	mu        sync.Mutex
+	published []string
+	conns     []net.Conn
+}
+
+func startFakeNATS(t *testing.T) *fakeNATS {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeNATS{listener: l}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.conns = append(f.conns, conn)
+			f.mu.Unlock()
+			go f.handle(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeNATS) handle(conn net.Conn) {
+	defer conn.Close()
+	io.WriteString(conn, "INFO {\"server_id\":\"fake\",\"max_payload\":1048576}\r\n")
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+		case fields[0] == "PING":
+			io.WriteString(conn, "PONG\r\n")
+		case fields[0] == "PUB" && len(fields) == 3:
+			size, _ := strconv.Atoi(fields[2])
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.published = append(f.published, fields[1]+" "+string(payload[:size]))
+			f.mu.Unlock()
+		}
+	}
+}
+
+func (f *fakeNATS) messages() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.published...)
+}
+
+// dropConnections closes every client connection, as a restarting server
+// would.
+func (f *fakeNATS) dropConnections() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, conn := range f.conns {
+		conn.Close()
+	}
+	f.conns = nil
+}
+
+func TestNATSPublisherReconnects(t *testing.T) {
+	server := startFakeNATS(t)
+	publisher := &natsPublisher{url: "nats://" + server.listener.Addr().String(), name: "ratings"}
+	defer publisher.Close()
+
+	ctx := context.Background()
+	if err := publisher.Publish(ctx, "ratings.1", []byte(`{"id":1}`)); err != nil {
+		t.Fatalf("publishing: %v", err)
+	}
+
+	// Until the client reconnects Publish fails, and the outbox retries
+	server.dropConnections()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		err := publisher.Publish(ctx, "ratings.2", []byte(`{"id":2}`))
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("publishing after the connection was lost: %v", err)
+		}
+	}
+
+	want := []string{`ratings.1 {"id":1}`, `ratings.2 {"id":2}`}
+	if got := server.messages(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("server got %q, want %q", got, want)
+	}
+}
+
+func TestNATSPublisherUnreachable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	publisher := &natsPublisher{url: "nats://" + addr, name: "ratings"}
+	if err := publisher.Publish(context.Background(), "ratings.1", []byte("{}")); err == nil {
+		t.Error("expected an error from an unreachable broker")
+	}
+}
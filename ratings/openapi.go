@@ -0,0 +1,168 @@
+package ratings
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gin-gonic/gin"
+)
+
+// openAPISpec is the contract of this service, served at /openapi.json.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// loadOpenAPI parses and validates the embedded spec and builds a router
+// that maps requests to its operations.
+func loadOpenAPI() (*openapi3.T, routers.Router, error) {
+	// Keep validation errors to one line instead of dumping the schema.
+	openapi3.SchemaErrorDetailsDisabled = true
+	// Event streams are only checked to be text.
+	openapi3filter.RegisterBodyDecoder("text/event-stream", openapi3filter.FileBodyDecoder)
+
+	doc, err := openapi3.NewLoader().LoadFromData(openAPISpec)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, nil, err
+	}
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	return doc, router, nil
+}
+
+func openAPIHandler(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json", openAPISpec)
+}
+
+// openAPIValidator checks requests and responses against the spec. The mode
+// comes from the openapiValidation setting:
+//
+//	off    - no validation
+//	warn   - violations are logged (default)
+//	strict - invalid requests get a 400 and invalid responses a 500
+func openAPIValidator(router routers.Router, mode string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if mode == "off" {
+			c.Next()
+			return
+		}
+
+		route, pathParams, err := router.FindRoute(c.Request)
+		if err != nil {
+			// Unknown routes are left to gin, which answers 404/405.
+			c.Next()
+			return
+		}
+
+		requestInput := &openapi3filter.RequestValidationInput{
+			Request:    c.Request,
+			PathParams: pathParams,
+			Route:      route,
+			Options:    &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc},
+		}
+		if err := openapi3filter.ValidateRequest(c.Request.Context(), requestInput); err != nil {
+			log.Printf("OpenAPI request violation on %s %s: %v", c.Request.Method, c.Request.URL.Path, err)
+			if mode == "strict" {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if streamsEvents(route) {
+			c.Next()
+			return
+		}
+
+		writer := &capturingWriter{ResponseWriter: c.Writer, status: http.StatusOK, hold: mode == "strict"}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		responseInput := &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: requestInput,
+			Status:                 writer.status,
+			Header:                 writer.Header(),
+			Body:                   io.NopCloser(bytes.NewReader(writer.body.Bytes())),
+			Options: &openapi3filter.Options{
+				IncludeResponseStatus: true,
+				ExcludeResponseBody:   !strings.HasPrefix(writer.Header().Get("Content-Type"), "application/json"),
+			},
+		}
+		err = openapi3filter.ValidateResponse(c.Request.Context(), responseInput)
+		if err != nil {
+			log.Printf("OpenAPI response violation on %s %s: %v", c.Request.Method, c.Request.URL.Path, err)
+		}
+
+		if writer.hold {
+			if err != nil {
+				c.Writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+				c.Writer.WriteHeader(http.StatusInternalServerError)
+				c.Writer.Write([]byte(`{"error":"response does not conform to the API specification"}`))
+				return
+			}
+			c.Writer.WriteHeader(writer.status)
+			c.Writer.Write(writer.body.Bytes())
+		}
+	}
+}
+
+// streamsEvents reports whether the operation answers with an event stream,
+// which never ends and so can neither be buffered nor validated.
+func streamsEvents(route *routers.Route) bool {
+	ok := route.Operation.Responses.Status(http.StatusOK)
+	return ok != nil && ok.Value != nil && ok.Value.Content.Get("text/event-stream") != nil
+}
+
+// capturingWriter records the response for validation. When hold is set the
+// response is only buffered, so it can still be replaced.
+type capturingWriter struct {
+	gin.ResponseWriter
+	body   bytes.Buffer
+	status int
+	hold   bool
+}
+
+func (w *capturingWriter) WriteHeader(code int) {
+	w.status = code
+	if !w.hold {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *capturingWriter) WriteHeaderNow() {
+	if !w.hold {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *capturingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	if w.hold {
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *capturingWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *capturingWriter) Status() int {
+	return w.status
+}
+
+func (w *capturingWriter) Written() bool {
+	return w.hold || w.ResponseWriter.Written()
+}
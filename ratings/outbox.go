@@ -0,0 +1,248 @@
+package ratings
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// Delay between attempts to publish to a broker that failed, doubled up to
+// maxPublishRetryDelay while it keeps failing.
+const (
+	publishRetryDelay    = 100 * time.Millisecond
+	maxPublishRetryDelay = 5 * time.Second
+)
+
+// outboxEntry is a rating change waiting to be published.
+type outboxEntry struct {
+	seq     uint64
+	subject string
+	data    []byte
+}
+
+// outbox holds rating changes until every publisher has them. A change is
+// added under the same lock that stores it (see storeRatings), so the events
+// follow the order of the writes. With a state file the change is saved in
+// the same write as the ratings, and the relays resume from the saved changes
+// after a restart; changes published since the last write are saved too, so
+// they may be published again, with the same seq. Without one the outbox is
+// only in memory, like the ratings.
+// Each publisher has its own relay with its own position in the outbox, so a
+// broker that is down delays neither the others nor the writes.
+type outbox struct {
+	mu        sync.Mutex
+	entries   []outboxEntry
+	lastSeq   uint64
+	limit     int
+	delivered map[string]uint64 // last seq taken by each relay
+	added     chan struct{}     // closed and replaced when an entry is added
+	trimmed   chan struct{}     // closed and replaced when entries are removed
+}
+
+// ratingsOutbox receives the changes made through the HTTP and gRPC APIs.
+var ratingsOutbox = newOutbox(defaultConfig().OutboxLimit)
+
+func newOutbox(limit int) *outbox {
+	return &outbox{
+		limit:     limit,
+		delivered: map[string]uint64{},
+		added:     make(chan struct{}),
+		trimmed:   make(chan struct{}),
+	}
+}
+
+// add queues a change to the ratings of a product. commit, when not nil, is
+// given the entries and seq the outbox has with the change before the relays
+// can see it; if it fails the change is not queued. When the outbox is full
+// the oldest change is dropped; as each change carries the full ratings, a
+// later change of the same product makes up for it.
+func (o *outbox) add(productId int, ratings map[string]int, commit func(entries []outboxEntry, seq uint64) error) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	seq := o.lastSeq + 1
+	data, _ := json.Marshal(RatingEvent{Seq: seq, ProductID: productId, Ratings: ratings})
+	entries := append(o.entries[:len(o.entries):len(o.entries)], outboxEntry{seq: seq, subject: ratingsSubject(productId), data: data})
+	var dropped *outboxEntry
+	if len(entries) > o.limit {
+		dropped = &entries[0]
+		entries = entries[1:]
+	}
+	if commit != nil {
+		if err := commit(entries, seq); err != nil {
+			return err
+		}
+	}
+	if dropped != nil {
+		log.Printf("Outbox is full, dropping rating change %d of %s", dropped.seq, dropped.subject)
+	}
+	o.entries = entries
+	o.lastSeq = seq
+
+	close(o.added)
+	o.added = make(chan struct{})
+	return nil
+}
+
+// restore puts back the changes of a saved state. It is called before the
+// relays are registered, so they start with the oldest restored change.
+func (o *outbox) restore(seq uint64, entries []outboxEntry) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(entries) > o.limit {
+		entries = entries[len(entries)-o.limit:]
+	}
+	o.entries = entries
+	o.lastSeq = seq
+}
+
+// seq returns the seq of the last change added.
+func (o *outbox) seq() uint64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.lastSeq
+}
+
+// next returns the first entry after seq or, if there is none yet, a channel
+// that is closed when one is added.
+func (o *outbox) next(seq uint64) (outboxEntry, bool, <-chan struct{}) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, entry := range o.entries {
+		if entry.seq > seq {
+			return entry, true, nil
+		}
+	}
+	return outboxEntry{}, false, o.added
+}
+
+// register adds a relay that starts with the oldest queued change and
+// returns the seq it starts after.
+func (o *outbox) register(name string) uint64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	start := o.lastSeq
+	if len(o.entries) > 0 {
+		start = o.entries[0].seq - 1
+	}
+	o.delivered[name] = start
+	return start
+}
+
+// unregister removes a stopped relay, so it no longer holds entries back.
+func (o *outbox) unregister(name string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.delivered, name)
+}
+
+// ack records that the relay name published the entries up to seq and
+// removes the entries every relay has published.
+func (o *outbox) ack(name string, seq uint64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.delivered[name] = seq
+
+	done := seq
+	for _, delivered := range o.delivered {
+		done = min(done, delivered)
+	}
+	trim := 0
+	for trim < len(o.entries) && o.entries[trim].seq <= done {
+		trim++
+	}
+	if trim > 0 {
+		o.entries = o.entries[trim:]
+		close(o.trimmed)
+		o.trimmed = make(chan struct{})
+	}
+}
+
+// relay publishes the changes after seq to publisher in order until ctx is
+// done, retrying each one until the publisher takes it.
+func (o *outbox) relay(ctx context.Context, name string, seq uint64, publisher Publisher) {
+	delay := publishRetryDelay
+	for {
+		entry, ok, added := o.next(seq)
+		if !ok {
+			select {
+			case <-added:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if err := publisher.Publish(ctx, entry.subject, entry.data); err != nil {
+			log.Printf("Publishing rating change %d to %s failed, retrying in %s: %v", entry.seq, name, delay, err)
+			select {
+			case <-time.After(delay):
+				delay = min(2*delay, maxPublishRetryDelay)
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		delay = publishRetryDelay
+		seq = entry.seq
+		o.ack(name, seq)
+	}
+}
+
+// flush waits until every queued change is published or ctx is done.
+func (o *outbox) flush(ctx context.Context) {
+	for {
+		o.mu.Lock()
+		empty, trimmed := len(o.entries) == 0, o.trimmed
+		o.mu.Unlock()
+		if empty {
+			return
+		}
+		select {
+		case <-trimmed:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// startRelays publishes rating changes to localBus and, when configured, to
+// the broker. The returned function waits up to its context for the pending
+// changes to be published, then stops the relays.
+func startRelays(broker Publisher) func(context.Context) {
+	publishers := map[string]Publisher{"local": localBus}
+	if broker != nil {
+		publishers["broker"] = broker
+	}
+
+	// Every relay is registered before any of them runs, so none trims a
+	// change another has yet to publish
+	starts := map[string]uint64{}
+	for name := range publishers {
+		starts[name] = ratingsOutbox.register(name)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for name, publisher := range publishers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ratingsOutbox.relay(ctx, name, starts[name], publisher)
+		}()
+	}
+
+	return func(shutdownCtx context.Context) {
+		ratingsOutbox.flush(shutdownCtx)
+		cancel()
+		wg.Wait()
+		for name := range publishers {
+			ratingsOutbox.unregister(name)
+		}
+		if broker != nil {
+			broker.Close()
+		}
+	}
+}
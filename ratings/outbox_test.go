@@ -0,0 +1,207 @@
+package ratings
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// useOutbox gives the test an empty outbox relayed to localBus and, if not
+// nil, to broker.
+func useOutbox(t *testing.T, broker Publisher) {
+	t.Helper()
+	previous := ratingsOutbox
+	ratingsOutbox = newOutbox(10)
+	stop := startRelays(broker)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		stop(ctx)
+		ratingsOutbox = previous
+	})
+}
+
+// flakyPublisher fails while down is set and records what it published.
+type flakyPublisher struct {
+	mu        sync.Mutex
+	down      bool
+	published []string
+}
+
+func (p *flakyPublisher) Publish(ctx context.Context, subject string, data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.down {
+		return errors.New("broker is down")
+	}
+	p.published = append(p.published, subject+" "+string(data))
+	return nil
+}
+
+func (p *flakyPublisher) Close() error { return nil }
+
+func (p *flakyPublisher) setDown(down bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.down = down
+}
+
+func (p *flakyPublisher) messages() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.published...)
+}
+
+func TestOutboxRetriesUntilBrokerIsBack(t *testing.T) {
+	broker := &flakyPublisher{down: true}
+	useOutbox(t, broker)
+
+	local, unsubscribe := localBus.Subscribe(ratingsSubject(31))
+	defer unsubscribe()
+
+	storeRatings(31, map[string]int{"Reviewer1": 1}, true)
+	storeRatings(32, map[string]int{"Reviewer1": 2}, true)
+
+	// The local event streams are not held back by the broker
+	select {
+	case data := <-local:
+		if want := `{"seq":1,"id":31,"ratings":{"Reviewer1":1}}`; string(data) != want {
+			t.Errorf("local bus got %s, want %s", data, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the change did not reach the local bus while the broker was down")
+	}
+
+	ratingsOutbox.mu.Lock()
+	pending := len(ratingsOutbox.entries)
+	ratingsOutbox.mu.Unlock()
+	if pending != 2 {
+		t.Errorf("got %d changes in the outbox while the broker is down, want 2", pending)
+	}
+
+	broker.setDown(false)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ratingsOutbox.flush(ctx)
+
+	want := []string{
+		`ratings.31 {"seq":1,"id":31,"ratings":{"Reviewer1":1}}`,
+		`ratings.32 {"seq":2,"id":32,"ratings":{"Reviewer1":2}}`,
+	}
+	if got := broker.messages(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("broker got %q, want %q", got, want)
+	}
+}
+
+func TestOutboxDropsOldestChangeWhenFull(t *testing.T) {
+	o := newOutbox(2)
+	for id := 1; id <= 3; id++ {
+		o.add(id, map[string]int{"Reviewer1": id}, nil)
+	}
+
+	var subjects []string
+	for _, entry := range o.entries {
+		subjects = append(subjects, entry.subject)
+	}
+	if got := strings.Join(subjects, " "); got != "ratings.2 ratings.3" {
+		t.Errorf("got %s, want the two latest changes", got)
+	}
+}
+
+func TestOutboxRelayStartsWithQueuedChanges(t *testing.T) {
+	o := newOutbox(10)
+	o.add(1, map[string]int{"Reviewer1": 1}, nil)
+
+	broker := &flakyPublisher{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go o.relay(ctx, "broker", o.register("broker"), broker)
+
+	flushCtx, cancelFlush := context.WithTimeout(ctx, 5*time.Second)
+	defer cancelFlush()
+	o.flush(flushCtx)
+	if got := broker.messages(); len(got) != 1 || !strings.HasPrefix(got[0], "ratings.1 ") {
+		t.Errorf("broker got %q, want the change queued before the relay started", got)
+	}
+}
+
+// useRatings gives a test its own in-memory ratings, for restoreState to
+// replace.
+func useRatings(t *testing.T) {
+	t.Helper()
+	ratingsMu.Lock()
+	previous := userAddedRatings
+	userAddedRatings = map[int]map[string]int{}
+	ratingsMu.Unlock()
+	t.Cleanup(func() {
+		ratingsMu.Lock()
+		defer ratingsMu.Unlock()
+		userAddedRatings = previous
+	})
+}
+
+func TestOutboxStateSurvivesRestart(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "ratings.json")
+	useConfig(t, func(c *Config) { c.StateFile = stateFile })
+	useRatings(t)
+	previous := ratingsOutbox
+	t.Cleanup(func() { ratingsOutbox = previous })
+
+	// The process exits before any relay publishes the change
+	ratingsOutbox = newOutbox(10)
+	if _, err := storeRatings(41, map[string]int{"Reviewer1": 2}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new process with the same state file: the ratings are back and the
+	// relays publish the saved change
+	useRatings(t)
+	ratingsOutbox = newOutbox(10)
+	if err := restoreState(stateFile); err != nil {
+		t.Fatal(err)
+	}
+	if got := getLocalReviews(41); got["Reviewer1"] != 2 || len(got) != 1 {
+		t.Errorf("got ratings %v after the restart", got)
+	}
+
+	broker := &flakyPublisher{}
+	stop := startRelays(broker)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stop(ctx)
+
+	want := `ratings.41 {"seq":1,"id":41,"ratings":{"Reviewer1":2}}`
+	if got := broker.messages(); len(got) != 1 || got[0] != want {
+		t.Errorf("broker got %q after the restart, want %q", got, want)
+	}
+
+	// The seq carries on from the saved one
+	if _, err := storeRatings(41, map[string]int{"Reviewer1": 3}, true); err != nil {
+		t.Fatal(err)
+	}
+	if seq := ratingsOutbox.seq(); seq != 2 {
+		t.Errorf("got seq %d after the restart, want 2", seq)
+	}
+}
+
+func TestStoreRatingsWithoutSavingDoesNotQueue(t *testing.T) {
+	useConfig(t, func(c *Config) { c.StateFile = filepath.Join(t.TempDir(), "missing", "ratings.json") })
+	useRatings(t)
+	useOutbox(t, nil)
+
+	_, ratingsErr := storeRatings(42, map[string]int{"Reviewer1": 1}, true)
+	if ratingsErr == nil || ratingsErr.status != http.StatusInternalServerError {
+		t.Fatalf("got %+v, want a 500 when the state cannot be saved", ratingsErr)
+	}
+	if got := getLocalReviews(42); got["Reviewer1"] != 5 {
+		t.Errorf("got ratings %v, want the unchanged ones", got)
+	}
+	if seq := ratingsOutbox.seq(); seq != 0 {
+		t.Errorf("got seq %d, want the change left out of the outbox", seq)
+	}
+}
@@ -0,0 +1,34 @@
+package ratings
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/camilamedeir0s/bookinfo-go/ratelimit"
+	"github.com/gin-gonic/gin"
+)
+
+// rateLimitMiddleware builds the limiter from the rateLimits setting, which
+// was checked when the configuration was loaded. Routes are matched by method
+// and gin route pattern, and a client that runs out of tokens gets a 429 with
+// Retry-After. It returns nil when rate limiting is off.
+func rateLimitMiddleware() gin.HandlerFunc {
+	if config.RateLimits == "" {
+		return nil
+	}
+	rules, _ := ratelimit.ParseRules(config.RateLimits)
+	log.Printf("Rate limiting enabled: %s", config.RateLimits)
+	limiter := ratelimit.New(rules)
+
+	return func(c *gin.Context) {
+		allowed, wait := limiter.Allow(c.Request.Method+" "+c.FullPath(), func(kind string) string {
+			return ratelimit.ClientKey(c.Request.Header, kind, c.ClientIP())
+		})
+		if !allowed {
+			c.Header("Retry-After", ratelimit.RetryAfter(wait))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+			return
+		}
+		c.Next()
+	}
+}
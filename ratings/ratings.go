@@ -1,12 +1,17 @@
-package main
+// Package ratings is the ratings service of bookinfo, which stores the ratings
+// of the reviews and streams their changes. The command is in cmd/ratings.
+package ratings
 
 import (
 	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -19,14 +24,17 @@ import (
 
 var (
 	userAddedRatings = make(map[int]map[string]int) // in-memory ratings
+	ratingsMu        sync.Mutex                     // guards userAddedRatings
 	unavailable      = false
 	healthy          = true
 	db               *sql.DB
 	mongoClient      *mongo.Client
 )
 
-func init() {
-	if os.Getenv("SERVICE_VERSION") == "v-unavailable" {
+// injectFaults starts the availability flapping of the v-unavailable and
+// v-unhealthy versions.
+func injectFaults() {
+	if config.ServiceVersion == "v-unavailable" {
 		// make the service unavailable once in 60 seconds
 		go func() {
 			for {
@@ -36,7 +44,7 @@ func init() {
 		}()
 	}
 
-	if os.Getenv("SERVICE_VERSION") == "v-unhealthy" {
+	if config.ServiceVersion == "v-unhealthy" {
 		// make the service unhealthy every 15 minutes
 		go func() {
 			for {
@@ -48,46 +56,161 @@ func init() {
 	}
 }
 
-func main() {
-	r := gin.Default()
+// Main runs the ratings service with the command line arguments args until
+// SIGINT or SIGTERM.
+func Main(args []string) {
+	var err error
+	config, err = loadConfig(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+	if config.PrintConfig {
+		printConfig(os.Stdout, config)
+		return
+	}
+
+	server, err := setup()
+	if err != nil {
+		log.Fatal("Could not set up the service: ", err)
+	}
+
+	serveGRPC(config.GRPCPort, server)
+
+	serve(fmt.Sprintf(":%d", config.Port), server.Handler, server.cleanup...)
+}
+
+// New loads the configuration from args like Main and sets the service up
+// without listening, for the caller to serve.
+func New(args []string) (*Server, error) {
+	var err error
+	if config, err = loadConfig(args); err != nil {
+		return nil, err
+	}
+	return setup()
+}
+
+// setup builds the router and the gRPC server for the loaded configuration,
+// connects to the database of v2 and starts relaying rating changes. The
+// ratings added to a previous server are not kept, unless they were saved
+// to the state file.
+func setup() (*Server, error) {
+	authVerifier = nil
+	ratingsMu.Lock()
+	userAddedRatings = make(map[int]map[string]int)
+	ratingsMu.Unlock()
+
+	injectFaults()
+
+	broker, err := newPublisher(config.EventBusURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid event bus: %w", err)
+	}
+	ratingsOutbox = newOutbox(config.OutboxLimit)
+	if config.StateFile != "" {
+		if err := restoreState(config.StateFile); err != nil {
+			return nil, fmt.Errorf("loading the state file: %w", err)
+		}
+	}
+
+	r, err := setupRouter()
+	if err != nil {
+		return nil, fmt.Errorf("setting up the router: %w", err)
+	}
 
 	// Establish database connection based on version
-	if os.Getenv("SERVICE_VERSION") == "v2" {
-		dbType := os.Getenv("DB_TYPE")
-		if dbType == "mysql" {
-			var err error
-			host := os.Getenv("MYSQL_DB_HOST")
-			port := os.Getenv("MYSQL_DB_PORT")
-			user := os.Getenv("MYSQL_DB_USER")
-			password := os.Getenv("MYSQL_DB_PASSWORD")
-			dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/ratingsdb", user, password, host, port)
+	if config.ServiceVersion == "v2" {
+		if config.DBType == "mysql" {
+			dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/ratingsdb",
+				config.MySQLUser, config.MySQLPassword, config.MySQLHost, config.MySQLPort)
 
 			db, err = sql.Open("mysql", dsn)
 			if err != nil {
-				log.Fatal("Could not connect to MySQL database:", err)
+				return nil, fmt.Errorf("connecting to MySQL: %w", err)
+			}
+
+		} else {
+			// One client for the lifetime of the service, so it can be
+			// disconnected on shutdown.
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			mongoClient, err = mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURL))
+			cancel()
+			if err != nil {
+				return nil, fmt.Errorf("connecting to MongoDB: %w", err)
 			}
+		}
+	}
+
+	stopRelays := startRelays(broker)
+	grpcServer := newGRPCServer()
+	return &Server{
+		Handler: r,
+		grpc:    grpcServer,
+		cleanup: []func(context.Context){stopGRPC(grpcServer), stopRelays, closeDatabases},
+	}, nil
+}
 
+// closeDatabases releases the MySQL and MongoDB connections on shutdown.
+func closeDatabases(ctx context.Context) {
+	if db != nil {
+		if err := db.Close(); err != nil {
+			log.Printf("Could not close MySQL connection: %v", err)
+		}
+		db = nil
+	}
+	if mongoClient != nil {
+		if err := mongoClient.Disconnect(ctx); err != nil {
+			log.Printf("Could not disconnect from MongoDB: %v", err)
 		}
+		mongoClient = nil
+	}
+}
+
+// setupRouter registers the HTTP API behind the OpenAPI validation and JWT
+// authentication middlewares.
+func setupRouter() (*gin.Engine, error) {
+	_, spec, err := loadOpenAPI()
+	if err != nil {
+		return nil, err
 	}
 
+	if config.JWTJWKSFile != "" {
+		if authVerifier, err = loadJWKS(config.JWTJWKSFile, config.JWTIssuer); err != nil {
+			return nil, fmt.Errorf("loading JWKS: %w", err)
+		}
+	} else {
+		log.Println("JWT_JWKS_FILE not set, rating writes are not authenticated")
+	}
+
+	r := gin.Default()
+	// Without trusted proxies gin ignores X-Forwarded-For and the client IP
+	// is the peer address
+	if err := r.SetTrustedProxies(config.TrustedProxies); err != nil {
+		return nil, err
+	}
+	if limiter := rateLimitMiddleware(); limiter != nil {
+		r.Use(limiter)
+	}
+	r.Use(openAPIValidator(spec, config.OpenAPIValidation))
+	r.Use(authMiddleware)
+
 	// Routes
+	r.GET("/openapi.json", openAPIHandler)
 	r.GET("/ratings/:productId", getRatings)
 	r.POST("/ratings/:productId", postRatings)
+	r.GET("/ratings/:productId/stream", streamRatings)
 	r.GET("/health", healthCheck)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8085"
-	}
-	r.Run(":" + port)
+	return r, nil
 }
 
 func getRatings(c *gin.Context) {
-	if os.Getenv("SERVICE_VERSION") == "v-unavailable" || os.Getenv("SERVICE_VERSION") == "v-unhealthy" {
-		if unavailable {
-			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Service unavailable"})
-			return
-		}
+	if isUnavailable() {
+		c.Header("Retry-After", "60")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Service unavailable"})
+		return
 	}
 
 	productId, err := strconv.Atoi(c.Param("productId"))
@@ -96,106 +219,109 @@ func getRatings(c *gin.Context) {
 		return
 	}
 
-	if os.Getenv("SERVICE_VERSION") == "v2" {
+	ratings, ratingsErr := lookupRatings(productId)
+	if ratingsErr != nil {
+		c.JSON(ratingsErr.status, gin.H{"error": ratingsErr.message})
+		return
+	}
 
-		var firstRating, secondRating int
+	c.JSON(http.StatusOK, gin.H{"id": productId, "ratings": ratings})
+}
 
-		if os.Getenv("DB_TYPE") == "mysql" {
-			err = db.Ping()
-			if err != nil {
-				c.JSON(http.StatusOK, gin.H{"error": "could not connect to ratings database"})
-				return
-			}
+// ratingsError carries the HTTP status a failed lookup is reported with.
+type ratingsError struct {
+	status  int
+	message string
+}
 
-			rows, err := db.Query("SELECT Rating FROM ratings LIMIT 2")
-			if err != nil {
-				fmt.Println(err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "could not perform select"})
-				return
-			}
-			defer rows.Close()
-
-			count := 0
-			for rows.Next() {
-				if count == 0 {
-					err = rows.Scan(&firstRating)
-				} else if count == 1 {
-					err = rows.Scan(&secondRating)
-				}
-				if err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "could not retrieve ratings"})
-					return
-				}
-				count++
-			}
+func isUnavailable() bool {
+	if config.ServiceVersion == "v-unavailable" || config.ServiceVersion == "v-unhealthy" {
+		return unavailable
+	}
+	return false
+}
 
-			if count == 0 {
-				c.JSON(http.StatusNotFound, gin.H{"error": "ratings not found"})
-				return
-			}
+// lookupRatings returns the ratings of a product from the backend selected by
+// SERVICE_VERSION and DB_TYPE. It is shared by the HTTP and gRPC APIs.
+func lookupRatings(productId int) (map[string]int, *ratingsError) {
+	if isUnavailable() {
+		return nil, &ratingsError{http.StatusServiceUnavailable, "Service unavailable"}
+	}
 
-		} else {
-			var err error
-			mongoURL := os.Getenv("MONGO_DB_URL")
+	if config.ServiceVersion != "v2" {
+		return getLocalReviews(productId), nil
+	}
 
-			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-			defer cancel()
+	var firstRating, secondRating int
 
-			// Substitui mongoClient.Connect por mongo.Connect
-			mongoClient, err = mongo.Connect(ctx, options.Client().ApplyURI(mongoURL))
-			if err != nil {
-				log.Fatal("Could not connect to MongoDB:", err)
-			}
+	if config.DBType == "mysql" {
+		err := db.Ping()
+		if err != nil {
+			return nil, &ratingsError{http.StatusOK, "could not connect to ratings database"}
+		}
 
-			collection := mongoClient.Database("test").Collection("ratings")
-			cursor, err := collection.Find(ctx, bson.M{})
+		rows, err := db.Query("SELECT Rating FROM ratings LIMIT 2")
+		if err != nil {
+			fmt.Println(err)
+			return nil, &ratingsError{http.StatusInternalServerError, "could not perform select"}
+		}
+		defer rows.Close()
+
+		count := 0
+		for rows.Next() {
+			if count == 0 {
+				err = rows.Scan(&firstRating)
+			} else if count == 1 {
+				err = rows.Scan(&secondRating)
+			}
 			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "could not connect to ratings database"})
-				return
+				return nil, &ratingsError{http.StatusInternalServerError, "could not retrieve ratings"}
 			}
-			defer cursor.Close(ctx)
+			count++
+		}
 
-			var ratingsData []bson.M // Usando bson.M para mapear os dados diretamente
-			if err = cursor.All(ctx, &ratingsData); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "could not parse ratings data"})
-				return
-			}
+		if count == 0 {
+			return nil, &ratingsError{http.StatusNotFound, "ratings not found"}
+		}
 
-			firstRating, secondRating := 0, 0
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
 
-			// Verifica se existem registros suficientes e atribui os ratings
-			if len(ratingsData) > 0 {
-				if val, ok := ratingsData[0]["rating"].(int32); ok {
-					firstRating = int(val)
-				} else {
-					fmt.Println("Rating for Reviewer1 not found or not an integer")
-				}
-			}
+		collection := mongoClient.Database("test").Collection("ratings")
+		cursor, err := collection.Find(ctx, bson.M{})
+		if err != nil {
+			return nil, &ratingsError{http.StatusInternalServerError, "could not connect to ratings database"}
+		}
+		defer cursor.Close(ctx)
 
-			if len(ratingsData) > 1 {
-				if val, ok := ratingsData[1]["rating"].(int32); ok {
-					secondRating = int(val)
-				} else {
-					fmt.Println("Rating for Reviewer2 not found or not an integer")
-				}
-			}
+		var ratingsData []bson.M // Usando bson.M para mapear os dados diretamente
+		if err = cursor.All(ctx, &ratingsData); err != nil {
+			return nil, &ratingsError{http.StatusInternalServerError, "could not parse ratings data"}
+		}
 
-			result := map[string]interface{}{
-				"id": productId,
-				"ratings": map[string]int{
-					"Reviewer1": firstRating,
-					"Reviewer2": secondRating,
-				},
+		// Verifica se existem registros suficientes e atribui os ratings
+		if len(ratingsData) > 0 {
+			if val, ok := ratingsData[0]["rating"].(int32); ok {
+				firstRating = int(val)
+			} else {
+				fmt.Println("Rating for Reviewer1 not found or not an integer")
 			}
-
-			c.JSON(http.StatusOK, result)
-
 		}
 
-	} else {
-		c.JSON(http.StatusOK, getLocalReviews(productId))
+		if len(ratingsData) > 1 {
+			if val, ok := ratingsData[1]["rating"].(int32); ok {
+				secondRating = int(val)
+			} else {
+				fmt.Println("Rating for Reviewer2 not found or not an integer")
+			}
+		}
 	}
 
+	return map[string]int{
+		"Reviewer1": firstRating,
+		"Reviewer2": secondRating,
+	}, nil
 }
 
 func postRatings(c *gin.Context) {
@@ -211,36 +337,90 @@ func postRatings(c *gin.Context) {
 		return
 	}
 
-	if os.Getenv("SERVICE_VERSION") == "v2" {
-		c.JSON(http.StatusNotImplemented, gin.H{"error": "Post not implemented for database backed ratings"})
-	} else {
-		c.JSON(http.StatusOK, putLocalReviews(productId, ratings))
+	replace, ratingsErr := authorizeRatings(requestClaims(c), ratings)
+	if ratingsErr != nil {
+		if ratingsErr.status == http.StatusUnauthorized {
+			c.Header("WWW-Authenticate", "Bearer")
+		}
+		c.JSON(ratingsErr.status, gin.H{"error": ratingsErr.message})
+		return
+	}
+
+	stored, ratingsErr := storeRatings(productId, ratings, replace)
+	if ratingsErr != nil {
+		c.JSON(ratingsErr.status, gin.H{"error": ratingsErr.message})
+		return
 	}
+
+	c.JSON(http.StatusOK, gin.H{"id": productId, "ratings": stored})
+}
+
+// storeRatings replaces the ratings of a product, or merges them into the
+// existing ones when replace is false. Only the in-memory backend supports
+// writes. The stored ratings are queued in the outbox for the subscribers of
+// the product and, with a state file, saved together with the outbox; a
+// change that cannot be saved is neither stored nor queued.
+func storeRatings(productId int, ratings map[string]int, replace bool) (map[string]int, *ratingsError) {
+	if config.ServiceVersion == "v2" {
+		return nil, &ratingsError{http.StatusNotImplemented, "Post not implemented for database backed ratings"}
+	}
+
+	// The change is queued under the lock, so the outbox has the changes in
+	// the order they were made.
+	ratingsMu.Lock()
+	defer ratingsMu.Unlock()
+	stored := mergeLocalReviews(productId, ratings, replace)
+	err := ratingsOutbox.add(productId, stored, func(entries []outboxEntry, seq uint64) error {
+		return saveLocalReviews(productId, stored, entries, seq)
+	})
+	if err != nil {
+		log.Printf("Could not save the ratings of product %d: %v", productId, err)
+		return nil, &ratingsError{http.StatusInternalServerError, "could not save ratings"}
+	}
+	userAddedRatings[productId] = stored
+	return stored, nil
 }
 
 func healthCheck(c *gin.Context) {
-	if healthy {
-		c.JSON(http.StatusOK, gin.H{"status": "Ratings is healthy"})
+	if draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "Ratings is shutting down", "version": config.ServiceVersion})
+	} else if healthy {
+		c.JSON(http.StatusOK, gin.H{"status": "Ratings is healthy", "version": config.ServiceVersion})
 	} else {
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "Ratings is not healthy"})
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "Ratings is not healthy", "version": config.ServiceVersion})
+	}
+}
+
+// mergeLocalReviews returns the ratings a product has after a change. It is
+// called with ratingsMu held. The stored maps are never modified afterwards,
+// so they can be handed out without copying.
+func mergeLocalReviews(productId int, ratings map[string]int, replace bool) map[string]int {
+	if replace {
+		return ratings
+	}
+	merged := make(map[string]int)
+	for reviewer, stars := range localReviews(productId) {
+		merged[reviewer] = stars
+	}
+	for reviewer, stars := range ratings {
+		merged[reviewer] = stars
 	}
+	return merged
 }
 
-func putLocalReviews(productId int, ratings map[string]int) map[string]interface{} {
-	userAddedRatings[productId] = ratings
-	return getLocalReviews(productId)
+func getLocalReviews(productId int) map[string]int {
+	ratingsMu.Lock()
+	defer ratingsMu.Unlock()
+	return localReviews(productId)
 }
 
-func getLocalReviews(productId int) map[string]interface{} {
+func localReviews(productId int) map[string]int {
 	if val, ok := userAddedRatings[productId]; ok {
-		return map[string]interface{}{"id": productId, "ratings": val}
+		return val
 	}
 
-	return map[string]interface{}{
-		"id": productId,
-		"ratings": map[string]int{
-			"Reviewer1": 5,
-			"Reviewer2": 4,
-		},
+	return map[string]int{
+		"Reviewer1": 5,
+		"Reviewer2": 4,
 	}
 }
@@ -0,0 +1,93 @@
+package ratings
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// Server is the ratings service set up by New: Main serves it on the
+// configured ports, and the integration tests on listeners of their own.
+type Server struct {
+	// Handler serves the HTTP API.
+	Handler http.Handler
+	grpc    *grpc.Server
+	cleanup []func(context.Context)
+}
+
+// ServeGRPC serves the gRPC API on lis until the server is closed.
+func (s *Server) ServeGRPC(lis net.Listener) error {
+	return s.grpc.Serve(lis)
+}
+
+// Close stops the gRPC server, letting in-flight RPCs finish until ctx
+// expires, flushes the outbox and closes the database connections.
+func (s *Server) Close(ctx context.Context) {
+	for _, fn := range s.cleanup {
+		fn(ctx)
+	}
+}
+
+// draining is set when a shutdown signal arrives. /health then fails, so the
+// pod is taken out of the load balancer before its connections are drained.
+var draining atomic.Bool
+
+// shuttingDown is closed when the server starts draining connections, so
+// long-lived streams end instead of holding up the shutdown.
+var shuttingDown = make(chan struct{})
+
+// serve runs handler on addr until SIGINT or SIGTERM. On a signal it marks the
+// service as draining, waits drainPeriod for readiness probes to notice, then
+// stops accepting connections and waits up to shutdownTimeout for in-flight
+// requests. The cleanup functions run last, e.g. to stop the gRPC server or
+// close database connections.
+func serve(addr string, handler http.Handler, cleanup ...func(context.Context)) {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		ReadTimeout:       config.ReadTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	errs := make(chan error, 1)
+	go func() {
+		log.Printf("HTTP server started at %s", addr)
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+	stop()
+
+	drain := config.DrainPeriod
+	log.Printf("Shutting down, failing readiness for %s before draining", drain)
+	draining.Store(true)
+	time.Sleep(drain)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+	close(shuttingDown)
+	if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("HTTP server did not drain cleanly: %v", err)
+	}
+	for _, fn := range cleanup {
+		fn(shutdownCtx)
+	}
+	log.Println("Shutdown complete")
+}
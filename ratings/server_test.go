@@ -0,0 +1,145 @@
+package ratings
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestServeDrainsOnSIGTERM(t *testing.T) {
+	useConfig(t, func(c *Config) {
+		c.DrainPeriod = 50 * time.Millisecond
+		c.ShutdownTimeout = 5 * time.Second
+	})
+	defer draining.Store(false)
+	previousShuttingDown := shuttingDown
+	shuttingDown = make(chan struct{})
+	defer func() { shuttingDown = previousShuttingDown }()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	started, release := make(chan struct{}), make(chan struct{})
+	var served atomic.Bool
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(started)
+			<-release
+			served.Store(true)
+		}
+		io.WriteString(w, "ok")
+	})
+
+	// Without keep-alives the client leaves no spare connection behind, which
+	// the server would wait for until ShutdownTimeout
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+	cleanedUp := make(chan bool, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		serve(addr, handler, func(ctx context.Context) { cleanedUp <- served.Load() && ctx.Err() == nil })
+	}()
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if resp, err := client.Get("http://" + addr + "/"); err == nil {
+			resp.Body.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the server did not start")
+		}
+	}
+
+	slow := make(chan int, 1)
+	go func() {
+		resp, err := client.Get("http://" + addr + "/slow")
+		if err != nil {
+			slow <- 0
+			return
+		}
+		resp.Body.Close()
+		slow <- resp.StatusCode
+	}()
+	<-started
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); !draining.Load(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the service did not start draining")
+		}
+	}
+
+	// The in-flight request completes before the server stops
+	close(release)
+	if status := <-slow; status != http.StatusOK {
+		t.Errorf("got status %d for the in-flight request, want 200", status)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not return")
+	}
+	if ok := <-cleanedUp; !ok {
+		t.Error("cleanup ran before the in-flight request finished or after the shutdown timeout")
+	}
+	if _, err := client.Get("http://" + addr + "/"); err == nil {
+		t.Error("the server still accepts connections")
+	}
+	select {
+	case <-shuttingDown:
+	default:
+		t.Error("event streams were not told about the shutdown")
+	}
+}
+
+func TestRouterTrustsForwardedForOnlyFromTrustedProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	get := func(r http.Handler, forwardedFor string) int {
+		req := httptest.NewRequest("GET", "/health", nil)
+		req.RemoteAddr = "10.0.0.5:1234"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for _, tt := range []struct {
+		trusted []string
+		want    int
+	}{
+		// Each request claims another client; only a trusted proxy is
+		// believed, so otherwise they share the peer's bucket
+		{nil, http.StatusTooManyRequests},
+		{[]string{"10.0.0.0/8"}, http.StatusOK},
+	} {
+		useConfig(t, func(c *Config) {
+			c.OpenAPIValidation = "off"
+			c.RateLimits = "*=1/m"
+			c.TrustedProxies = tt.trusted
+		})
+		r, err := setupRouter()
+		if err != nil {
+			t.Fatal(err)
+		}
+		get(r, "203.0.113.1")
+		if got := get(r, "203.0.113.2"); got != tt.want {
+			t.Errorf("trusted proxies %v: got status %d for a second client, want %d", tt.trusted, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package ratings
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// ratingsState is what the state file holds: the in-memory ratings together
+// with the rating changes not yet published. A change and its event are
+// written in the same file, so after a crash either both are there or
+// neither is.
+type ratingsState struct {
+	Ratings map[int]map[string]int `json:"ratings"`
+	Seq     uint64                 `json:"seq"`
+	Outbox  []savedEntry           `json:"outbox"`
+}
+
+type savedEntry struct {
+	Seq     uint64          `json:"seq"`
+	Subject string          `json:"subject"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// loadState reads the state file at path. A missing file is an empty state,
+// as on the first start.
+func loadState(path string) (ratingsState, error) {
+	state := ratingsState{Ratings: map[int]map[string]int{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, err
+	}
+	if state.Ratings == nil {
+		state.Ratings = map[int]map[string]int{}
+	}
+	return state, nil
+}
+
+// saveState replaces the state file at path. The state is written to a
+// temporary file in the same directory, synced and renamed over the old one,
+// so a crash leaves either the old or the new state.
+func saveState(path string, state ratingsState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// saveLocalReviews saves the in-memory ratings with the change to the ratings
+// of productId, and the outbox entries and seq that include it. It is called
+// with ratingsMu held, as the commit of the outbox change. Without a state
+// file there is nothing to save.
+func saveLocalReviews(productId int, ratings map[string]int, entries []outboxEntry, seq uint64) error {
+	if config.StateFile == "" {
+		return nil
+	}
+
+	state := ratingsState{Ratings: make(map[int]map[string]int, len(userAddedRatings)+1), Seq: seq}
+	for id, stored := range userAddedRatings {
+		state.Ratings[id] = stored
+	}
+	state.Ratings[productId] = ratings
+	for _, entry := range entries {
+		state.Outbox = append(state.Outbox, savedEntry{Seq: entry.seq, Subject: entry.subject, Data: entry.data})
+	}
+	return saveState(config.StateFile, state)
+}
+
+// restoreState loads the state file into the in-memory ratings and the
+// outbox. It runs before the relays start, so they publish the saved changes
+// first.
+func restoreState(path string) error {
+	state, err := loadState(path)
+	if err != nil {
+		return err
+	}
+
+	entries := make([]outboxEntry, 0, len(state.Outbox))
+	for _, entry := range state.Outbox {
+		entries = append(entries, outboxEntry{seq: entry.Seq, subject: entry.Subject, data: entry.Data})
+	}
+
+	ratingsMu.Lock()
+	defer ratingsMu.Unlock()
+	userAddedRatings = state.Ratings
+	ratingsOutbox.restore(state.Seq, entries)
+	return nil
+}
@@ -0,0 +1,161 @@
+package reviews
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// authVerifier checks the tokens issued by productpage. It is nil when
+// JWT_JWKS_FILE is not set, in which case tokens are only propagated.
+var authVerifier *jwtVerifier
+
+// Claims are the JWT claims issued by productpage on login.
+type Claims struct {
+	Roles []string `json:"roles,omitempty"`
+	jwt.RegisteredClaims
+}
+
+type jwtVerifier struct {
+	// keys holds *rsa.PublicKey for RS256 and []byte for HS256, by key id.
+	keys   map[string]interface{}
+	issuer string
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	K   string `json:"k"`
+}
+
+// loadJWKS reads a JSON Web Key Set with RSA ("kty": "RSA") and/or shared
+// secret ("kty": "oct") keys.
+func loadJWKS(path, issuer string) (*jwtVerifier, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parsing JWKS: %w", err)
+	}
+
+	verifier := &jwtVerifier{keys: map[string]interface{}{}, issuer: issuer}
+	for _, key := range set.Keys {
+		switch key.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(key.N)
+			e, errE := base64.RawURLEncoding.DecodeString(key.E)
+			if errN != nil || errE != nil {
+				return nil, fmt.Errorf("invalid RSA key %q", key.Kid)
+			}
+			verifier.keys[key.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(key.K)
+			if err != nil {
+				return nil, fmt.Errorf("invalid oct key %q", key.Kid)
+			}
+			verifier.keys[key.Kid] = secret
+		default:
+			return nil, fmt.Errorf("unsupported key type %q", key.Kty)
+		}
+	}
+
+	if len(verifier.keys) == 0 {
+		return nil, errors.New("JWKS has no keys")
+	}
+	return verifier, nil
+}
+
+func (v *jwtVerifier) Verify(tokenString string) (*Claims, error) {
+	options := []jwt.ParserOption{jwt.WithValidMethods([]string{"RS256", "HS256"}), jwt.WithExpirationRequired()}
+	if v.issuer != "" {
+		options = append(options, jwt.WithIssuer(v.issuer))
+	}
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, v.key, options...)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+	return claims, nil
+}
+
+// key picks the verification key by kid and makes sure its type matches the
+// signing method, so an RSA public key can't be used as an HMAC secret.
+func (v *jwtVerifier) key(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := v.keys[kid]
+	if !ok && kid == "" && len(v.keys) == 1 {
+		for _, only := range v.keys {
+			key, ok = only, true
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	switch token.Method.(type) {
+	case *jwt.SigningMethodRSA:
+		if _, isRSA := key.(*rsa.PublicKey); isRSA {
+			return key, nil
+		}
+	case *jwt.SigningMethodHMAC:
+		if _, isSecret := key.([]byte); isSecret {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("key %q can't verify %s tokens", kid, token.Method.Alg())
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer ..." header.
+func bearerToken(header string) string {
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+// authMiddleware verifies the bearer token when one is sent and stores its
+// claims in the context. Reviews are public, so requests without a token
+// continue anonymously, but a bad token is rejected before it is propagated
+// to ratings.
+func authMiddleware(c *gin.Context) {
+	if authVerifier == nil {
+		c.Next()
+		return
+	}
+
+	token := bearerToken(c.GetHeader("Authorization"))
+	if token == "" {
+		c.Next()
+		return
+	}
+
+	claims, err := authVerifier.Verify(token)
+	if err != nil {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token: " + err.Error()})
+		return
+	}
+
+	c.Set("claims", claims)
+	c.Next()
+}
@@ -0,0 +1,12 @@
+// Command reviews serves the reviews service; see the reviews package.
+package main
+
+import (
+	"os"
+
+	"github.com/camilamedeir0s/bookinfo-go/reviews"
+)
+
+func main() {
+	reviews.Main(os.Args[1:])
+}
@@ -0,0 +1,32 @@
+package reviews
+
+import "testing"
+
+// useConfig replaces the service configuration for the duration of a test.
+func useConfig(t *testing.T, change func(*Config)) {
+	t.Helper()
+	previous := config
+	config = defaultConfig()
+	change(&config)
+	t.Cleanup(func() { config = previous })
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("RATINGS_HOSTNAME", "ratings.bookinfo")
+	t.Setenv("ENABLE_RATINGS", "true")
+
+	cfg, err := loadConfig([]string{"--ratings-service-port=9085", "--port", "9186"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ratingsURL() != "http://ratings.bookinfo:9085/ratings" || !cfg.EnableRatings {
+		t.Errorf("got ratings URL %s, enabled %v", cfg.ratingsURL(), cfg.EnableRatings)
+	}
+	if cfg.Port != 9186 || cfg.GRPCPort != 9096 {
+		t.Errorf("got ports %d/%d", cfg.Port, cfg.GRPCPort)
+	}
+
+	if _, err := loadConfig([]string{"--client-protocol=soap"}); err == nil {
+		t.Error("expected an error for an unknown client protocol")
+	}
+}
@@ -0,0 +1,206 @@
+package reviews
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Subject of the rating changes of every product; ratings publishes each
+// change to ratings.<productId>.
+const ratingsEventsSubject = "ratings.*"
+
+// Delay between attempts to reconnect to the event bus, doubled up to
+// maxSubscribeRetryDelay while it keeps failing.
+const (
+	subscribeRetryDelay    = 100 * time.Millisecond
+	maxSubscribeRetryDelay = 5 * time.Second
+)
+
+// ratingsCache keeps the ratings read from the ratings service for
+// RATINGS_CACHE_TTL. With an event bus, a product is evicted as soon as
+// ratings publishes a change to it, so the TTL only bounds how stale an entry
+// gets when an event is lost. The cache is suspended while the bus is
+// unreachable, as changes would go unnoticed.
+type ratingsCache struct {
+	mu      sync.Mutex
+	entries map[int]cachedRatings
+	epoch   uint64 // incremented on every eviction
+	live    bool
+}
+
+type cachedRatings struct {
+	ratings map[string]int
+	expires time.Time
+}
+
+var ratingsByProduct = newRatingsCache()
+
+func newRatingsCache() *ratingsCache {
+	return &ratingsCache{entries: map[int]cachedRatings{}, live: true}
+}
+
+// get returns the cached ratings of a product or, on a miss, the epoch to
+// pass to put once they are fetched.
+func (c *ratingsCache) get(productId int) (map[string]int, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[productId]; ok && c.live && time.Now().Before(entry.expires) {
+		return entry.ratings, c.epoch, true
+	}
+	return nil, c.epoch, false
+}
+
+// put caches ratings fetched since epoch. They are dropped if an eviction
+// happened meanwhile, as they may predate the change that caused it.
+func (c *ratingsCache) put(productId int, ratings map[string]int, epoch uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.live || epoch != c.epoch {
+		return
+	}
+	c.entries[productId] = cachedRatings{ratings: ratings, expires: time.Now().Add(config.RatingsCacheTTL)}
+}
+
+func (c *ratingsCache) evict(productId int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.epoch++
+	delete(c.entries, productId)
+}
+
+// suspend empties the cache and stops it from caching until resume.
+func (c *ratingsCache) suspend() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.epoch++
+	c.live = false
+	c.entries = map[int]cachedRatings{}
+}
+
+func (c *ratingsCache) resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.live = true
+}
+
+// lookupRatings returns the ratings of a product from the cache or, on a
+// miss, from the ratings service. nil means ratings could not be reached.
+func lookupRatings(productId string, header http.Header) map[string]int {
+	id, err := strconv.Atoi(productId)
+	cacheable := err == nil && config.RatingsCacheTTL > 0
+
+	var epoch uint64
+	if cacheable {
+		var ratings map[string]int
+		var hit bool
+		if ratings, epoch, hit = ratingsByProduct.get(id); hit {
+			return ratings
+		}
+	}
+
+	var ratings map[string]int
+	if config.ClientProtocol == "grpc" {
+		ratings, _ = getRatingsGRPC(productId, header)
+	} else if ratingsResponse, err := getRatings(productId, header); err == nil {
+		ratings = parseRatings(ratingsResponse)
+	}
+
+	if cacheable && ratings != nil {
+		ratingsByProduct.put(id, ratings, epoch)
+	}
+	return ratings
+}
+
+// checkEventBusURL reports whether eventBusURL names a NATS server.
+func checkEventBusURL(eventBusURL string) error {
+	u, err := url.Parse(eventBusURL)
+	if err != nil || u.Scheme != "nats" || u.Host == "" {
+		return fmt.Errorf("eventBusUrl must be nats://host:port, got %q", eventBusURL)
+	}
+	return nil
+}
+
+// watchRatingEvents evicts cached ratings as the NATS server at eventBusURL
+// reports changes, until the returned function is called. The client
+// reconnects and subscribes again by itself; the cache is suspended while the
+// connection is down and resumes empty, since changes may have been missed.
+func watchRatingEvents(eventBusURL string) func(context.Context) {
+	cache := ratingsByProduct
+	cache.suspend()
+
+	// The cache resumes once the server has the subscription, which the
+	// connection handlers may not know on the first connection
+	var subscribed atomic.Bool
+	closed := make(chan struct{})
+	resume := func(conn *nats.Conn) {
+		if !subscribed.Load() {
+			return
+		}
+		if err := conn.Flush(); err != nil {
+			log.Printf("Subscription to rating changes not confirmed: %v", err)
+			return
+		}
+		log.Printf("Evicting cached ratings on changes from %s", conn.ConnectedUrlRedacted())
+		cache.resume()
+	}
+
+	conn, err := nats.Connect(eventBusURL,
+		nats.Name("reviews"),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.CustomReconnectDelay(func(attempts int) time.Duration {
+			return min(subscribeRetryDelay<<min(attempts, 10), maxSubscribeRetryDelay)
+		}),
+		nats.ConnectHandler(resume),
+		nats.ReconnectHandler(resume),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			cache.suspend()
+			if err != nil {
+				log.Printf("Subscription to rating changes lost, reconnecting: %v", err)
+			}
+		}),
+		nats.ClosedHandler(func(*nats.Conn) { close(closed) }),
+	)
+	if err == nil {
+		_, err = conn.Subscribe(ratingsEventsSubject, func(msg *nats.Msg) {
+			onRatingEvent(cache, msg.Subject, msg.Data)
+		})
+	}
+	if err != nil {
+		log.Printf("Could not subscribe to rating changes, ratings are not cached: %v", err)
+		if conn != nil {
+			conn.Close()
+		}
+		return func(context.Context) {}
+	}
+	subscribed.Store(true)
+	if conn.IsConnected() {
+		resume(conn)
+	}
+
+	// Waits for the handlers, which run after Close returns
+	return func(context.Context) {
+		conn.Close()
+		<-closed
+	}
+}
+
+// onRatingEvent evicts the product whose ratings changed from cache.
+func onRatingEvent(cache *ratingsCache, subject string, data []byte) {
+	productId, err := strconv.Atoi(strings.TrimPrefix(subject, "ratings."))
+	if err != nil {
+		log.Printf("Ignoring event on unexpected subject %s", subject)
+		return
+	}
+	cache.evict(productId)
+}
@@ -0,0 +1,158 @@
+package reviews
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeNATS accepts subscriptions over the NATS protocol and delivers the
+// messages passed to send.
+type fakeNATS struct {
+	listener net.Listener
+
+	mu   sync.Mutex
+	subs map[net.Conn]string // sid of each subscribed connection
+}
+
+func startFakeNATS(t *testing.T) *fakeNATS {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeNATS{listener: l, subs: map[net.Conn]string{}}
+	t.Cleanup(func() {
+		l.Close()
+		f.dropConnections()
+	})
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.handle(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeNATS) handle(conn net.Conn) {
+	defer conn.Close()
+	io.WriteString(conn, "INFO {\"server_id\":\"fake\",\"max_payload\":1048576}\r\n")
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+		case fields[0] == "PING":
+			f.mu.Lock()
+			io.WriteString(conn, "PONG\r\n")
+			f.mu.Unlock()
+		case fields[0] == "SUB" && len(fields) == 3:
+			f.mu.Lock()
+			f.subs[conn] = fields[2]
+			f.mu.Unlock()
+		}
+	}
+}
+
+func (f *fakeNATS) send(subject, data string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for conn, sid := range f.subs {
+		fmt.Fprintf(conn, "MSG %s %s %d\r\n%s\r\n", subject, sid, len(data), data)
+	}
+}
+
+func (f *fakeNATS) dropConnections() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for conn := range f.subs {
+		conn.Close()
+	}
+	f.subs = map[net.Conn]string{}
+}
+
+// eventually fails the test if condition does not hold within a second.
+func eventually(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !condition(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRatingEventsEvictCachedRatings(t *testing.T) {
+	var lookups atomic.Int32
+	ratings := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups.Add(1)
+		io.WriteString(w, `{"id":1,"ratings":{"Reviewer1":5,"Reviewer2":4}}`)
+	}))
+	defer ratings.Close()
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(ratings.URL, "http://"))
+	servicePort, _ := strconv.Atoi(port)
+
+	broker := startFakeNATS(t)
+	useConfig(t, func(c *Config) {
+		c.EnableRatings = true
+		c.RatingsHostname = host
+		c.RatingsServicePort = servicePort
+		c.RatingsCacheTTL = time.Hour
+	})
+	previous := ratingsByProduct
+	ratingsByProduct = &ratingsCache{entries: map[int]cachedRatings{}, live: true}
+	defer func() { ratingsByProduct = previous }()
+
+	stop := watchRatingEvents("nats://" + broker.listener.Addr().String())
+	defer stop(context.Background())
+	live := func() bool {
+		ratingsByProduct.mu.Lock()
+		defer ratingsByProduct.mu.Unlock()
+		return ratingsByProduct.live
+	}
+	eventually(t, "the subscription", live)
+
+	lookupRatings("1", http.Header{})
+	lookupRatings("1", http.Header{})
+	if n := lookups.Load(); n != 1 {
+		t.Fatalf("got %d lookups with the ratings cached, want 1", n)
+	}
+
+	broker.send("ratings.2", `{"seq":1,"id":2,"ratings":{}}`)
+	broker.send("ratings.1", `{"seq":2,"id":1,"ratings":{"Reviewer1":1}}`)
+	eventually(t, "the eviction", func() bool {
+		_, _, hit := ratingsByProduct.get(1)
+		return !hit
+	})
+	lookupRatings("1", http.Header{})
+	if n := lookups.Load(); n != 2 {
+		t.Errorf("got %d lookups after the change, want 2", n)
+	}
+
+	// Without the subscription changes go unnoticed, so nothing is cached
+	broker.dropConnections()
+	eventually(t, "the cache to be suspended", func() bool { return !live() })
+	lookupRatings("1", http.Header{})
+	if n := lookups.Load(); n != 3 {
+		t.Errorf("got %d lookups while disconnected, want 3", n)
+	}
+	eventually(t, "the subscription to be restored", live)
+}
@@ -0,0 +1,212 @@
+package reviews
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/camilamedeir0s/bookinfo-go/bookinfopb"
+)
+
+var (
+	ratingsConnOnce sync.Once
+	ratingsConn     *grpc.ClientConn
+	ratingsClient   bookinfopb.RatingsClient
+	ratingsConnErr  error
+)
+
+type reviewsServer struct {
+	bookinfopb.UnimplementedReviewsServer
+}
+
+func (reviewsServer) GetReviews(ctx context.Context, req *bookinfopb.GetReviewsRequest) (*bookinfopb.GetReviewsResponse, error) {
+	// Reuse the HTTP query validation so both APIs accept the same values.
+	values := url.Values{}
+	if req.GetPage() != 0 {
+		values.Set("page", strconv.Itoa(int(req.GetPage())))
+	}
+	if req.GetPageSize() != 0 {
+		values.Set("pageSize", strconv.Itoa(int(req.GetPageSize())))
+	}
+	if req.GetCursor() != "" {
+		values.Set("cursor", req.GetCursor())
+	}
+	if req.GetSort() != "" {
+		values.Set("sort", req.GetSort())
+	}
+	if req.GetMinStars() != 0 {
+		values.Set("minStars", strconv.Itoa(int(req.GetMinStars())))
+	}
+
+	query, err := parseReviewsQuery(values)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	productId := strconv.Itoa(int(req.GetProductId()))
+	return toGetReviewsResponse(reviewsResponse(productId, query, incomingHeader(ctx))), nil
+}
+
+func toGetReviewsResponse(response Response) *bookinfopb.GetReviewsResponse {
+	result := &bookinfopb.GetReviewsResponse{
+		Id:          response.ID,
+		Podname:     response.PodName,
+		Clustername: response.ClusterName,
+		Version:     response.Version,
+	}
+
+	for _, review := range response.Reviews {
+		pbReview := &bookinfopb.Review{Reviewer: review.Reviewer, Text: review.Text, Date: review.Date}
+		if review.Rating != nil {
+			pbReview.Rating = &bookinfopb.Rating{Stars: int32(review.Rating.Stars), Color: review.Rating.Color}
+		}
+		result.Reviews = append(result.Reviews, pbReview)
+	}
+
+	if p := response.Pagination; p != nil {
+		result.Pagination = &bookinfopb.Pagination{
+			Page:         int32(p.Page),
+			PageSize:     int32(p.PageSize),
+			TotalReviews: int32(p.TotalReviews),
+			TotalPages:   int32(p.TotalPages),
+			NextCursor:   p.NextCursor,
+			PrevCursor:   p.PrevCursor,
+		}
+	}
+
+	return result
+}
+
+// authInterceptor is the gRPC counterpart of authMiddleware, rejecting calls
+// whose "authorization" metadata carries an invalid bearer token.
+func authInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if authVerifier == nil {
+		return handler(ctx, req)
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("authorization"); len(values) > 0 && bearerToken(values[0]) != "" {
+		if _, err := authVerifier.Verify(bearerToken(values[0])); err != nil {
+			return nil, status.Error(codes.Unauthenticated, "invalid token: "+err.Error())
+		}
+	}
+	return handler(ctx, req)
+}
+
+// newGRPCServer registers the gRPC API, which is served next to the HTTP one.
+func newGRPCServer() *grpc.Server {
+	server := grpc.NewServer(grpc.UnaryInterceptor(authInterceptor))
+	bookinfopb.RegisterReviewsServer(server, reviewsServer{})
+	return server
+}
+
+// serveGRPC starts serving the gRPC API of server on port.
+func serveGRPC(port int, server *Server) {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		log.Fatalf("Could not listen on gRPC port %d: %v", port, err)
+	}
+
+	go func() {
+		log.Printf("gRPC server started at :%d", port)
+		if err := server.ServeGRPC(lis); err != nil {
+			log.Fatal(err)
+		}
+	}()
+}
+
+// stopGRPC lets in-flight RPCs finish, closing the server outright if ctx
+// expires first.
+func stopGRPC(server *grpc.Server) func(context.Context) {
+	return func(ctx context.Context) {
+		done := make(chan struct{})
+		go func() {
+			server.GracefulStop()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			server.Stop()
+		}
+	}
+}
+
+// closeRatingsConn closes the connection to the gRPC API of ratings, if one
+// was made, so that the next call connects again.
+func closeRatingsConn(context.Context) {
+	if ratingsConn != nil {
+		ratingsConn.Close()
+	}
+	ratingsConnOnce = sync.Once{}
+	ratingsConn, ratingsClient, ratingsConnErr = nil, nil, nil
+}
+
+// getRatingsGRPC is the gRPC counterpart of getRatings, used when
+// CLIENT_PROTOCOL=grpc.
+func getRatingsGRPC(productId string, incoming http.Header) (map[string]int, error) {
+	id, err := strconv.Atoi(productId)
+	if err != nil {
+		return nil, err
+	}
+
+	ratingsConnOnce.Do(func() {
+		ratingsConn, ratingsConnErr = grpc.NewClient(config.ratingsGRPCTarget(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if ratingsConnErr == nil {
+			ratingsClient = bookinfopb.NewRatingsClient(ratingsConn)
+		}
+	})
+	if ratingsConnErr != nil {
+		return nil, ratingsConnErr
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), httpClient.Timeout)
+	defer cancel()
+
+	md := metadata.MD{}
+	for _, header := range headersToPropagate {
+		if value := incoming.Get(header); value != "" {
+			md.Set(header, value)
+		}
+	}
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	resp, err := ratingsClient.GetRatings(ctx, &bookinfopb.GetRatingsRequest{ProductId: int32(id)})
+	if err != nil {
+		return nil, err
+	}
+
+	ratings := make(map[string]int, len(resp.GetRatings()))
+	for reviewer, stars := range resp.GetRatings() {
+		ratings[reviewer] = int(stars)
+	}
+	return ratings, nil
+}
+
+// incomingHeader copies the propagated headers from the gRPC metadata so the
+// shared code paths can treat both APIs alike.
+func incomingHeader(ctx context.Context) http.Header {
+	header := http.Header{}
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return header
+	}
+
+	for _, name := range headersToPropagate {
+		if values := md.Get(name); len(values) > 0 {
+			header.Set(name, values[0])
+		}
+	}
+	return header
+}
@@ -0,0 +1,195 @@
+package reviews
+
+import (
+	"encoding/base64"
+	"errors"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+const (
+	defaultPageSize = 10
+	maxPageSize     = 100
+)
+
+// Pagination describes the slice of reviews returned in a Response. Cursors
+// are opaque to clients: they are passed back as ?cursor= to fetch the
+// neighbouring page with the same sort and filters.
+type Pagination struct {
+	Page         int    `json:"page"`
+	PageSize     int    `json:"pageSize"`
+	TotalReviews int    `json:"totalReviews"`
+	TotalPages   int    `json:"totalPages"`
+	NextCursor   string `json:"nextCursor,omitempty"`
+	PrevCursor   string `json:"prevCursor,omitempty"`
+}
+
+type reviewsQuery struct {
+	offset   int
+	pageSize int
+	sort     string
+	minStars int
+}
+
+// parseReviewsQuery reads ?page, ?pageSize, ?cursor, ?sort and ?minStars.
+// A cursor takes precedence over page when both are present. It carries the
+// page size, sort and filter of the response it came from, which apply when
+// they are not given; given ones must match, as the cursor offset would point
+// into a different list otherwise.
+func parseReviewsQuery(values url.Values) (reviewsQuery, error) {
+	query := reviewsQuery{pageSize: defaultPageSize}
+
+	if value := values.Get("pageSize"); value != "" {
+		pageSize, err := strconv.Atoi(value)
+		if err != nil || pageSize < 1 || pageSize > maxPageSize {
+			return query, errors.New("pageSize must be a number between 1 and " + strconv.Itoa(maxPageSize))
+		}
+		query.pageSize = pageSize
+	}
+
+	switch sortBy := values.Get("sort"); sortBy {
+	case "", "stars", "date":
+		query.sort = sortBy
+	default:
+		return query, errors.New("sort must be one of: stars, date")
+	}
+
+	if value := values.Get("minStars"); value != "" {
+		minStars, err := strconv.Atoi(value)
+		if err != nil || minStars < 0 || minStars > 5 {
+			return query, errors.New("minStars must be a number between 0 and 5")
+		}
+		query.minStars = minStars
+	}
+
+	if value := values.Get("cursor"); value != "" {
+		cursor, err := decodeCursor(value)
+		if err != nil {
+			return query, errors.New("invalid cursor")
+		}
+		if values.Has("pageSize") && cursor.pageSize != query.pageSize ||
+			values.Has("sort") && cursor.sort != query.sort ||
+			values.Has("minStars") && cursor.minStars != query.minStars {
+			return query, errors.New("cursor does not match pageSize, sort or minStars")
+		}
+		return cursor, nil
+	}
+
+	if value := values.Get("page"); value != "" {
+		page, err := strconv.Atoi(value)
+		// Bounded so that the offset of the page and of the one after it fit
+		// in an int
+		if err != nil || page < 1 || page > math.MaxInt/query.pageSize {
+			return query, errors.New("page must be a number between 1 and " + strconv.Itoa(math.MaxInt/query.pageSize))
+		}
+		query.offset = (page - 1) * query.pageSize
+	}
+
+	return query, nil
+}
+
+// apply filters, sorts and pages reviews according to the query.
+func (q reviewsQuery) apply(reviews []Review) ([]Review, Pagination) {
+	filtered := make([]Review, 0, len(reviews))
+	for _, review := range reviews {
+		if q.minStars > 0 && (review.Rating == nil || review.Rating.Stars < q.minStars) {
+			continue
+		}
+		filtered = append(filtered, review)
+	}
+
+	switch q.sort {
+	case "stars":
+		sort.SliceStable(filtered, func(i, j int) bool {
+			return reviewStars(filtered[i]) > reviewStars(filtered[j])
+		})
+	case "date":
+		// Dates are stored as YYYY-MM-DD, so string order is date order.
+		sort.SliceStable(filtered, func(i, j int) bool {
+			return filtered[i].Date > filtered[j].Date
+		})
+	}
+
+	total := len(filtered)
+	pagination := Pagination{
+		Page:         q.offset/q.pageSize + 1,
+		PageSize:     q.pageSize,
+		TotalReviews: total,
+		TotalPages:   (total + q.pageSize - 1) / q.pageSize,
+	}
+
+	if q.offset > 0 {
+		prev := q.offset - q.pageSize
+		if prev < 0 {
+			prev = 0
+		}
+		pagination.PrevCursor = q.encodeCursor(prev)
+	}
+	if q.offset+q.pageSize < total {
+		pagination.NextCursor = q.encodeCursor(q.offset + q.pageSize)
+	}
+
+	if q.offset >= total {
+		return []Review{}, pagination
+	}
+	end := q.offset + q.pageSize
+	if end > total {
+		end = total
+	}
+	return filtered[q.offset:end], pagination
+}
+
+// reviewStars returns the stars of a review, ranking unrated reviews last.
+func reviewStars(review Review) int {
+	if review.Rating == nil {
+		return -1
+	}
+	return review.Rating.Stars
+}
+
+// encodeCursor returns the cursor of the page at offset, with the same page
+// size, sort and filter as q.
+func (q reviewsQuery) encodeCursor(offset int) string {
+	values := url.Values{}
+	values.Set("o", strconv.Itoa(offset))
+	values.Set("n", strconv.Itoa(q.pageSize))
+	values.Set("s", q.sort)
+	values.Set("m", strconv.Itoa(q.minStars))
+	return base64.RawURLEncoding.EncodeToString([]byte(values.Encode()))
+}
+
+func decodeCursor(cursor string) (reviewsQuery, error) {
+	invalid := errors.New("invalid cursor")
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return reviewsQuery{}, invalid
+	}
+	values, err := url.ParseQuery(string(raw))
+	if err != nil {
+		return reviewsQuery{}, invalid
+	}
+
+	var q reviewsQuery
+	if q.offset, err = strconv.Atoi(values.Get("o")); err != nil {
+		return q, invalid
+	}
+	if q.pageSize, err = strconv.Atoi(values.Get("n")); err != nil || q.pageSize < 1 || q.pageSize > maxPageSize {
+		return q, invalid
+	}
+	if q.minStars, err = strconv.Atoi(values.Get("m")); err != nil || q.minStars < 0 || q.minStars > 5 {
+		return q, invalid
+	}
+	switch q.sort = values.Get("s"); q.sort {
+	case "", "stars", "date":
+	default:
+		return q, invalid
+	}
+	// Cursors only point at page boundaries
+	if q.offset < 0 || q.offset%q.pageSize != 0 || q.offset > math.MaxInt-q.pageSize {
+		return q, invalid
+	}
+	return q, nil
+}
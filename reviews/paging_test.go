@@ -0,0 +1,183 @@
+package reviews
+
+import (
+	"encoding/base64"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pagingReviews has five reviews, one of them unrated.
+var pagingReviews = []Review{
+	{Reviewer: "a", Date: "2023-01-01", Rating: &Rating{Stars: 3}},
+	{Reviewer: "b", Date: "2023-05-01", Rating: &Rating{Stars: 5}},
+	{Reviewer: "c", Date: "2023-03-01"},
+	{Reviewer: "d", Date: "2023-02-01", Rating: &Rating{Stars: 1}},
+	{Reviewer: "e", Date: "2023-04-01", Rating: &Rating{Stars: 4}},
+}
+
+func TestApplyReviewsQuery(t *testing.T) {
+	tests := []struct {
+		query     string
+		want      []string
+		page      int
+		total     int
+		pages     int
+		prev      bool
+		next      bool
+		nextQuery string // query that must fetch the page after, if any
+	}{
+		{query: "", want: []string{"a", "b", "c", "d", "e"}, page: 1, total: 5, pages: 1},
+		{query: "pageSize=2", want: []string{"a", "b"}, page: 1, total: 5, pages: 3, next: true},
+		{query: "pageSize=2&page=2", want: []string{"c", "d"}, page: 2, total: 5, pages: 3, prev: true, next: true},
+		// The last page is short and has no next cursor
+		{query: "pageSize=2&page=3", want: []string{"e"}, page: 3, total: 5, pages: 3, prev: true},
+		{query: "pageSize=2&page=4", want: []string{}, page: 4, total: 5, pages: 3, prev: true},
+		{query: "sort=stars", want: []string{"b", "e", "a", "d", "c"}, page: 1, total: 5, pages: 1},
+		{query: "sort=date", want: []string{"b", "e", "c", "d", "a"}, page: 1, total: 5, pages: 1},
+		// Filtering leaves unrated reviews out and counts what is left
+		{query: "minStars=3", want: []string{"a", "b", "e"}, page: 1, total: 3, pages: 1},
+		{query: "minStars=3&sort=stars&pageSize=2", want: []string{"b", "e"}, page: 1, total: 3, pages: 2, next: true, nextQuery: "minStars=3&sort=stars&pageSize=2"},
+		{query: "minStars=6", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			values, _ := url.ParseQuery(tt.query)
+			query, err := parseReviewsQuery(values)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			reviews, pagination := query.apply(pagingReviews)
+			if got := reviewers(reviews); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got reviews %v, want %v", got, tt.want)
+			}
+			if pagination.Page != tt.page || pagination.TotalReviews != tt.total || pagination.TotalPages != tt.pages {
+				t.Errorf("got page %d of %d with %d reviews, want page %d of %d with %d",
+					pagination.Page, pagination.TotalPages, pagination.TotalReviews, tt.page, tt.pages, tt.total)
+			}
+			if (pagination.PrevCursor != "") != tt.prev || (pagination.NextCursor != "") != tt.next {
+				t.Errorf("got prev cursor %q and next cursor %q", pagination.PrevCursor, pagination.NextCursor)
+			}
+
+			if tt.nextQuery != "" {
+				values, _ := url.ParseQuery(tt.nextQuery)
+				values.Set("cursor", pagination.NextCursor)
+				next, err := parseReviewsQuery(values)
+				if err != nil {
+					t.Fatalf("following the next cursor: %v", err)
+				}
+				reviews, pagination := next.apply(pagingReviews)
+				if got := reviewers(reviews); !reflect.DeepEqual(got, []string{"a"}) || pagination.Page != 2 {
+					t.Errorf("got reviews %v on page %d after the next cursor", got, pagination.Page)
+				}
+			}
+		})
+	}
+}
+
+func TestCursorKeepsPageSizeSortAndFilter(t *testing.T) {
+	values, _ := url.ParseQuery("pageSize=2&sort=date&minStars=1")
+	query, err := parseReviewsQuery(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, pagination := query.apply(pagingReviews)
+
+	// Without the other parameters, the cursor brings its own
+	next, err := parseReviewsQuery(url.Values{"cursor": {pagination.NextCursor}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (reviewsQuery{offset: 2, pageSize: 2, sort: "date", minStars: 1}); next != want {
+		t.Errorf("got %+v, want %+v", next, want)
+	}
+
+	for _, mismatch := range []string{"pageSize=3", "sort=stars", "sort=", "minStars=2", "pageSize=10"} {
+		values, _ := url.ParseQuery(mismatch)
+		values.Set("cursor", pagination.NextCursor)
+		if _, err := parseReviewsQuery(values); err == nil {
+			t.Errorf("%s: expected an error for a cursor of another query", mismatch)
+		}
+	}
+
+	// The cursor takes precedence over page
+	values.Set("cursor", pagination.NextCursor)
+	values.Set("page", "3")
+	if got, err := parseReviewsQuery(values); err != nil || got.offset != 2 {
+		t.Errorf("got offset %d and error %v with both cursor and page, want 2", got.offset, err)
+	}
+}
+
+func TestParseReviewsQueryRejectsOutOfRangeOffsets(t *testing.T) {
+	cursor := func(raw string) string { return base64.RawURLEncoding.EncodeToString([]byte(raw)) }
+
+	tests := []struct {
+		name   string
+		values url.Values
+	}{
+		{"page overflowing the offset", url.Values{"page": {strconv.Itoa(math.MaxInt)}, "pageSize": {"10"}}},
+		{"page past the largest offset", url.Values{"page": {strconv.Itoa(math.MaxInt/10 + 1)}}},
+		{"page not a number", url.Values{"page": {"99999999999999999999"}}},
+		{"page zero", url.Values{"page": {"0"}}},
+		{"cursor not base64", url.Values{"cursor": {"!!"}}},
+		{"cursor of the old format", url.Values{"cursor": {cursor("o:10")}}},
+		{"cursor with a negative offset", url.Values{"cursor": {cursor("o=-10&n=10&s=&m=0")}}},
+		{"cursor with an overflowing offset", url.Values{"cursor": {cursor("o=" + strconv.Itoa(math.MaxInt-5) + "&n=10&s=&m=0")}}},
+		{"cursor off a page boundary", url.Values{"cursor": {cursor("o=5&n=10&s=&m=0")}}},
+		{"cursor with a bad page size", url.Values{"cursor": {cursor("o=0&n=0&s=&m=0")}}},
+		{"cursor with a bad sort", url.Values{"cursor": {cursor("o=0&n=10&s=title&m=0")}}},
+		{"cursor with bad stars", url.Values{"cursor": {cursor("o=0&n=10&s=&m=9")}}},
+	}
+	for _, tt := range tests {
+		if _, err := parseReviewsQuery(tt.values); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+
+	// The largest page is accepted and simply empty
+	values := url.Values{"page": {strconv.Itoa(math.MaxInt / 10)}}
+	query, err := parseReviewsQuery(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reviews, _ := query.apply(pagingReviews); len(reviews) != 0 {
+		t.Errorf("got %d reviews on the last possible page", len(reviews))
+	}
+}
+
+func TestBookReviewsByIDRejectsHugePages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	useConfig(t, func(c *Config) { c.OpenAPIValidation = "off" })
+	r, err := setupRouter()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/reviews/0?pageSize=100&page=9223372036854775807", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func reviewers(reviews []Review) []string {
+	names := []string{}
+	for _, review := range reviews {
+		names = append(names, review.Reviewer)
+	}
+	return names
+}
@@ -1,10 +1,17 @@
-package main
+// Package reviews is the reviews service of bookinfo, which serves the reviews
+// of a product with their ratings. The command is in cmd/reviews.
+package reviews
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
+	"sort"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -13,6 +20,7 @@ import (
 type Review struct {
 	Reviewer string  `json:"reviewer"`
 	Text     string  `json:"text"`
+	Date     string  `json:"date,omitempty"`
 	Rating   *Rating `json:"rating,omitempty"`
 }
 
@@ -22,132 +30,243 @@ type Rating struct {
 }
 
 type Response struct {
-	ID          string   `json:"id"`
-	PodName     string   `json:"podname"`
-	ClusterName string   `json:"clustername"`
-	Reviews     []Review `json:"reviews"`
+	ID          string      `json:"id"`
+	PodName     string      `json:"podname"`
+	ClusterName string      `json:"clustername"`
+	Version     string      `json:"version"`
+	Reviews     []Review    `json:"reviews"`
+	Pagination  *Pagination `json:"pagination,omitempty"`
 }
 
-var (
-	ratingsEnabled = getEnvAsBool("ENABLE_RATINGS", false)
-	starColor      = getEnv("STAR_COLOR", "black")
-	ratingsService = fmt.Sprintf("http://%s:%s/ratings",
-		getEnv("RATINGS_HOSTNAME", "ratings"),
-		getEnv("RATINGS_SERVICE_PORT", "8085"),
-	)
-	podHostname = getEnv("HOSTNAME", "unknown")
-	clusterName = getEnv("CLUSTER_NAME", "unknown")
-	httpClient  = &http.Client{Timeout: 10 * time.Second}
-)
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Main runs the reviews service with the command line arguments args until
+// SIGINT or SIGTERM.
+func Main(args []string) {
+	var err error
+	config, err = loadConfig(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+	if config.PrintConfig {
+		printConfig(os.Stdout, config)
+		return
+	}
+
+	server, err := setup()
+	if err != nil {
+		log.Fatal("Could not set up router: ", err)
+	}
+
+	serveGRPC(config.GRPCPort, server)
+
+	serve(fmt.Sprintf(":%d", config.Port), server.Handler, server.cleanup...)
+}
+
+// New loads the configuration from args like Main and sets the service up
+// without listening, for the caller to serve.
+func New(args []string) (*Server, error) {
+	var err error
+	if config, err = loadConfig(args); err != nil {
+		return nil, err
+	}
+	return setup()
+}
+
+// setup builds the router and the gRPC server for the loaded configuration,
+// and starts watching rating changes. Nothing is kept from a previous server:
+// the cached ratings, the ratings connection and the JWKS start anew.
+func setup() (*Server, error) {
+	authVerifier = nil
+	ratingsByProduct = newRatingsCache()
+
+	router, err := setupRouter()
+	if err != nil {
+		return nil, err
+	}
+
+	grpcServer := newGRPCServer()
+	cleanup := []func(context.Context){stopGRPC(grpcServer), closeRatingsConn}
+	if config.EventBusURL != "" && config.RatingsCacheTTL > 0 {
+		cleanup = append(cleanup, watchRatingEvents(config.EventBusURL))
+	}
+	return &Server{Handler: router, grpc: grpcServer, cleanup: cleanup}, nil
+}
+
+// setupRouter registers the HTTP API behind the OpenAPI validation and JWT
+// authentication middlewares.
+func setupRouter() (*gin.Engine, error) {
+	_, spec, err := loadOpenAPI()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.JWTJWKSFile != "" {
+		if authVerifier, err = loadJWKS(config.JWTJWKSFile, config.JWTIssuer); err != nil {
+			return nil, fmt.Errorf("loading JWKS: %w", err)
+		}
+	}
 
-func main() {
 	router := gin.Default()
+	// Without trusted proxies gin ignores X-Forwarded-For and the client IP
+	// is the peer address
+	if err := router.SetTrustedProxies(config.TrustedProxies); err != nil {
+		return nil, err
+	}
+	if limiter := rateLimitMiddleware(); limiter != nil {
+		router.Use(limiter)
+	}
+	router.Use(openAPIValidator(spec, config.OpenAPIValidation))
+	router.Use(authMiddleware)
 
+	router.GET("/openapi.json", openAPIHandler)
 	router.GET("/health", health)
 	router.GET("/reviews/:productId", bookReviewsByID)
 
-	router.Run(":9086")
+	return router, nil
 }
 
 func health(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"status": "Reviews is healthy"})
+	if draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "Reviews is shutting down", "version": config.ServiceVersion})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "Reviews is healthy", "version": config.ServiceVersion})
 }
 
 func bookReviewsByID(c *gin.Context) {
 	productId := c.Param("productId")
-	starsReviewer1 := -1
-	starsReviewer2 := -1
-
-	if ratingsEnabled {
-		ratingsResponse, err := getRatings(productId, c.Request)
-		fmt.Println(ratingsResponse)
-		if err == nil {
-			if ratings, exists := ratingsResponse["ratings"].(map[string]interface{}); exists {
-				if reviewer1, exists := ratings["Reviewer1"].(float64); exists {
-					starsReviewer1 = int(reviewer1)
-				}
-				if reviewer2, exists := ratings["Reviewer2"].(float64); exists {
-					starsReviewer2 = int(reviewer2)
-				}
-			}
-		}
+
+	query, err := parseReviewsQuery(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	response := getJsonResponse(productId, starsReviewer1, starsReviewer2)
-	c.JSON(http.StatusOK, response)
+	c.JSON(http.StatusOK, reviewsResponse(productId, query, c.Request.Header))
 }
 
-func getRatings(productId string, req *http.Request) (map[string]interface{}, error) {
-	url := fmt.Sprintf("%s/%s", ratingsService, productId)
+// reviewsResponse builds the reviews of a product, joined with its ratings
+// and paged according to query. It is shared by the HTTP and gRPC APIs.
+func reviewsResponse(productId string, query reviewsQuery, header http.Header) Response {
+	// nil means the ratings service could not be reached, which is rendered
+	// differently from a product that simply has no ratings yet.
+	var ratings map[string]int
+
+	if config.EnableRatings {
+		ratings = lookupRatings(productId, header)
+	}
+
+	response := getJsonResponse(productId, ratings)
+	reviews, pagination := query.apply(response.Reviews)
+	response.Reviews = reviews
+	response.Pagination = &pagination
+	return response
+}
+
+func getRatings(productId string, incoming http.Header) (map[string]interface{}, error) {
+	url := fmt.Sprintf("%s/%s", config.ratingsURL(), productId)
 	request, _ := http.NewRequest("GET", url, nil)
-	fmt.Println(url)
 
 	for _, header := range headersToPropagate {
-		if value := req.Header.Get(header); value != "" {
+		if value := incoming.Get(header); value != "" {
 			request.Header.Set(header, value)
 		}
 	}
 
 	resp, err := httpClient.Do(request)
-	if err != nil || resp.StatusCode != http.StatusOK {
+	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ratings service returned status %d", resp.StatusCode)
+	}
 
 	var result map[string]interface{}
-	json.NewDecoder(resp.Body).Decode(&result)
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
 	return result, nil
 }
 
-func getJsonResponse(productId string, starsReviewer1, starsReviewer2 int) Response {
-	reviews := []Review{
-		{
-			Reviewer: "Reviewer1",
-			Text:     "An extremely entertaining play by Shakespeare. The slapstick humour is refreshing!",
-		},
-		{
-			Reviewer: "Reviewer2",
-			Text:     "Absolutely fun and entertaining. The play lacks thematic depth when compared to other plays by Shakespeare.",
-		},
-	}
-
-	if ratingsEnabled {
-		if starsReviewer1 != -1 {
-			reviews[0].Rating = &Rating{Stars: starsReviewer1, Color: starColor}
-		} else {
-			reviews[0].Rating = &Rating{Stars: -1, Color: "Ratings service is unavailable"}
+// parseRatings extracts the reviewer -> stars map from a ratings service
+// response. It returns nil when the response has no ratings object.
+func parseRatings(ratingsResponse map[string]interface{}) map[string]int {
+	raw, exists := ratingsResponse["ratings"].(map[string]interface{})
+	if !exists {
+		return nil
+	}
+
+	ratings := make(map[string]int, len(raw))
+	for reviewer, value := range raw {
+		if stars, ok := value.(float64); ok {
+			ratings[reviewer] = int(stars)
+		}
+	}
+	return ratings
+}
+
+func getJsonResponse(productId string, ratings map[string]int) Response {
+	reviews := make([]Review, len(productReviews))
+	copy(reviews, productReviews)
+
+	if config.EnableRatings {
+		reviewed := make(map[string]bool, len(reviews))
+		for i := range reviews {
+			reviewed[reviews[i].Reviewer] = true
+
+			if ratings == nil {
+				reviews[i].Rating = &Rating{Stars: -1, Color: "Ratings service is unavailable"}
+			} else if stars, exists := ratings[reviews[i].Reviewer]; exists {
+				reviews[i].Rating = &Rating{Stars: stars, Color: config.StarColor}
+			}
 		}
 
-		if starsReviewer2 != -1 {
-			reviews[1].Rating = &Rating{Stars: starsReviewer2, Color: starColor}
-		} else {
-			reviews[1].Rating = &Rating{Stars: -1, Color: "Ratings service is unavailable"}
+		// Ratings left by users without a written review are still listed,
+		// in a stable order so responses don't change between requests.
+		var unreviewed []string
+		for reviewer := range ratings {
+			if !reviewed[reviewer] {
+				unreviewed = append(unreviewed, reviewer)
+			}
+		}
+		sort.Strings(unreviewed)
+
+		for _, reviewer := range unreviewed {
+			reviews = append(reviews, Review{
+				Reviewer: reviewer,
+				Rating:   &Rating{Stars: ratings[reviewer], Color: config.StarColor},
+			})
 		}
 	}
 
 	return Response{
 		ID:          productId,
-		PodName:     podHostname,
-		ClusterName: clusterName,
+		PodName:     config.PodName,
+		ClusterName: config.ClusterName,
+		Version:     config.ServiceVersion,
 		Reviews:     reviews,
 	}
 }
 
-// Utility functions
-
-func getEnv(key, fallback string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
-	}
-	return fallback
+var productReviews = []Review{
+	{
+		Reviewer: "Reviewer1",
+		Text:     "An extremely entertaining play by Shakespeare. The slapstick humour is refreshing!",
+		Date:     "2023-03-14",
+	},
+	{
+		Reviewer: "Reviewer2",
+		Text:     "Absolutely fun and entertaining. The play lacks thematic depth when compared to other plays by Shakespeare.",
+		Date:     "2023-06-02",
+	},
 }
 
-func getEnvAsBool(key string, fallback bool) bool {
-	if value, exists := os.LookupEnv(key); exists {
-		return value == "true"
-	}
-	return fallback
-}
+// Utility functions
 
 var headersToPropagate = []string{
 	"x-request-id",
@@ -0,0 +1,161 @@
+package reviews
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestGetJsonResponseMergesRatingsByReviewer(t *testing.T) {
+	useConfig(t, func(c *Config) {
+		c.EnableRatings = true
+		c.StarColor = "red"
+	})
+
+	tests := []struct {
+		name    string
+		ratings map[string]int
+		want    []Review
+	}{
+		{
+			name:    "every reviewer rated",
+			ratings: map[string]int{"Reviewer1": 5, "Reviewer2": 4},
+			want: []Review{
+				{Reviewer: "Reviewer1", Rating: &Rating{Stars: 5, Color: "red"}},
+				{Reviewer: "Reviewer2", Rating: &Rating{Stars: 4, Color: "red"}},
+			},
+		},
+		{
+			name:    "reviewer without a rating",
+			ratings: map[string]int{"Reviewer2": 3},
+			want: []Review{
+				{Reviewer: "Reviewer1"},
+				{Reviewer: "Reviewer2", Rating: &Rating{Stars: 3, Color: "red"}},
+			},
+		},
+		{
+			name:    "ratings without a review are listed in name order",
+			ratings: map[string]int{"Reviewer1": 1, "zoe": 2, "alice": 4},
+			want: []Review{
+				{Reviewer: "Reviewer1", Rating: &Rating{Stars: 1, Color: "red"}},
+				{Reviewer: "Reviewer2"},
+				{Reviewer: "alice", Rating: &Rating{Stars: 4, Color: "red"}},
+				{Reviewer: "zoe", Rating: &Rating{Stars: 2, Color: "red"}},
+			},
+		},
+		{
+			name:    "no ratings yet",
+			ratings: map[string]int{},
+			want:    []Review{{Reviewer: "Reviewer1"}, {Reviewer: "Reviewer2"}},
+		},
+		{
+			name:    "ratings unavailable",
+			ratings: nil,
+			want: []Review{
+				{Reviewer: "Reviewer1", Rating: &Rating{Stars: -1, Color: "Ratings service is unavailable"}},
+				{Reviewer: "Reviewer2", Rating: &Rating{Stars: -1, Color: "Ratings service is unavailable"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := getJsonResponse("0", tt.ratings)
+			if got := reviewersAndRatings(response.Reviews); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetJsonResponseReportsServiceVersion(t *testing.T) {
+	useConfig(t, func(c *Config) {
+		c.ServiceVersion = "v3"
+		c.PodName = "laptop"
+		c.ClusterName = "east"
+	})
+
+	response := getJsonResponse("0", nil)
+	if response.Version != "v3" || response.PodName != "laptop" || response.ClusterName != "east" {
+		t.Errorf("got version %q, pod %q and cluster %q", response.Version, response.PodName, response.ClusterName)
+	}
+	if got := toGetReviewsResponse(response).GetVersion(); got != "v3" {
+		t.Errorf("got version %q over gRPC, want v3", got)
+	}
+}
+
+func TestGetJsonResponseWithoutRatings(t *testing.T) {
+	useConfig(t, func(c *Config) { c.EnableRatings = false })
+
+	response := getJsonResponse("0", map[string]int{"Reviewer1": 5, "alice": 4})
+	if len(response.Reviews) != len(productReviews) {
+		t.Fatalf("got %d reviews, want %d", len(response.Reviews), len(productReviews))
+	}
+	for _, review := range response.Reviews {
+		if review.Rating != nil {
+			t.Errorf("review by %s has a rating with ratings disabled", review.Reviewer)
+		}
+	}
+}
+
+func TestGetJsonResponseDoesNotModifyStoredReviews(t *testing.T) {
+	useConfig(t, func(c *Config) { c.EnableRatings = true })
+
+	getJsonResponse("0", map[string]int{"Reviewer1": 5})
+	for _, review := range productReviews {
+		if review.Rating != nil {
+			t.Fatalf("stored review by %s was given a rating", review.Reviewer)
+		}
+	}
+}
+
+func TestParseRatings(t *testing.T) {
+	got := parseRatings(map[string]interface{}{
+		"id":      float64(0),
+		"ratings": map[string]interface{}{"Reviewer1": float64(5), "alice": float64(2), "bad": "x"},
+	})
+	if want := map[string]int{"Reviewer1": 5, "alice": 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if got := parseRatings(map[string]interface{}{"error": "Could not connect to ratings database"}); got != nil {
+		t.Errorf("got %v for a response without ratings, want nil", got)
+	}
+}
+
+// reviewersAndRatings keeps only the reviewer and rating of each review.
+func reviewersAndRatings(reviews []Review) []Review {
+	kept := make([]Review, len(reviews))
+	for i, review := range reviews {
+		kept[i] = Review{Reviewer: review.Reviewer, Rating: review.Rating}
+	}
+	return kept
+}
+
+func TestGetRatingsRejectsErrorStatus(t *testing.T) {
+	ratings := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		io.WriteString(w, `{"id":1,"ratings":{"Reviewer1":5}}`)
+	}))
+	defer ratings.Close()
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(ratings.URL, "http://"))
+	servicePort, _ := strconv.Atoi(port)
+	useConfig(t, func(c *Config) {
+		c.EnableRatings = true
+		c.RatingsHostname = host
+		c.RatingsServicePort = servicePort
+	})
+
+	if _, err := getRatings("1", http.Header{}); err == nil {
+		t.Error("got no error for a 503 from the ratings service")
+	}
+	response := getJsonResponse("1", lookupRatings("1", http.Header{}))
+	if rating := response.Reviews[0].Rating; rating == nil || rating.Stars != -1 {
+		t.Errorf("got rating %+v, want ratings marked unavailable", rating)
+	}
+}